@@ -0,0 +1,61 @@
+// Command combined runs Service A, Service B or both in one process, as MODE
+// says, for small deployments and local development.
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	servicea "service-a"
+	serviceb "service-b"
+)
+
+const (
+	modeServiceA = "service-a"
+	modeServiceB = "service-b"
+	modeCombined = "combined"
+)
+
+func main() {
+	mode := os.Getenv("MODE")
+	if mode == "" {
+		mode = modeCombined
+	}
+	switch mode {
+	case modeServiceA:
+		servicea.Main()
+	case modeServiceB:
+		serviceb.Main()
+	case modeCombined:
+		runCombined()
+	default:
+		log.Fatalf("invalid MODE %q: must be %s, %s or %s", mode, modeServiceA, modeServiceB, modeCombined)
+	}
+}
+
+// runCombined serves both services on their usual ports until they are told
+// to stop. Service B sets up the tracer and meter providers from the OTEL_*
+// variables and Service A reports through them, so the process exports a
+// single stream of spans and metrics.
+func runCombined() {
+	// Service A calls the Service B of this process unless told otherwise
+	if _, ok := os.LookupEnv("SERVICE_B_URL"); !ok {
+		os.Setenv("SERVICE_B_URL", "http://localhost:8081")
+	}
+	// Service A finds Service B's providers as the global ones
+	if os.Getenv("SET_GLOBAL_OTEL") == "false" {
+		log.Printf("ignoring SET_GLOBAL_OTEL=false: both services share the global providers in MODE=%s", modeCombined)
+	}
+	os.Setenv("SET_GLOBAL_OTEL", "true")
+
+	var wg sync.WaitGroup
+	for _, run := range []func(){serviceb.Main, servicea.MainSharingTelemetry} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+	wg.Wait()
+}
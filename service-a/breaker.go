@@ -0,0 +1,96 @@
+package servicea
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"shared"
+)
+
+// ErrCircuitOpen is returned without calling Service B while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("service b circuit breaker open")
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// callOutcome is what a call to Service B tells its circuit breaker.
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// Cancelled by our own client, which says nothing about Service B's health
+	callCancelled
+)
+
+// circuitBreaker fails calls to Service B fast once SERVICE_B_BREAKER_THRESHOLD
+// of them failed in a row, instead of having every request wait out the
+// timeouts. After SERVICE_B_BREAKER_COOLDOWN a single probe is let through:
+// the breaker closes if it succeeds and opens again if it fails.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+var serviceBBreaker = &circuitBreaker{state: breakerClosed}
+
+// allow reports whether a call may go ahead, and the state of the breaker it
+// goes ahead in. Only one call at a time is let through half open.
+func (b *circuitBreaker) allow() (string, bool) {
+	if cfg.ServiceBBreakerThreshold == 0 {
+		return breakerClosed, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if shared.Since(b.openedAt) < cfg.ServiceBBreakerCooldown {
+			return breakerOpen, false
+		}
+		b.state = breakerHalfOpen
+		return breakerHalfOpen, true
+	case breakerHalfOpen:
+		// The probe is still in flight
+		return breakerHalfOpen, false
+	}
+	return breakerClosed, true
+}
+
+// record reports the outcome of a call allow let through. A cancelled call
+// leaves the failure count alone; when it was the probe, the breaker opens
+// again so the next call probes instead.
+func (b *circuitBreaker) record(outcome callOutcome) {
+	if cfg.ServiceBBreakerThreshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch outcome {
+	case callSucceeded:
+		b.state, b.failures = breakerClosed, 0
+		return
+	case callCancelled:
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= cfg.ServiceBBreakerThreshold {
+		b.state, b.openedAt = breakerOpen, shared.Now()
+	}
+}
+
+// retryAfter returns how long until the open breaker lets a probe through.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(cfg.ServiceBBreakerCooldown-shared.Since(b.openedAt), 0)
+}
@@ -0,0 +1,83 @@
+package servicea
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shared"
+	"shared/sharedtest"
+)
+
+func TestErrorBudgetWindows(t *testing.T) {
+	setupTestService(t, "http://localhost:8081")
+	fake := sharedtest.UseFakeClock(t)
+	cfg.SLOAvailabilityTarget = 0.99
+	cfg.SLOBurnWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+	errorBudget = shared.NewErrorBudgetTracker(cfg.SLO())
+	handler := errorBudget.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	serve := func(path string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	serve("/fail")
+	fake.Advance(10 * time.Minute)
+	serve("/ok")
+	serve("/fail")
+
+	rates := errorBudget.BurnRates(fake.Now())
+	if got := rates["5m0s"]; got.Requests != 2 || got.ErrorRate != 0.5 {
+		t.Errorf("5m window = %+v, want 2 requests at a 0.5 error rate", got)
+	}
+	if got := rates["1h0m0s"]; got.Requests != 3 || got.BurnRate < 66 || got.BurnRate > 67 {
+		t.Errorf("1h window = %+v, want 3 requests burning about 66.7x", got)
+	}
+
+	// Once the hour has passed, the first failure leaves the longest window
+	fake.Advance(55 * time.Minute)
+	if got := errorBudget.BurnRates(fake.Now())["1h0m0s"]; got.Requests != 2 {
+		t.Errorf("1h window after 65m = %d requests, want 2", got.Requests)
+	}
+}
+
+func TestBreakerCooldown(t *testing.T) {
+	setupTestService(t, "http://localhost:8081")
+	fake := sharedtest.UseFakeClock(t)
+	cfg.ServiceBBreakerThreshold = 2
+	cfg.ServiceBBreakerCooldown = 30 * time.Second
+
+	breaker := &circuitBreaker{state: breakerClosed}
+	for i := 0; i < 2; i++ {
+		breaker.allow()
+		breaker.record(callFailed)
+	}
+	if state, ok := breaker.allow(); ok || state != breakerOpen {
+		t.Fatalf("allow after 2 failures = %q, %v; want open, false", state, ok)
+	}
+
+	fake.Advance(10 * time.Second)
+	if got := breaker.retryAfter(); got != 20*time.Second {
+		t.Errorf("retryAfter 10s into the cooldown = %v, want 20s", got)
+	}
+	if _, ok := breaker.allow(); ok {
+		t.Fatal("allow 10s into the cooldown let the call through")
+	}
+
+	fake.Advance(20 * time.Second)
+	if state, ok := breaker.allow(); !ok || state != breakerHalfOpen {
+		t.Fatalf("allow after the cooldown = %q, %v; want half_open, true", state, ok)
+	}
+	if _, ok := breaker.allow(); ok {
+		t.Error("allow let a second probe through while half open")
+	}
+	breaker.record(callSucceeded)
+	if state, ok := breaker.allow(); !ok || state != breakerClosed {
+		t.Errorf("allow after a successful probe = %q, %v; want closed, true", state, ok)
+	}
+}
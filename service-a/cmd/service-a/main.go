@@ -0,0 +1,8 @@
+// Command service-a runs Service A on its own.
+package main
+
+import servicea "service-a"
+
+func main() {
+	servicea.Main()
+}
@@ -0,0 +1,628 @@
+package servicea
+
+import (
+	"compress/gzip"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared"
+)
+
+const (
+	routeNormalizationRewrite  = "rewrite"
+	routeNormalizationRedirect = "redirect"
+	routeNormalizationOff      = "off"
+)
+
+// Config holds the runtime configuration of Service A, loaded once at startup.
+type Config struct {
+	SLOLatency                time.Duration
+	SLOLatencyOverrides       map[string]time.Duration
+	AllowDefaultCEP           bool
+	DefaultCEP                string
+	RouteNormalization        string
+	HandlerTimeout            time.Duration
+	EnvelopeResponses         bool
+	PrettyJSON                bool
+	TrustIncomingTraceContext bool
+	EnableDebugEndpoints      bool
+	ChaosEnabled              bool
+	ChaosFailureRate          float64
+	ChaosLatency              time.Duration
+	ServiceBURL               string
+	DrainTimeout              time.Duration
+	OTelOptional              bool
+	EndpointTimeouts          map[string]time.Duration
+	RequestBudget             time.Duration
+	ForwardHeaders            []string
+	SLOAvailabilityTarget     float64
+	SLOBurnWindows            []time.Duration
+	SLOBurnRateThreshold      float64
+	TracesExporters           []string
+	MinRequestTimeout         time.Duration
+	MaxRequestTimeout         time.Duration
+	MinHTTPMajor              int
+	MinHTTPMinor              int
+	GzipLevel                 int
+	PodName                   string
+	TraceHeaders              bool
+	TraceHeadersAllowlist     []string
+	StrictJSON                bool
+	EnablePprof               bool
+	PprofAddr                 string
+	WriteTimeout              time.Duration
+	OTLPInsecure              bool
+	OTLPCertificate           string
+	OTLPRootCAs               *x509.CertPool
+	RequestIDFormat           string
+	RequireSampledTrace       bool
+	DeployEnv                 string
+	LogLevel                  slog.Level
+	TracesSampleRatio         float64
+	ServiceBBreakerThreshold  int
+	ServiceBBreakerCooldown   time.Duration
+	SetGlobalOTel             bool
+	RetryAfterJitter          time.Duration
+}
+
+var cfg *Config
+
+func loadConfig() (*Config, error) {
+	sloLatency, err := getEnvMillis("SLO_LATENCY_MS", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	sloOverrides, err := getEnvMillisMap("SLO_LATENCY_OVERRIDES")
+	if err != nil {
+		return nil, err
+	}
+
+	allowDefaultCEP, err := getEnvBool("ALLOW_DEFAULT_CEP", false)
+	if err != nil {
+		return nil, err
+	}
+	defaultCEP := os.Getenv("DEFAULT_CEP")
+	if allowDefaultCEP {
+		normalized, ok := normalizeCEP(defaultCEP)
+		if !ok {
+			return nil, fmt.Errorf("DEFAULT_CEP %q is not a valid CEP (required when ALLOW_DEFAULT_CEP=true)", defaultCEP)
+		}
+		defaultCEP = normalized
+	}
+
+	routeNormalization := os.Getenv("ROUTE_NORMALIZATION")
+	switch routeNormalization {
+	case "":
+		routeNormalization = routeNormalizationRewrite
+	case routeNormalizationRewrite, routeNormalizationRedirect, routeNormalizationOff:
+	default:
+		return nil, fmt.Errorf("invalid ROUTE_NORMALIZATION %q: must be rewrite, redirect or off", routeNormalization)
+	}
+
+	handlerTimeout, err := getEnvDuration("HANDLER_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if handlerTimeout < 0 {
+		return nil, fmt.Errorf("HANDLER_TIMEOUT must not be negative, got %s", handlerTimeout)
+	}
+
+	envelopeResponses, err := getEnvBool("ENVELOPE_RESPONSES", false)
+	if err != nil {
+		return nil, err
+	}
+
+	prettyJSON, err := getEnvBool("PRETTY_JSON", false)
+	if err != nil {
+		return nil, err
+	}
+
+	trustIncomingTraceContext, err := getEnvBool("TRUST_INCOMING_TRACE_CONTEXT", true)
+	if err != nil {
+		return nil, err
+	}
+
+	enableDebugEndpoints, err := getEnvBool("ENABLE_DEBUG_ENDPOINTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	chaosEnabled, err := getEnvBool("CHAOS_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	chaosFailureRate, err := getEnvFloat("CHAOS_FAILURE_RATE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if chaosFailureRate < 0 || chaosFailureRate > 1 {
+		return nil, fmt.Errorf("CHAOS_FAILURE_RATE must be between 0.0 and 1.0, got %g", chaosFailureRate)
+	}
+	chaosLatency, err := getEnvMillis("CHAOS_LATENCY_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if !chaosEnabled && (chaosFailureRate > 0 || chaosLatency > 0) {
+		log.Printf("Ignoring CHAOS_FAILURE_RATE and CHAOS_LATENCY_MS: failure injection requires CHAOS_ENABLED=true")
+		chaosFailureRate, chaosLatency = 0, 0
+	}
+
+	serviceBURL := strings.TrimRight(os.Getenv("SERVICE_B_URL"), "/")
+	if serviceBURL == "" {
+		serviceBURL = "http://localhost:8081"
+	}
+	parsedServiceBURL, err := url.Parse(serviceBURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVICE_B_URL %q: %w", serviceBURL, err)
+	}
+	if (parsedServiceBURL.Scheme != "http" && parsedServiceBURL.Scheme != "https") || parsedServiceBURL.Host == "" {
+		return nil, fmt.Errorf("invalid SERVICE_B_URL %q: must be an absolute http(s) URL such as http://service-b:8081", serviceBURL)
+	}
+
+	drainTimeout, err := getEnvDuration("DRAIN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	otelOptional, err := getEnvBool("OTEL_OPTIONAL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointTimeouts, err := getEnvDurationMap("ENDPOINT_TIMEOUTS")
+	if err != nil {
+		return nil, err
+	}
+
+	requestBudget, err := getEnvDuration("REQUEST_BUDGET", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	var forwardHeaders []string
+	for _, name := range getEnvList("FORWARD_HEADERS") {
+		forwardHeaders = append(forwardHeaders, http.CanonicalHeaderKey(name))
+	}
+
+	sloAvailabilityTarget, err := getEnvFloat("SLO_AVAILABILITY_TARGET", 0.999)
+	if err != nil {
+		return nil, err
+	}
+	if sloAvailabilityTarget <= 0 || sloAvailabilityTarget >= 1 {
+		return nil, fmt.Errorf("SLO_AVAILABILITY_TARGET must be between 0.0 and 1.0 (exclusive), got %g", sloAvailabilityTarget)
+	}
+
+	sloBurnWindows := []time.Duration{5 * time.Minute, time.Hour}
+	if windows := getEnvList("SLO_BURN_WINDOWS"); len(windows) > 0 {
+		sloBurnWindows = nil
+		for _, value := range windows {
+			window, err := time.ParseDuration(value)
+			if err != nil || window < shared.BurnBucketWidth {
+				return nil, fmt.Errorf("invalid SLO_BURN_WINDOWS entry %q: must be a duration of at least %s", value, shared.BurnBucketWidth)
+			}
+			sloBurnWindows = append(sloBurnWindows, window)
+		}
+	}
+
+	sloBurnRateThreshold, err := getEnvFloat("SLO_BURN_RATE_THRESHOLD", 14.4)
+	if err != nil {
+		return nil, err
+	}
+
+	tracesExporters := getEnvList("OTEL_TRACES_EXPORTER")
+	if len(tracesExporters) == 0 {
+		tracesExporters = []string{"otlp"}
+	}
+	for _, name := range tracesExporters {
+		if !traceExporterNames[name] {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER entry %q: must be otlp, zipkin or console", name)
+		}
+	}
+
+	minRequestTimeout, err := getEnvDuration("MIN_REQUEST_TIMEOUT", 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	maxRequestTimeout, err := getEnvDuration("MAX_REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if minRequestTimeout <= 0 || minRequestTimeout > maxRequestTimeout {
+		return nil, fmt.Errorf("MIN_REQUEST_TIMEOUT must be positive and at most MAX_REQUEST_TIMEOUT, got %s and %s", minRequestTimeout, maxRequestTimeout)
+	}
+
+	minHTTPMajor, minHTTPMinor := 0, 0
+	if value := os.Getenv("MIN_HTTP_VERSION"); value != "" {
+		var ok bool
+		if minHTTPMajor, minHTTPMinor, ok = http.ParseHTTPVersion("HTTP/" + value); !ok {
+			return nil, fmt.Errorf("invalid MIN_HTTP_VERSION %q: must be a version like 1.1", value)
+		}
+	}
+
+	// An invalid level only costs efficiency, so it falls back instead of failing
+	gzipLevel, err := getEnvInt("GZIP_LEVEL", shared.DefaultGzipLevel)
+	if err != nil || gzipLevel < gzip.BestSpeed || gzipLevel > gzip.BestCompression {
+		slog.Warn("invalid GZIP_LEVEL, using the default", "value", os.Getenv("GZIP_LEVEL"), "default", shared.DefaultGzipLevel)
+		gzipLevel = shared.DefaultGzipLevel
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName = os.Getenv("HOSTNAME")
+	}
+
+	traceHeaders, err := getEnvBool("TRACE_HEADERS", false)
+	if err != nil {
+		return nil, err
+	}
+	traceHeadersAllowlist := shared.DefaultTraceHeaders
+	if names := getEnvList("TRACE_HEADERS_ALLOWLIST"); len(names) > 0 {
+		traceHeadersAllowlist = nil
+		for _, name := range names {
+			traceHeadersAllowlist = append(traceHeadersAllowlist, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	strictJSON, err := getEnvBool("STRICT_JSON", false)
+	if err != nil {
+		return nil, err
+	}
+
+	enablePprof, err := getEnvBool("ENABLE_PPROF", false)
+	if err != nil {
+		return nil, err
+	}
+	pprofAddr := os.Getenv("PPROF_ADDR")
+	if pprofAddr == "" {
+		pprofAddr = "localhost:6060"
+	}
+
+	writeTimeout, err := getEnvDuration("WRITE_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if writeTimeout <= 0 {
+		return nil, fmt.Errorf("WRITE_TIMEOUT must be positive, got %s", writeTimeout)
+	}
+	// The handler timeout's 503 could never be written otherwise
+	if handlerTimeout > 0 && writeTimeout <= handlerTimeout {
+		return nil, fmt.Errorf("WRITE_TIMEOUT must be longer than HANDLER_TIMEOUT, got %s and %s", writeTimeout, handlerTimeout)
+	}
+
+	// A collector reached over https:// is expected to speak TLS
+	otlpInsecure, err := getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", !strings.HasPrefix(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "https://"))
+	if err != nil {
+		return nil, err
+	}
+	otlpCertificate := os.Getenv("OTEL_EXPORTER_OTLP_CERTIFICATE")
+	var otlpRootCAs *x509.CertPool
+	if otlpCertificate != "" {
+		if otlpInsecure {
+			return nil, errors.New("OTEL_EXPORTER_OTLP_CERTIFICATE requires OTEL_EXPORTER_OTLP_INSECURE=false")
+		}
+		if otlpRootCAs, err = shared.LoadOTLPCertificate(otlpCertificate); err != nil {
+			return nil, err
+		}
+	}
+
+	requestIDFormat := os.Getenv("REQUEST_ID_FORMAT")
+	switch requestIDFormat {
+	case "":
+		requestIDFormat = shared.RequestIDFormatUUID
+	case shared.RequestIDFormatUUID, shared.RequestIDFormatULID, shared.RequestIDFormatTrace:
+	default:
+		return nil, fmt.Errorf("invalid REQUEST_ID_FORMAT %q: must be uuid, ulid or trace", requestIDFormat)
+	}
+
+	requireSampledTrace, err := getEnvBool("REQUIRE_SAMPLED_TRACE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	deployEnv, preset, err := shared.LoadDeployPreset()
+	if err != nil {
+		return nil, err
+	}
+	logLevel := preset.LogLevel
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := logLevel.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be DEBUG, INFO, WARN or ERROR", value)
+		}
+	}
+
+	tracesSampleRatio, err := getEnvFloat("TRACES_SAMPLE_RATIO", preset.TracesSampleRatio)
+	if err != nil {
+		return nil, err
+	}
+	if tracesSampleRatio < 0 || tracesSampleRatio > 1 {
+		return nil, fmt.Errorf("TRACES_SAMPLE_RATIO must be between 0.0 and 1.0, got %g", tracesSampleRatio)
+	}
+
+	serviceBBreakerThreshold, err := getEnvInt("SERVICE_B_BREAKER_THRESHOLD", 5)
+	if err != nil {
+		return nil, err
+	}
+	if serviceBBreakerThreshold < 0 {
+		return nil, fmt.Errorf("SERVICE_B_BREAKER_THRESHOLD must not be negative, got %d", serviceBBreakerThreshold)
+	}
+	serviceBBreakerCooldown, err := getEnvDuration("SERVICE_B_BREAKER_COOLDOWN", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if serviceBBreakerCooldown <= 0 {
+		return nil, fmt.Errorf("SERVICE_B_BREAKER_COOLDOWN must be positive, got %s", serviceBBreakerCooldown)
+	}
+
+	setGlobalOTel, err := getEnvBool("SET_GLOBAL_OTEL", true)
+	if err != nil {
+		return nil, err
+	}
+
+	retryAfterJitter, err := getEnvDuration("RETRY_AFTER_JITTER", 0)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfterJitter < 0 {
+		return nil, fmt.Errorf("RETRY_AFTER_JITTER must not be negative, got %s", retryAfterJitter)
+	}
+
+	return &Config{
+		SLOLatency:                sloLatency,
+		SLOLatencyOverrides:       sloOverrides,
+		AllowDefaultCEP:           allowDefaultCEP,
+		DefaultCEP:                defaultCEP,
+		RouteNormalization:        routeNormalization,
+		HandlerTimeout:            handlerTimeout,
+		EnvelopeResponses:         envelopeResponses,
+		PrettyJSON:                prettyJSON,
+		TrustIncomingTraceContext: trustIncomingTraceContext,
+		EnableDebugEndpoints:      enableDebugEndpoints,
+		ChaosEnabled:              chaosEnabled,
+		ChaosFailureRate:          chaosFailureRate,
+		ChaosLatency:              chaosLatency,
+		ServiceBURL:               serviceBURL,
+		DrainTimeout:              drainTimeout,
+		OTelOptional:              otelOptional,
+		EndpointTimeouts:          endpointTimeouts,
+		RequestBudget:             requestBudget,
+		ForwardHeaders:            forwardHeaders,
+		SLOAvailabilityTarget:     sloAvailabilityTarget,
+		SLOBurnWindows:            sloBurnWindows,
+		SLOBurnRateThreshold:      sloBurnRateThreshold,
+		TracesExporters:           tracesExporters,
+		MinRequestTimeout:         minRequestTimeout,
+		MaxRequestTimeout:         maxRequestTimeout,
+		MinHTTPMajor:              minHTTPMajor,
+		MinHTTPMinor:              minHTTPMinor,
+		GzipLevel:                 gzipLevel,
+		PodName:                   podName,
+		TraceHeaders:              traceHeaders,
+		TraceHeadersAllowlist:     traceHeadersAllowlist,
+		StrictJSON:                strictJSON,
+		EnablePprof:               enablePprof,
+		PprofAddr:                 pprofAddr,
+		WriteTimeout:              writeTimeout,
+		OTLPInsecure:              otlpInsecure,
+		OTLPCertificate:           otlpCertificate,
+		OTLPRootCAs:               otlpRootCAs,
+		RequestIDFormat:           requestIDFormat,
+		RequireSampledTrace:       requireSampledTrace,
+		DeployEnv:                 deployEnv,
+		LogLevel:                  logLevel,
+		TracesSampleRatio:         tracesSampleRatio,
+		ServiceBBreakerThreshold:  serviceBBreakerThreshold,
+		ServiceBBreakerCooldown:   serviceBBreakerCooldown,
+		SetGlobalOTel:             setGlobalOTel,
+		RetryAfterJitter:          retryAfterJitter,
+	}, nil
+}
+
+// logEffective logs the configuration the process runs with as a single
+// SLO returns the availability objective set by the SLO_* variables.
+func (c *Config) SLO() shared.SLO {
+	return shared.SLO{
+		AvailabilityTarget: c.SLOAvailabilityTarget,
+		BurnWindows:        c.SLOBurnWindows,
+		BurnRateThreshold:  c.SLOBurnRateThreshold,
+	}
+}
+
+// structured line.
+func (c *Config) logEffective(listenAddr string) {
+	slog.Info("effective configuration",
+		"listen_addr", listenAddr,
+		"service_b_url", c.ServiceBURL,
+		"otlp_endpoint", otlpEndpoint(),
+		"traces_sampler", tracesSampler(),
+		"handler_timeout", c.HandlerTimeout,
+		"slo_latency", c.SLOLatency,
+		"slo_latency_overrides", c.SLOLatencyOverrides,
+		"allow_default_cep", c.AllowDefaultCEP,
+		"default_cep", c.DefaultCEP,
+		"trust_incoming_trace_context", c.TrustIncomingTraceContext,
+		"route_normalization", c.RouteNormalization,
+		"envelope_responses", c.EnvelopeResponses,
+		"pretty_json", c.PrettyJSON,
+		"enable_debug_endpoints", c.EnableDebugEndpoints,
+		"chaos_enabled", c.ChaosEnabled,
+		"chaos_failure_rate", c.ChaosFailureRate,
+		"chaos_latency", c.ChaosLatency,
+		"drain_timeout", c.DrainTimeout,
+		"otel_optional", c.OTelOptional,
+		"endpoint_timeouts", c.EndpointTimeouts,
+		"request_budget", c.RequestBudget,
+		"forward_headers", c.ForwardHeaders,
+		"slo_availability_target", c.SLOAvailabilityTarget,
+		"slo_burn_windows", c.SLOBurnWindows,
+		"slo_burn_rate_threshold", c.SLOBurnRateThreshold,
+		"traces_exporters", c.TracesExporters,
+		"min_request_timeout", c.MinRequestTimeout,
+		"max_request_timeout", c.MaxRequestTimeout,
+		"min_http_version", fmt.Sprintf("%d.%d", c.MinHTTPMajor, c.MinHTTPMinor),
+		"gzip_level", c.GzipLevel,
+		"pod_name", c.PodName,
+		"trace_headers", c.TraceHeaders,
+		"strict_json", c.StrictJSON,
+		"enable_pprof", c.EnablePprof,
+		"pprof_addr", c.PprofAddr,
+		"write_timeout", c.WriteTimeout,
+		"otlp_insecure", c.OTLPInsecure,
+		"otlp_certificate", c.OTLPCertificate,
+		"request_id_format", c.RequestIDFormat,
+		"require_sampled_trace", c.RequireSampledTrace,
+		"deploy_env", c.DeployEnv,
+		"log_level", c.LogLevel,
+		"service_b_breaker_threshold", c.ServiceBBreakerThreshold,
+		"service_b_breaker_cooldown", c.ServiceBBreakerCooldown,
+		"set_global_otel", c.SetGlobalOTel,
+		"retry_after_jitter", c.RetryAfterJitter,
+	)
+}
+
+// tracesSampler describes the sampler the tracer provider picks up from the
+// standard OTEL_TRACES_SAMPLER(_ARG) variables, unless TRACES_SAMPLE_RATIO
+// selects a parent-based ratio sampler.
+func tracesSampler() string {
+	if cfg.TracesSampleRatio < 1 {
+		return fmt.Sprintf("parentbased_traceidratio:%g", cfg.TracesSampleRatio)
+	}
+	sampler := os.Getenv("OTEL_TRACES_SAMPLER")
+	if sampler == "" {
+		return "parentbased_always_on"
+	}
+	if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		return sampler + ":" + arg
+	}
+	return sampler
+}
+
+// getEnvList parses a comma-separated list, ignoring empty items.
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return b, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return d, nil
+}
+
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return f, nil
+}
+
+func getEnvMillis(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative number of milliseconds", key, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// getEnvMillisMap parses a "key=ms,key=ms" list, e.g. "/cep=3000,/health=100".
+func getEnvMillisMap(key string) (map[string]time.Duration, error) {
+	pairs, err := parseKeyValueList(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	result := make(map[string]time.Duration, len(pairs))
+	for k, v := range pairs {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q: must be a non-negative number of milliseconds", key, k)
+		}
+		result[k] = time.Duration(ms) * time.Millisecond
+	}
+	return result, nil
+}
+
+// getEnvDurationMap parses a "key=duration,key=duration" list, e.g.
+// "/weather=10s,/health=500ms".
+func getEnvDurationMap(key string) (map[string]time.Duration, error) {
+	pairs, err := parseKeyValueList(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	result := make(map[string]time.Duration, len(pairs))
+	for k, v := range pairs {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q: must be a non-negative duration such as 10s", key, k)
+		}
+		result[k] = d
+	}
+	return result, nil
+}
+
+func parseKeyValueList(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("malformed entry %q, expected key=value", item)
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
@@ -0,0 +1,14 @@
+package servicea
+
+import "net/http"
+
+// routes are the patterns registered by handleRoute, listed by handleRoot.
+var routes []string
+
+// handleRoute registers handler for pattern on mux and records it for the
+// landing response, so that lists exactly the endpoints served. Every route
+// also answers OPTIONS with its description.
+func handleRoute(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	mux.HandleFunc(pattern, describeRoute(pattern, handler))
+	routes = append(routes, pattern)
+}
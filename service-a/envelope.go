@@ -0,0 +1,64 @@
+package servicea
+
+import "encoding/json"
+
+const (
+	envelopeStatusSuccess = "success"
+	envelopeStatusError   = "error"
+)
+
+// SuccessEnvelope wraps successful payloads when ENVELOPE_RESPONSES=true.
+type SuccessEnvelope struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// ErrorEnvelope wraps error responses when ENVELOPE_RESPONSES=true.
+type ErrorEnvelope struct {
+	Status string        `json:"status"`
+	Error  ErrorResponse `json:"error"`
+}
+
+// errorBody returns the body of an error response, enveloped when configured.
+func errorBody(code, message, traceparent string) interface{} {
+	response := ErrorResponse{Code: code, Message: message, Trace: traceparent}
+	if cfg.EnvelopeResponses {
+		return ErrorEnvelope{Status: envelopeStatusError, Error: response}
+	}
+	return response
+}
+
+// unwrapSuccess returns the payload of a Service B response, which may or may
+// not be enveloped depending on Service B's own ENVELOPE_RESPONSES.
+func unwrapSuccess(body []byte) []byte {
+	var envelope SuccessEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Status == envelopeStatusSuccess && envelope.Data != nil {
+		return append(envelope.Data, '\n')
+	}
+	return body
+}
+
+// wrapSuccess envelopes payload when ENVELOPE_RESPONSES=true.
+func wrapSuccess(payload []byte) ([]byte, error) {
+	if !cfg.EnvelopeResponses {
+		return payload, nil
+	}
+	body, err := json.Marshal(SuccessEnvelope{Status: envelopeStatusSuccess, Data: payload})
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// parseUpstreamError extracts the error of a Service B error response, enveloped or not.
+func parseUpstreamError(body []byte) (ErrorResponse, bool) {
+	var envelope ErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Status == envelopeStatusError {
+		return envelope.Error, envelope.Error.Message != ""
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ErrorResponse{}, false
+	}
+	return response, response.Message != ""
+}
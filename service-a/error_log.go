@@ -0,0 +1,86 @@
+package servicea
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recentErrorsSize is how many error responses /debug/errors keeps.
+const recentErrorsSize = 100
+
+// ErrorRecord is one error response we answered with.
+type ErrorRecord struct {
+	Time    time.Time `json:"time"`
+	Handler string    `json:"handler"`
+	Status  int       `json:"status"`
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	TraceID string    `json:"trace_id,omitempty"`
+}
+
+// errorRing holds the latest error records, overwriting the oldest.
+type errorRing struct {
+	mu      sync.Mutex
+	entries [recentErrorsSize]ErrorRecord
+	next    int
+	count   int
+}
+
+var recentErrors = &errorRing{}
+
+func (r *errorRing) add(record ErrorRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = record
+	r.next = (r.next + 1) % recentErrorsSize
+	r.count = min(r.count+1, recentErrorsSize)
+}
+
+// recent returns the records held, newest first.
+func (r *errorRing) recent() []ErrorRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]ErrorRecord, 0, r.count)
+	for i := 1; i <= r.count; i++ {
+		records = append(records, r.entries[(r.next-i+recentErrorsSize)%recentErrorsSize])
+	}
+	return records
+}
+
+// recordError keeps an error response for /debug/errors, when debug endpoints
+// are enabled, by request path.
+func recordError(r *http.Request, code, message string, statusCode int) {
+	if !cfg.EnableDebugEndpoints {
+		return
+	}
+	record := ErrorRecord{
+		Time:    time.Now(),
+		Handler: r.URL.Path,
+		Status:  statusCode,
+		Code:    code,
+		Message: message,
+	}
+	if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+		record.TraceID = spanContext.TraceID().String()
+	}
+	recentErrors.add(record)
+}
+
+// handleRecentErrors lists the latest error responses, newest first, for a
+// quick look at what is failing without reading the pod's logs.
+func handleRecentErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(recentErrors.recent()); err != nil {
+		log.Printf("Failed to encode recent errors response: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package servicea
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrIncompleteResponse is returned when Service B's response body could not
+// be read in full, e.g. because the connection closed mid-body.
+var ErrIncompleteResponse = errors.New("incomplete response from service b")
+
+// upstreamErrorCode is used when an error response from Service B cannot be parsed.
+const upstreamErrorCode = "upstream_error"
+
+// errorCodes maps the messages of our error responses to their codes. Errors
+// forwarded from Service B keep the code Service B assigned them.
+var errorCodes = map[string]string{
+	"invalid request body":               "invalid_request_body",
+	"invalid delay":                      "invalid_delay",
+	"invalid zipcode":                    "invalid_zipcode",
+	"too many ceps":                      "too_many_ceps",
+	"http version not supported":         "http_version_not_supported",
+	"unsupported media type":             "unsupported_media_type",
+	"request timed out":                  "handler_timeout",
+	"chaos failure injected":             "chaos_injected",
+	"service b timed out":                "upstream_timeout",
+	"service b unavailable":              "upstream_unavailable",
+	"service b circuit open":             "upstream_circuit_open",
+	"incomplete response from service b": "upstream_incomplete_response",
+	"sampled trace context required":     "trace_context_required",
+	"internal server error":              "internal_error",
+}
+
+// errorCode returns the stable, machine-readable code for a client-facing error
+// message, falling back to the snake-cased status text for unlisted messages.
+func errorCode(message string, statusCode int) string {
+	if code, ok := errorCodes[message]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
+
+// traceParent returns the W3C traceparent of the span in ctx, or "" when there
+// is no valid span.
+func traceParent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
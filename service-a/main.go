@@ -1,25 +1,37 @@
-package main
+package servicea
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	"unicode"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"shared"
 )
 
 type CEPRequest struct {
@@ -27,74 +39,211 @@ type CEPRequest struct {
 }
 
 type ErrorResponse struct {
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
+
+	// W3C traceparent of the request, when it is traced
+	Trace string `json:"trace,omitempty"`
 }
 
+// maxWrappedErrorLength bounds the plain-text upstream error kept as a message.
+const maxWrappedErrorLength = 200
+
 var tracer trace.Tracer
 
-func main() {
+// tracerProvider is handed explicitly to the instrumentation, so the global
+// one is only set with SET_GLOBAL_OTEL=true.
+var tracerProvider trace.TracerProvider = tracenoop.NewTracerProvider()
+
+// serviceBClient is shared by every request so connections to Service B are
+// reused.
+var serviceBClient *http.Client
+
+// ownTelemetry is false when Service A shares the process with Service B, whose
+// tracer and meter providers it then uses as the global ones instead of
+// setting up its own.
+var ownTelemetry = true
+
+// errorBudget tracks the SLO burn rate, against the SLO_* variables.
+var errorBudget *shared.ErrorBudgetTracker
+
+// inFlight tracks the requests being served, for draining on shutdown.
+var inFlight = shared.NewInFlightRequests()
+
+// Main runs Service A on port 8080 until it is told to stop, then drains it.
+func Main() {
+	// Load configuration
+	var err error
+	cfg, err = loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg.logEffective(":8080")
+	if ownTelemetry {
+		initLogLevel()
+		shared.LogDeployPreset(cfg.DeployEnv)
+	}
+
 	// Initialize OpenTelemetry
 	ctx := context.Background()
-	shutdown, err := initTracer(ctx)
+	tp, shutdown, err := initTracer(ctx)
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
 	defer shutdown()
+	if tp != nil {
+		tracerProvider = tp
+	}
 
-	tracer = otel.Tracer("service-a")
+	shutdownMeter, err := initMeter(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer shutdownMeter()
+
+	tracer = tracerProvider.Tracer("service-a")
+	serviceBClient = &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithTracerProvider(tracerProvider), otelhttp.WithPropagators(propagation.TraceContext{})),
+		Timeout:   30 * time.Second,
+	}
+	if err := initMetrics(); err != nil {
+		log.Fatalf("Failed to create metrics: %v", err)
+	}
+	errorBudget = shared.NewErrorBudgetTracker(cfg.SLO())
+	go errorBudget.Monitor(ctx)
 
 	// Setup HTTP server with OpenTelemetry instrumentation
 	mux := http.NewServeMux()
-	mux.HandleFunc("/cep", handleCEP)
-	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/", describeRoute("/", handleRoot))
+	handleRoute(mux, "/cep", handleCEP)
+	handleRoute(mux, "/cep/search", handleCEPSearch)
+	handleRoute(mux, "/validate", handleValidate)
+	handleRoute(mux, "/health", handleHealth)
+	handleRoute(mux, "/metrics", promhttp.Handler().ServeHTTP)
+	if cfg.EnableDebugEndpoints {
+		handleRoute(mux, "/stats", handleStats)
+		handleRoute(mux, "/debug/flush", handleFlush)
+		handleRoute(mux, "/debug/errors", handleRecentErrors)
+	}
+
+	// /debug/slow, whose delay is deliberate, is served outside the
+	// per-request middlewares below
+	unbounded := http.NewServeMux()
+	if cfg.EnableDebugEndpoints {
+		handleRoute(unbounded, "/debug/slow", shared.SlowHandler(tracer, writeErrorResponse))
+	}
+
+	// Count requests for /stats when debug endpoints are enabled and for the SLO
+	// burn rate, and track the ones in flight for draining on shutdown
+	var routed http.Handler = sloLatency(requireJSON(requestBudget(requestTimeoutOverride(handlerTimeout(injectChaos(mux))))))
+	routed = routeUnbounded(unbounded, routed)
+	if cfg.EnableDebugEndpoints {
+		routed = stats.Collect(mux, routed)
+	}
+	routed = errorBudget.Track(routed)
+	routed = inFlight.Track(mux, routed)
+	routed = tagPodName(routed)
+	if cfg.TraceHeaders {
+		routed = shared.TraceHeaders(cfg.TraceHeadersAllowlist, routed)
+	}
 
-	// Wrap the handler with OpenTelemetry instrumentation
-	handler := otelhttp.NewHandler(mux, "service-a")
+	// Wrap the handler with OpenTelemetry instrumentation; requests are server spans.
+	// Untrusted inbound trace context is not extracted at all, so the request
+	// starts a new trace that neither follows nor links to the claimed one.
+	var inbound propagation.TextMapPropagator = propagation.TraceContext{}
+	if !cfg.TrustIncomingTraceContext {
+		inbound = propagation.NewCompositeTextMapPropagator()
+	}
+	otelOptions := []otelhttp.Option{
+		otelhttp.WithSpanOptions(trace.WithSpanKind(trace.SpanKindServer)),
+		otelhttp.WithTracerProvider(tracerProvider),
+		otelhttp.WithPropagators(inbound),
+	}
+	handler := otelhttp.NewHandler(detectWriteTimeouts(shared.AssignRequestID(cfg.RequestIDFormat, auditTraceContext(traceResponse(requireSampledTrace(requireHTTPVersion(shared.CompressResponses(cfg.GzipLevel, prettyPrint(normalizeRoutes(mux, routed))))))))), "service-a", otelOptions...)
+
+	if cfg.EnablePprof {
+		pprofServer, err := shared.StartPprofServer(cfg.PprofAddr)
+		if err != nil {
+			log.Fatalf("Failed to start pprof server: %v", err)
+		}
+		defer pprofServer.Close()
+		log.Printf("Service A serving pprof on %s...", cfg.PprofAddr)
+	}
 
 	log.Println("Service A starting on port 8080...")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	inFlight.Serve(&http.Server{Addr: ":8080", Handler: handler, WriteTimeout: cfg.WriteTimeout}, cfg.DrainTimeout)
+}
+
+// MainSharingTelemetry runs Service A like Main, but on the global tracer and
+// meter providers another service of the process sets up.
+func MainSharingTelemetry() {
+	ownTelemetry = false
+	tracerProvider = otel.GetTracerProvider()
+	Main()
+}
+
+// initLogLevel applies LOG_LEVEL to slog. Its default handler, which keeps the
+// log package's format, only logs INFO and up, so other levels swap in a text
+// handler on stderr.
+func initLogLevel() {
+	if cfg.LogLevel != slog.LevelInfo {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})))
 	}
 }
 
-func initTracer(ctx context.Context) (func(), error) {
-	// Get OTLP endpoint from environment variable
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4317"
+// initTracer builds the tracer provider, nil when no exporter could be
+// created, and sets it as the global one unless SET_GLOBAL_OTEL=false.
+func initTracer(ctx context.Context) (*sdktrace.TracerProvider, func(), error) {
+	if !ownTelemetry {
+		return nil, func() {}, nil
 	}
 
-	// Create OTLP trace exporter
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(otlpEndpoint),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	// Create one trace exporter per OTEL_TRACES_EXPORTER entry, e.g. to send
+	// spans to two backends during a migration
+	var exporters []sdktrace.SpanExporter
+	for _, name := range cfg.TracesExporters {
+		exporter, err := newTraceExporter(ctx, name)
+		if err != nil {
+			if cfg.OTelOptional {
+				slog.Warn("continuing without trace exporter: failed to create it", "exporter", name, "error", err)
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to create %s trace exporter: %w", name, err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		slog.Warn("continuing without traces: no trace exporter could be created")
+		if cfg.SetGlobalOTel {
+			otel.SetTracerProvider(tracenoop.NewTracerProvider())
+		}
+		return nil, func() {}, nil
 	}
 
 	// Create resource
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("service-a"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+	res, err := newResource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, nil, err
 	}
 
-	// Create trace provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
+	// Create trace provider with a batcher per exporter; shutting it down
+	// flushes all of them
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	for _, exporter := range exporters {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	if cfg.TracesSampleRatio < 1 {
+		options = append(options, sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracesSampleRatio))))
+	}
+	tp := sdktrace.NewTracerProvider(options...)
 
 	// Set global trace provider
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if cfg.SetGlobalOTel {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	}
 
-	return func() {
+	return tp, func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := tp.Shutdown(ctx); err != nil {
@@ -103,10 +252,40 @@ func initTracer(ctx context.Context) (func(), error) {
 	}, nil
 }
 
+// otlpEndpoint returns the OTLP collector endpoint from the environment, as
+// host:port; an http:// or https:// scheme only sets the default of
+// OTEL_EXPORTER_OTLP_INSECURE.
+func otlpEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		return strings.TrimPrefix(endpoint, "https://")
+	}
+	return "localhost:4317"
+}
+
+func newResource(ctx context.Context) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName("service-a"),
+		semconv.ServiceVersion(serviceVersion),
+	}
+	if cfg.PodName != "" {
+		attrs = append(attrs, semconv.K8SPodName(cfg.PodName))
+	}
+	if cfg.DeployEnv != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.DeployEnv))
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
 func handleCEP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	span := trace.SpanFromContext(ctx)
 	span.SetName("handle-cep-request")
+	requestStart := time.Now()
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -114,83 +293,287 @@ func handleCEP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	var req CEPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	req, err := decodeCEPRequest(r)
+	switch {
+	case cfg.AllowDefaultCEP && (errors.Is(err, io.EOF) || (err == nil && req.CEP == "")):
+		// Development convenience: empty bodies fall back to DEFAULT_CEP
+		req.CEP = cfg.DefaultCEP
+		span.SetAttributes(attribute.Bool("default_cep_used", true))
+	case err != nil:
 		span.RecordError(err)
-		writeErrorResponse(w, "invalid request body", http.StatusBadRequest)
+		writeDecodeError(w, r, err)
 		return
 	}
 
-	// Validate CEP
-	if !isValidCEP(req.CEP) {
-		writeErrorResponse(w, "invalid zipcode", http.StatusUnprocessableEntity)
+	// Normalize and validate CEP
+	cep, ok := normalizeCEP(req.CEP)
+	if !ok {
+		recordCEPRejection(ctx, req.CEP)
+		writeErrorResponse(w, r, "invalid zipcode", http.StatusUnprocessableEntity)
 		return
 	}
+	recordCEPInputFormat(ctx, req.CEP)
+
+	// The first digit of a CEP identifies its postal region
+	cepRequestsCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("region", cep[:1])))
 
 	// Forward to Service B
-	if err := forwardToServiceB(ctx, req.CEP, w); err != nil {
+	// Pass through the options Service B understands
+	query := url.Values{}
+	for _, option := range []string{"includeMeta", "fullAddress", "alerts", "includeCoords", "includeMeasuredAt", "extended", "timings", "topology"} {
+		if r.URL.Query().Get(option) == "true" {
+			query.Set(option, "true")
+		}
+	}
+	for _, option := range []string{"date", "fields", "version"} {
+		if value := r.URL.Query().Get(option); value != "" {
+			query.Set(option, value)
+		}
+	}
+	var timings *requestTimings
+	breakdown, topology := r.URL.Query().Get("timings") == "true", r.URL.Query().Get("topology") == "true"
+	if breakdown || topology {
+		timings = &requestTimings{start: requestStart, breakdown: breakdown, topology: topology}
+	}
+	if err := forwardToServiceB(ctx, cep, query, forwardedHeaders(r), w, timings); err != nil {
 		span.RecordError(err)
 		log.Printf("Error forwarding to Service B: %v", err)
-		writeErrorResponse(w, "internal server error", http.StatusInternalServerError)
+		writeForwardError(w, r, err)
 		return
 	}
 }
 
+// normalizeCEP strips the separators users commonly paste along with a CEP
+// (dashes, dots and whitespace) and reports whether exactly 8 digits remain,
+// e.g. "01001-000", "01001.000" and "01001 000" all normalize to "01001000".
+func normalizeCEP(cep string) (string, bool) {
+	normalized := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == '.':
+			return -1
+		case unicode.IsSpace(r):
+			return -1
+		}
+		return r
+	}, cep)
+
+	if !isValidCEP(normalized) {
+		return "", false
+	}
+	return normalized, true
+}
+
+// cepPattern matches a normalized CEP: exactly 8 digits.
+var cepPattern = regexp.MustCompile(`^\d{8}$`)
+
 func isValidCEP(cep string) bool {
-	// Check if CEP is exactly 8 digits
-	matched, _ := regexp.MatchString(`^\d{8}$`, cep)
-	return matched
+	return cepPattern.MatchString(cep)
+}
+
+// forwardedHeaders returns the FORWARD_HEADERS the client sent, along with its
+// If-None-Match and Prefer, to be passed on to Service B as they are.
+func forwardedHeaders(r *http.Request) http.Header {
+	headers := http.Header{}
+	for _, name := range cfg.ForwardHeaders {
+		if values := r.Header.Values(name); len(values) > 0 {
+			headers[name] = values
+		}
+	}
+	// Service B keeps our request ID, so both log the same one
+	headers.Set(shared.RequestIDHeader, r.Header.Get(shared.RequestIDHeader))
+	// Conditional requests are answered by Service B, which owns the ETags
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		headers.Set("If-None-Match", ifNoneMatch)
+	}
+	// So is Prefer: forecast=Nd, which Service B answers with a forecast
+	if prefer := r.Header.Values("Prefer"); len(prefer) > 0 {
+		headers["Prefer"] = prefer
+	}
+	// So is the schema version, as Service B lays out the fields
+	if version := r.Header.Get("Accept-Version"); version != "" {
+		headers.Set("Accept-Version", version)
+	}
+	return headers
 }
 
-func forwardToServiceB(ctx context.Context, cep string, w http.ResponseWriter) error {
-	ctx, span := tracer.Start(ctx, "forward-to-service-b")
+// requestDeadlineHeader carries the milliseconds left before our own deadline
+// to Service B.
+const requestDeadlineHeader = "X-Request-Deadline"
+
+// forwardToServiceB relays the weather for cep from Service B, passing query
+// along. When timings is non-nil, Service B's processing breakdown is extended with ours.
+func forwardToServiceB(ctx context.Context, cep string, query url.Values, headers http.Header, w http.ResponseWriter, timings *requestTimings) error {
+	ctx, span := tracer.Start(ctx, "forward-to-service-b", trace.WithSpanKind(trace.SpanKindClient))
 	defer span.End()
 
-	serviceBURL := os.Getenv("SERVICE_B_URL")
-	if serviceBURL == "" {
-		serviceBURL = "http://localhost:8081"
+	target := "/weather"
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	resp, body, forwardDuration, err := callServiceB(ctx, target, CEPRequest{CEP: cep}, headers)
+	if resp != nil {
+		// Pass Service B's Server-Timing through, adding our own forward timing
+		serverTiming := append(resp.Header.Values("Server-Timing"),
+			fmt.Sprintf("forward;dur=%.1f", milliseconds(forwardDuration)))
+		w.Header().Set("Server-Timing", strings.Join(serverTiming, ", "))
 	}
-
-	// Create request payload
-	payload := CEPRequest{CEP: cep}
-	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return err
 	}
 
-	// Create HTTP client with OpenTelemetry instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   30 * time.Second,
+	// Error responses must follow our error schema even when Service B (or a
+	// proxy in front of it) answers with something that is not JSON
+	if resp.StatusCode >= http.StatusBadRequest {
+		forwardErrorResponse(w, resp, body)
+		return nil
 	}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", serviceBURL+"/weather", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Add("Vary", "Prefer")
+	if applied := resp.Header.Get("Preference-Applied"); applied != "" {
+		w.Header().Set("Preference-Applied", applied)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// Make request
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request to Service B: %w", err)
+	body = unwrapSuccess(body)
+	if timings != nil {
+		timings.forward = forwardDuration
+		if body, err = timings.addTo(body); err != nil {
+			return err
+		}
+	}
+	if body, err = wrapSuccess(body); err != nil {
+		return fmt.Errorf("failed to encode response envelope: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Copy response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(resp.StatusCode)
+	if _, err = w.Write(body); err != nil {
+		return fmt.Errorf("failed to write response body: %w", err)
+	}
+	return nil
+}
+
+// callServiceB POSTs payload as JSON to target on Service B, with headers and
+// our remaining deadline, through its circuit breaker. It reads the whole
+// body before returning, so a connection that closes mid-body is an
+// ErrIncompleteResponse instead of a truncated response; the response is
+// still returned then, with how long the call took.
+func callServiceB(ctx context.Context, target string, payload any, headers http.Header) (*http.Response, []byte, time.Duration, error) {
+	span := trace.SpanFromContext(ctx)
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.ServiceBURL+target, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Let Service B budget its upstream calls within the time we have left
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		req.Header.Set(requestDeadlineHeader, strconv.FormatInt(remaining, 10))
+		span.SetAttributes(attribute.Int64("request.deadline_remaining_ms", remaining))
+	}
+
+	// Fail fast while Service B is known to be down
+	state, ok := serviceBBreaker.allow()
+	span.SetAttributes(attribute.String("service_b.breaker.state", state))
+	if !ok {
+		return nil, nil, 0, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	resp, err := serviceBClient.Do(req)
+	if err != nil {
+		serviceBBreaker.record(serviceBOutcome(ctx, nil, err))
+		return nil, nil, 0, fmt.Errorf("failed to make request to Service B: %w", err)
+	}
+	defer resp.Body.Close()
+	duration := time.Since(start)
 
+	// Only once the body is read does the breaker learn how the call went
 	body, err := io.ReadAll(resp.Body)
+	serviceBBreaker.record(serviceBOutcome(ctx, resp, err))
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		span.SetAttributes(attribute.Int("response.bytes_read", len(body)))
+		return resp, nil, duration, fmt.Errorf("%w: %w", ErrIncompleteResponse, err)
 	}
+	return resp, body, duration, nil
+}
 
-	if _, err = w.Write(body); err != nil {
-		return fmt.Errorf("failed to write response body: %w", err)
+// serviceBOutcome tells whether a call to Service B counts against its
+// circuit breaker: it failed when Service B could not be reached, cut its
+// response short or answered with a 5xx. Calls cancelled by our own client
+// count neither way.
+func serviceBOutcome(ctx context.Context, resp *http.Response, err error) callOutcome {
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.Canceled):
+		return callCancelled
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		return callFailed
+	}
+	return callSucceeded
+}
+
+// writeForwardError answers a failed call to Service B: 504 when it timed out,
+// 502 when it could not be reached at all (unknown host, connection refused)
+// or its response was cut short, and 503 while its circuit breaker is open.
+func writeForwardError(w http.ResponseWriter, r *http.Request, err error) {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		shared.SetRetryAfter(w, r, serviceBBreaker.retryAfter(), cfg.RetryAfterJitter)
+		writeErrorResponse(w, r, "service b circuit open", http.StatusServiceUnavailable)
+	case errors.Is(err, ErrIncompleteResponse):
+		writeErrorResponse(w, r, "incomplete response from service b", http.StatusBadGateway)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		writeErrorResponse(w, r, "service b timed out", http.StatusGatewayTimeout)
+	case errors.As(err, &dnsErr), errors.Is(err, syscall.ECONNREFUSED):
+		writeErrorResponse(w, r, "service b unavailable", http.StatusBadGateway)
+	default:
+		writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
 	}
-	return nil
+}
+
+// forwardErrorResponse re-emits an error response from Service B, with body
+// already read, through our own error schema, preserving its status, code and
+// message. Bodies that are not a Service B error (e.g. plain text from a
+// proxy) get the upstream_error code.
+func forwardErrorResponse(w http.ResponseWriter, resp *http.Response, body []byte) {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+
+	// resp.Request carries our forward span, whose trace the client can continue
+	r := resp.Request
+	if upstream, ok := parseUpstreamError(body); ok {
+		code := upstream.Code
+		if code == "" {
+			code = errorCode(upstream.Message, resp.StatusCode)
+		}
+		writeCodedErrorResponse(w, r, code, upstream.Message, resp.StatusCode)
+		return
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" || len(message) > maxWrappedErrorLength || json.Valid(body) {
+		message = strings.ToLower(http.StatusText(resp.StatusCode))
+	}
+	writeCodedErrorResponse(w, r, upstreamErrorCode, message, resp.StatusCode)
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -201,12 +584,18 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
+	writeCodedErrorResponse(w, r, errorCode(message, statusCode), message, statusCode)
+}
+
+// writeCodedErrorResponse writes an error response, with the traceparent of the
+// request's span so clients that only parse the body can continue the trace.
+func writeCodedErrorResponse(w http.ResponseWriter, r *http.Request, code, message string, statusCode int) {
+	recordError(r, code, message, statusCode)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	response := ErrorResponse{Message: message}
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := json.NewEncoder(w).Encode(errorBody(code, message, traceParent(r.Context()))); err != nil {
 		log.Printf("Failed to encode error response: %v", err)
 	}
 }
@@ -0,0 +1,274 @@
+package servicea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"shared"
+)
+
+// setupTestService loads the default configuration and the instrumentation
+// the handlers expect, on the no-op providers, with Service B at serviceBURL.
+func setupTestService(tb testing.TB, serviceBURL string) {
+	tb.Helper()
+	tb.Setenv("SERVICE_B_URL", serviceBURL)
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		tb.Fatalf("loadConfig: %v", err)
+	}
+	tracer = otel.Tracer("service-a")
+	if err := initMetrics(); err != nil {
+		tb.Fatalf("initMetrics: %v", err)
+	}
+	serviceBClient = &http.Client{Timeout: 5 * time.Second}
+}
+
+// newTestServiceB starts a Service B that answers every request with handler.
+func newTestServiceB(tb testing.TB, handler http.HandlerFunc) *httptest.Server {
+	tb.Helper()
+	server := httptest.NewServer(handler)
+	tb.Cleanup(server.Close)
+	return server
+}
+
+// postCEP runs handleCEP for a JSON request with cep.
+func postCEP(cep string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/cep", strings.NewReader(`{"cep":"`+cep+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleCEP(rec, req)
+	return rec
+}
+
+const testWeatherBody = `{"city":"São Paulo","temp_C":22.5,"temp_F":72.5,"temp_K":295.65}`
+
+func TestNormalizeCEP(t *testing.T) {
+	tests := []struct {
+		cep  string
+		want string
+		ok   bool
+	}{
+		{"01001000", "01001000", true},
+		{"01001-000", "01001000", true},
+		{"01001.000", "01001000", true},
+		{"01001 000", "01001000", true},
+		{" 01001-000\n", "01001000", true},
+		{"01.001-000", "01001000", true},
+		{"01.001-00", "", false},
+		{"0100100", "", false},
+		{"010010000", "", false},
+		{"01001-00a", "", false},
+		{"01001/000", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeCEP(tt.cep)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeCEP(%q) = %q, %v; want %q, %v", tt.cep, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func BenchmarkIsValidCEP(b *testing.B) {
+	b.Run("precompiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			isValidCEP("01001000")
+		}
+	})
+	// How isValidCEP used to work, for comparison
+	b.Run("compiled per call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			regexp.MustCompile(`^\d{8}$`).MatchString("01001000")
+		}
+	})
+}
+
+func BenchmarkHandleCEP(b *testing.B) {
+	serviceB := newTestServiceB(b, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testWeatherBody))
+	})
+	setupTestService(b, serviceB.URL)
+
+	b.Run("shared client", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if rec := postCEP("01001-000"); rec.Code != http.StatusOK {
+				b.Fatalf("status = %d, want 200", rec.Code)
+			}
+		}
+	})
+	// How every request used to build its own client, for comparison
+	b.Run("client per request", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			serviceBClient = &http.Client{Transport: &http.Transport{}, Timeout: 5 * time.Second}
+			if rec := postCEP("01001-000"); rec.Code != http.StatusOK {
+				b.Fatalf("status = %d, want 200", rec.Code)
+			}
+			serviceBClient.CloseIdleConnections()
+		}
+	})
+}
+
+// TestHandleCEPIncompleteResponse checks that a Service B dropping the
+// connection halfway through its body is answered with a 502, never with the
+// partial weather as a 200.
+func TestHandleCEPIncompleteResponse(t *testing.T) {
+	serviceB := newTestServiceB(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n", len(testWeatherBody))
+		buf.WriteString(testWeatherBody[:len(testWeatherBody)/2])
+		buf.Flush()
+	})
+	setupTestService(t, serviceB.URL)
+
+	rec := postCEP("01001-000")
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502: %s", rec.Code, rec.Body)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if response.Code != "upstream_incomplete_response" {
+		t.Errorf("code = %q, want upstream_incomplete_response", response.Code)
+	}
+	if strings.Contains(rec.Body.String(), "São Paulo") {
+		t.Errorf("partial weather leaked into the response: %s", rec.Body)
+	}
+}
+
+// TestHandleCEPForecastPreference checks that Prefer reaches Service B and
+// its Preference-Applied comes back to the client.
+func TestHandleCEPForecastPreference(t *testing.T) {
+	serviceB := newTestServiceB(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Prefer"); got != "forecast=3d" {
+			t.Errorf("Service B got Prefer %q, want forecast=3d", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Preference-Applied", "forecast=3d")
+		w.Write([]byte(`{"city":"São Paulo","forecast":[]}`))
+	})
+	setupTestService(t, serviceB.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/cep", strings.NewReader(`{"cep":"01001-000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", "forecast=3d")
+	rec := httptest.NewRecorder()
+	handleCEP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Preference-Applied"); got != "forecast=3d" {
+		t.Errorf("Preference-Applied = %q, want forecast=3d", got)
+	}
+}
+
+// TestHandleCEPSearch checks that address searches go to Service B, whose
+// errors keep their status and code.
+func TestHandleCEPSearch(t *testing.T) {
+	serviceB := newTestServiceB(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/location/search" {
+			t.Errorf("Service B got %s, want /location/search", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"code":"invalid_address","message":"invalid address"}`))
+	})
+	setupTestService(t, serviceB.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/cep/search", strings.NewReader(`{"uf":"SP","city":"SP","street":"Sé"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleCEPSearch(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if response.Code != "invalid_address" {
+		t.Errorf("code = %q, want invalid_address", response.Code)
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+	serviceB := newTestServiceB(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testWeatherBody))
+	})
+	setupTestService(t, serviceB.URL)
+	handler := prettyPrint(http.HandlerFunc(handleCEP))
+
+	tests := []struct {
+		name   string
+		pretty bool
+		query  string
+		want   bool
+	}{
+		{"compact", false, "", false},
+		{"query", false, "?pretty=true", true},
+		{"PRETTY_JSON", true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.PrettyJSON = tt.pretty
+			req := httptest.NewRequest(http.MethodPost, "/cep"+tt.query, strings.NewReader(`{"cep":"01001000"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			if indented := strings.Contains(rec.Body.String(), "\n  \"city\""); indented != tt.want {
+				t.Errorf("body indented = %v, want %v: %s", indented, tt.want, rec.Body)
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("body is not valid JSON: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleRootListsRoutes(t *testing.T) {
+	setupTestService(t, "http://localhost:8081")
+	previous := routes
+	routes = nil
+	defer func() { routes = previous }()
+
+	mux := http.NewServeMux()
+	handleRoute(mux, "/cep", handleCEP)
+	handleRoute(mux, "/debug/errors", handleRecentErrors)
+	handleRoute(http.NewServeMux(), "/debug/slow", shared.SlowHandler(tracer, writeErrorResponse))
+
+	rec := httptest.NewRecorder()
+	handleRoot(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var response RootResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	want := []string{"/cep", "/debug/errors", "/debug/slow"}
+	if strings.Join(response.Endpoints, " ") != strings.Join(want, " ") {
+		t.Errorf("endpoints = %v, want %v", response.Endpoints, want)
+	}
+}
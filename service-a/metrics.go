@@ -0,0 +1,130 @@
+package servicea
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"shared"
+)
+
+var (
+	cepRequestsCounter    metric.Int64Counter
+	cepRejectionsCounter  metric.Int64Counter
+	cepInputFormatCounter metric.Int64Counter
+)
+
+// runtimeMetricsInterval bounds how often the runtime metrics read the Go
+// memory stats, which briefly stops the world.
+const runtimeMetricsInterval = 15 * time.Second
+
+func initMeter(ctx context.Context) (func(), error) {
+	if !ownTelemetry {
+		return func() {}, nil
+	}
+
+	// Create OTLP metric exporter
+	security := otlpmetricgrpc.WithInsecure()
+	if !cfg.OTLPInsecure {
+		security = otlpmetricgrpc.WithTLSCredentials(otlpCredentials())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(otlpEndpoint()), security)
+	if err != nil {
+		if cfg.OTelOptional {
+			slog.Warn("continuing without metrics: failed to create OTLP metric exporter", "error", err)
+			otel.SetMeterProvider(metricnoop.NewMeterProvider())
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same instruments are served for Prometheus scrapes at /metrics
+	promExporter, err := prometheus.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus metric exporter: %w", err)
+	}
+
+	// Create meter provider
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithReader(promExporter),
+		sdkmetric.WithResource(res),
+	)
+
+	// Set global meter provider
+	otel.SetMeterProvider(mp)
+
+	// Report goroutines, heap and GC pauses alongside the application metrics
+	if err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(runtimeMetricsInterval)); err != nil {
+		return nil, fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+	if err := shared.RegisterGCPauseMetric(mp.Meter("service-a"), runtimeMetricsInterval); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := mp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}, nil
+}
+
+// initMetrics creates the application instruments on the global meter provider.
+func initMetrics() error {
+	meter := otel.Meter("service-a")
+
+	var err error
+	cepRequestsCounter, err = meter.Int64Counter("cep_requests_total",
+		metric.WithDescription("Valid CEP requests by postal region (first CEP digit)"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cep_requests_total counter: %w", err)
+	}
+
+	cepRejectionsCounter, err = meter.Int64Counter("cep_rejections_total",
+		metric.WithDescription("CEPs rejected by validation, by reason"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cep_rejections_total counter: %w", err)
+	}
+
+	cepInputFormatCounter, err = meter.Int64Counter("cep_input_format_total",
+		metric.WithDescription("Valid CEPs by how the client wrote them: plain, dashed, dotted or spaced"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cep_input_format_total counter: %w", err)
+	}
+	sloBurnRate, err := meter.Float64ObservableGauge("slo_burn_rate",
+		metric.WithDescription("Error budget burn rate over each SLO_BURN_WINDOWS window, 1 spends it exactly"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create slo_burn_rate gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for window, rate := range errorBudget.BurnRates(shared.Now()) {
+			o.ObserveFloat64(sloBurnRate, rate.BurnRate, metric.WithAttributes(attribute.String("window", window)))
+		}
+		return nil
+	}, sloBurnRate)
+	if err != nil {
+		return fmt.Errorf("failed to register slo_burn_rate callback: %w", err)
+	}
+	return nil
+}
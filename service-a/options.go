@@ -0,0 +1,111 @@
+package servicea
+
+import (
+	"net/http"
+
+	"shared"
+)
+
+// endpointDescriptions describes every route registered on the mux, by path.
+var endpointDescriptions = map[string]shared.EndpointDescription{
+	"/": {
+		Methods:     []string{http.MethodGet, http.MethodHead},
+		Description: "Service name, version and endpoints",
+		Formats:     []string{"application/json"},
+	},
+	"/cep": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Current weather for a CEP, looked up by service B",
+		ContentTypes: []string{"application/json", formMediaType},
+		Formats:      []string{"application/json"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "cep", In: "body", Description: "8-digit CEP, with or without separators"},
+			{Name: "date", In: "query", Description: "past date (YYYY-MM-DD) for that day's history"},
+			{Name: "fields", In: "query", Description: "comma-separated weather fields to return"},
+			{Name: "version", In: "query", Description: "response schema version, 1 or 2; overrides Accept-Version"},
+			{Name: "includeMeta", In: "query", Description: "include the IBGE code and DDD, when true"},
+			{Name: "fullAddress", In: "query", Description: "include the street address, when true"},
+			{Name: "includeCoords", In: "query", Description: "include the coordinates the weather was measured at, when true"},
+			{Name: "includeMeasuredAt", In: "query", Description: "include when the provider measured the weather, when true"},
+			{Name: "extended", In: "query", Description: "include the humidity and UV index, when true"},
+			{Name: "alerts", In: "query", Description: "include the active weather alerts, when true"},
+			{Name: "timings", In: "query", Description: "include the time spent on each upstream, when true"},
+			{Name: "topology", In: "query", Description: "include the services involved and their durations, when true"},
+			{Name: "pretty", In: "query", Description: "indent JSON responses when true"},
+		},
+	},
+	"/cep/search": {
+		Methods:      []string{http.MethodPost},
+		Description:  "CEPs of an address, looked up on ViaCEP through Service B",
+		ContentTypes: []string{"application/json"},
+		Formats:      []string{"application/json"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "uf", In: "body", Description: "state abbreviation, e.g. SP"},
+			{Name: "city", In: "body", Description: "city name, at least 3 characters"},
+			{Name: "street", In: "body", Description: "street name or part of it, at least 3 characters"},
+			{Name: "pretty", In: "query", Description: "indent JSON responses when true"},
+		},
+	},
+	"/validate": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Check which CEPs are well formed, without calling service B",
+		ContentTypes: []string{"application/json"},
+		Formats:      []string{"application/json"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "ceps", In: "body", Description: "list of up to 1000 CEPs"},
+			{Name: "pretty", In: "query", Description: "indent JSON responses when true"},
+		},
+	},
+	"/health": {
+		Methods:     []string{http.MethodGet},
+		Description: "Liveness probe",
+		Formats:     []string{"application/json"},
+	},
+	"/metrics": {
+		Methods:     []string{http.MethodGet},
+		Description: "Application and Go runtime metrics for Prometheus",
+		Formats:     []string{"text/plain"},
+	},
+	"/stats": {
+		Methods:     []string{http.MethodGet},
+		Description: "Request counts and latencies by endpoint",
+		Formats:     []string{"application/json"},
+	},
+	"/debug/flush": {
+		Methods:     []string{http.MethodPost},
+		Description: "Flush the buffered telemetry",
+		Formats:     []string{"application/json"},
+	},
+	"/debug/slow": {
+		Methods:     []string{http.MethodGet},
+		Description: "Answer after the requested delay",
+		Formats:     []string{"application/json"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "ms", In: "query", Description: "delay in milliseconds, up to 30000"},
+		},
+	},
+	"/debug/errors": {
+		Methods:     []string{http.MethodGet},
+		Description: "The latest error responses",
+		Formats:     []string{"application/json"},
+	},
+}
+
+// describeRoute wraps the handler of pattern to answer OPTIONS with the
+// description of the endpoint and an Allow header. Go 1.21's mux has no method
+// patterns to route OPTIONS by, and paths the subtree pattern "/" catches for
+// its 404 fall through to handler.
+func describeRoute(pattern string, handler http.HandlerFunc) http.HandlerFunc {
+	description, ok := endpointDescriptions[pattern]
+	if !ok {
+		return handler
+	}
+	describe := shared.DescribeEndpoint(pattern, description, shared.EncodeJSON)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.URL.Path == pattern {
+			describe(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
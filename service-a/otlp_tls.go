@@ -0,0 +1,12 @@
+package servicea
+
+import (
+	"google.golang.org/grpc/credentials"
+	"shared"
+)
+
+// otlpCredentials returns the gRPC TLS credentials of the OTLP exporters, from
+// shared.OTLPTLSConfig. It stays here since each service pins its own gRPC.
+func otlpCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(shared.OTLPTLSConfig(cfg.OTLPRootCAs))
+}
@@ -0,0 +1,64 @@
+package servicea
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// prettyPrint indents the JSON responses of requests with ?pretty=true, or of
+// every request with PRETTY_JSON, as Service B does. Most of our bodies are
+// relayed from Service B as it sent them, so they are re-indented here, once
+// written, instead of where they are encoded.
+func prettyPrint(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.PrettyJSON && r.URL.Query().Get("pretty") != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buffered := &prettyResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		buffered.flush()
+	})
+}
+
+// prettyResponseWriter holds a response back until the handler is done, to
+// indent it whole.
+type prettyResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (p *prettyResponseWriter) WriteHeader(status int) {
+	p.status = status
+}
+
+func (p *prettyResponseWriter) Write(b []byte) (int, error) {
+	return p.body.Write(b)
+}
+
+func (p *prettyResponseWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// flush sends the response, indented when it is JSON, e.g. application/json
+// or application/problem+json.
+func (p *prettyResponseWriter) flush() {
+	body := p.body.Bytes()
+	mediaType, _, _ := mime.ParseMediaType(p.Header().Get("Content-Type"))
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = append(bytes.TrimRight(indented.Bytes(), "\n"), '\n')
+			p.Header().Del("Content-Length")
+		}
+	}
+	p.ResponseWriter.WriteHeader(p.status)
+	if _, err := p.ResponseWriter.Write(body); err != nil {
+		log.Printf("Failed to write pretty-printed response: %v", err)
+	}
+}
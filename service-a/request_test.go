@@ -0,0 +1,47 @@
+package servicea
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireJSON(t *testing.T) {
+	setupTestService(t, "http://localhost:8081")
+	handler := requireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		body          io.Reader
+		contentType   string
+		contentLength int64
+		want          int
+	}{
+		{name: "json", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "application/json; charset=utf-8", contentLength: 18, want: http.StatusNoContent},
+		{name: "form", method: http.MethodPost, body: strings.NewReader("cep=01001000"), contentType: "application/x-www-form-urlencoded", contentLength: 12, want: http.StatusNoContent},
+		{name: "no body", method: http.MethodPost, body: http.NoBody, want: http.StatusNoContent},
+		{name: "get", method: http.MethodGet, body: strings.NewReader("cep=01001000"), contentType: "text/plain", contentLength: 12, want: http.StatusNoContent},
+		{name: "text", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "text/plain", contentLength: 18, want: http.StatusUnsupportedMediaType},
+		{name: "chunked without content type", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentLength: -1, want: http.StatusUnsupportedMediaType},
+		{name: "undeclared length", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "text/plain", contentLength: 0, want: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/weather", tt.body)
+			req.ContentLength = tt.contentLength
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package servicea
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// serviceVersion is reported on the resource and by the landing response.
+const serviceVersion = "1.0.0"
+
+type RootResponse struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// handleRoot answers a quick check of / with what this service is and the
+// endpoints it serves, as registered by handleRoute. It never calls service B. Any other path not matched by
+// the mux falls through to here and still gets a 404.
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := RootResponse{
+		Service:   "service-a",
+		Version:   serviceVersion,
+		Endpoints: routes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode root response: %v", err)
+	}
+}
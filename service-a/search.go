@@ -0,0 +1,68 @@
+package servicea
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type CEPSearchRequest struct {
+	UF     string `json:"uf"`
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+// handleCEPSearch looks up the CEPs of an address, the reverse of /cep, with
+// Service B's POST /location/search, which validates the address and queries
+// ViaCEP's address search.
+func handleCEPSearch(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-cep-search-request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CEPSearchRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if err := forwardSearchToServiceB(r.Context(), req, forwardedHeaders(r), w); err != nil {
+		span.RecordError(err)
+		log.Printf("Error searching CEPs on Service B: %v", err)
+		writeForwardError(w, r, err)
+	}
+}
+
+// forwardSearchToServiceB relays the CEPs matching req from Service B, or its
+// error response through our error schema.
+func forwardSearchToServiceB(ctx context.Context, req CEPSearchRequest, headers http.Header, w http.ResponseWriter) error {
+	ctx, span := tracer.Start(ctx, "forward-search-to-service-b", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	resp, body, _, err := callServiceB(ctx, "/location/search", req, headers)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		forwardErrorResponse(w, resp, body)
+		return nil
+	}
+
+	if body, err = wrapSuccess(unwrapSuccess(body)); err != nil {
+		return fmt.Errorf("failed to encode response envelope: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write search response: %v", err)
+	}
+	return nil
+}
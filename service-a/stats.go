@@ -0,0 +1,29 @@
+package servicea
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"shared"
+)
+
+type StatsResponse struct {
+	shared.RequestStatsSnapshot
+	BurnRates map[string]shared.BurnRate `json:"burn_rates"`
+}
+
+// stats holds the in-memory counters served by /stats.
+var stats = shared.NewRequestStats()
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	response := StatsResponse{
+		RequestStatsSnapshot: stats.Snapshot(),
+		BurnRates:            errorBudget.BurnRates(shared.Now()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode stats response: %v", err)
+	}
+}
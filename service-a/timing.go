@@ -0,0 +1,107 @@
+package servicea
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ResponseTimings is the processing breakdown added to the response body with
+// ?timings=true: Service B's stages plus our forwarding time and total.
+type ResponseTimings struct {
+	CEPResolutionMs float64 `json:"cep_resolution_ms"`
+	WeatherLookupMs float64 `json:"weather_lookup_ms"`
+	ForwardMs       float64 `json:"forward_ms"`
+	TotalMs         float64 `json:"total_ms"`
+}
+
+// TopologyHop is one service involved in a request, listed with
+// ?topology=true. Parent is the service that called it, empty for us.
+type TopologyHop struct {
+	Service    string  `json:"service"`
+	Parent     string  `json:"parent,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// requestTimings tracks the timings of a request that asked for its
+// breakdown (?timings=true), its topology (?topology=true) or both.
+type requestTimings struct {
+	start     time.Time
+	forward   time.Duration
+	breakdown bool
+	topology  bool
+}
+
+// addTo merges our timings into Service B's response body: into its
+// "timings" object, keeping the stages Service B measured, and ahead of its
+// "topology" hops.
+func (t *requestTimings) addTo(body []byte) ([]byte, error) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode Service B response: %w", err)
+	}
+
+	if t.breakdown {
+		if err := t.addBreakdown(response); err != nil {
+			return nil, err
+		}
+	}
+	if t.topology {
+		if err := t.addTopology(response); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return append(body, '\n'), nil
+}
+
+func (t *requestTimings) addBreakdown(response map[string]json.RawMessage) error {
+	var timings ResponseTimings
+	if raw, ok := response["timings"]; ok {
+		if err := json.Unmarshal(raw, &timings); err != nil {
+			return fmt.Errorf("failed to decode Service B timings: %w", err)
+		}
+	}
+	timings.ForwardMs = milliseconds(t.forward)
+	timings.TotalMs = milliseconds(time.Since(t.start))
+
+	raw, err := json.Marshal(timings)
+	if err != nil {
+		return fmt.Errorf("failed to encode timings: %w", err)
+	}
+	response["timings"] = raw
+	return nil
+}
+
+// addTopology lists us first, then Service B's hops; the ones Service B
+// reports without a parent were called by us.
+func (t *requestTimings) addTopology(response map[string]json.RawMessage) error {
+	var downstream []TopologyHop
+	if raw, ok := response["topology"]; ok {
+		if err := json.Unmarshal(raw, &downstream); err != nil {
+			return fmt.Errorf("failed to decode Service B topology: %w", err)
+		}
+	}
+	hops := []TopologyHop{{Service: "service-a", DurationMs: milliseconds(time.Since(t.start))}}
+	for _, hop := range downstream {
+		if hop.Parent == "" {
+			hop.Parent = "service-a"
+		}
+		hops = append(hops, hop)
+	}
+
+	raw, err := json.Marshal(hops)
+	if err != nil {
+		return fmt.Errorf("failed to encode topology: %w", err)
+	}
+	response["topology"] = raw
+	return nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,134 @@
+package servicea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxValidateCEPs bounds the number of CEPs a single /validate request may carry.
+const maxValidateCEPs = 1000
+
+type ValidateRequest struct {
+	CEPs []string `json:"ceps"`
+}
+
+type CEPValidation struct {
+	CEP        string `json:"cep"`
+	Valid      bool   `json:"valid"`
+	Normalized string `json:"normalized,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type ValidateResponse struct {
+	Results []CEPValidation `json:"results"`
+}
+
+// handleValidate reports which of the CEPs in the request are well formed,
+// using only the local normalization rules: no upstream calls are made.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-validate-request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ValidateRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if len(req.CEPs) > maxValidateCEPs {
+		writeErrorResponse(w, r, "too many ceps", http.StatusBadRequest)
+		return
+	}
+
+	response := ValidateResponse{Results: make([]CEPValidation, 0, len(req.CEPs))}
+	invalid := 0
+	for _, cep := range req.CEPs {
+		result := validateCEP(cep)
+		if result.Valid {
+			recordCEPInputFormat(r.Context(), cep)
+		} else {
+			invalid++
+			recordCEPRejection(r.Context(), cep)
+		}
+		response.Results = append(response.Results, result)
+	}
+	span.SetAttributes(
+		attribute.Int("validate.ceps", len(req.CEPs)),
+		attribute.Int("validate.invalid", invalid),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode validate response: %v", err)
+	}
+}
+
+func validateCEP(cep string) CEPValidation {
+	if normalized, ok := normalizeCEP(cep); ok {
+		return CEPValidation{CEP: cep, Valid: true, Normalized: normalized}
+	}
+	_, message := cepRejection(cep)
+	return CEPValidation{CEP: cep, Reason: message}
+}
+
+// cepRejection explains why normalizeCEP rejects cep: a low-cardinality reason
+// for the cep_rejections_total metric and a message for clients.
+func cepRejection(cep string) (reason, message string) {
+	// Use the same separators normalizeCEP strips
+	digits := 0
+	for _, r := range cep {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '-' || r == '.' || unicode.IsSpace(r):
+		default:
+			return "invalid_characters", "contains characters other than digits, dashes, dots and spaces"
+		}
+	}
+	if strings.TrimSpace(cep) == "" {
+		return "empty", "empty"
+	}
+	return "wrong_length", fmt.Sprintf("must have 8 digits, got %d", digits)
+}
+
+// recordCEPRejection counts a rejected CEP by the reason it was rejected.
+func recordCEPRejection(ctx context.Context, cep string) {
+	reason, _ := cepRejection(cep)
+	cepRejectionsCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+// cepInputFormat classifies how a client wrote a valid CEP by the first
+// separator in it: "plain", "dashed", "dotted" or "spaced".
+func cepInputFormat(cep string) string {
+	for _, r := range cep {
+		switch {
+		case r == '-':
+			return "dashed"
+		case r == '.':
+			return "dotted"
+		case unicode.IsSpace(r):
+			return "spaced"
+		}
+	}
+	return "plain"
+}
+
+// recordCEPInputFormat counts a CEP accepted by normalizeCEP by how it was written.
+func recordCEPInputFormat(ctx context.Context, cep string) {
+	cepInputFormatCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("format", cepInputFormat(cep))))
+}
@@ -0,0 +1,74 @@
+package servicea
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// detectWriteTimeouts records an http.write_deadline_exceeded event on the
+// request span when the response misses its WRITE_TIMEOUT deadline, as
+// happens with clients that read too slowly. Small responses are only written
+// to the connection once the handler returns, so they are flagged when the
+// handler outlives WRITE_TIMEOUT.
+func detectWriteTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &deadlineRecorder{
+			ResponseWriter: w,
+			span:           trace.SpanFromContext(r.Context()),
+			deadline:       time.Now().Add(cfg.WriteTimeout),
+		}
+		next.ServeHTTP(recorder, r)
+		if !recorder.extended && time.Now().After(recorder.deadline) {
+			recorder.check(os.ErrDeadlineExceeded)
+		}
+	})
+}
+
+// deadlineRecorder watches the writes and flushes of a response for the write
+// deadline being hit.
+type deadlineRecorder struct {
+	http.ResponseWriter
+	span     trace.Span
+	deadline time.Time
+	// Set once the handler manages its own write deadline
+	extended bool
+	recorded bool
+}
+
+func (d *deadlineRecorder) Write(b []byte) (int, error) {
+	n, err := d.ResponseWriter.Write(b)
+	d.check(err)
+	return n, err
+}
+
+func (d *deadlineRecorder) FlushError() error {
+	err := http.NewResponseController(d.ResponseWriter).Flush()
+	d.check(err)
+	return err
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.extended = true
+	return http.NewResponseController(d.ResponseWriter).SetWriteDeadline(deadline)
+}
+
+// Flush keeps the response an http.Flusher for the writers wrapping it.
+func (d *deadlineRecorder) Flush() {
+	_ = d.FlushError()
+}
+
+func (d *deadlineRecorder) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+func (d *deadlineRecorder) check(err error) {
+	if d.recorded || !errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+	d.recorded = true
+	d.span.AddEvent("http.write_deadline_exceeded")
+}
@@ -0,0 +1,111 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// WeatherSource is the reading of one provider in an aggregated response.
+type WeatherSource struct {
+	Provider string  `json:"provider" xml:"provider"`
+	TempC    float64 `json:"temp_C" xml:"temp_C"`
+}
+
+// lookupWeather returns the weather for location from provider, or the
+// median of every provider when AGGREGATE_WEATHER=true. With
+// CLIMATE_FALLBACK=true a failed lookup serves the UF's climatological average.
+func lookupWeather(ctx context.Context, provider WeatherProvider, location *Location) (*WeatherResponse, error) {
+	var weather *WeatherResponse
+	var err error
+	if cfg.AggregateWeather {
+		weather, err = getAggregatedWeather(ctx, location)
+	} else {
+		weather, err = getWeather(ctx, provider, location)
+	}
+	if err != nil && cfg.ClimateFallback && !errors.Is(err, ErrInvalidLocation) {
+		if fallback, ok := climateFallbackWeather(ctx, location, err); ok {
+			return fallback, nil
+		}
+	}
+	return weather, err
+}
+
+// getAggregatedWeather queries every weather provider concurrently, each in
+// its own child span, and returns the median temperature of the ones that
+// answered along with their readings. It fails only if all of them fail.
+func getAggregatedWeather(ctx context.Context, location *Location) (*WeatherResponse, error) {
+	names := make([]string, 0, len(weatherProviders))
+	for name := range weatherProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type reading struct {
+		weather *WeatherResponse
+		err     error
+	}
+	readings := make([]reading, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, provider WeatherProvider) {
+			defer wg.Done()
+			sourceCtx, span := tracer.Start(ctx, "get-weather-source")
+			defer span.End()
+			span.SetAttributes(attribute.String("weather.provider", provider.Name()))
+
+			weather, err := getWeather(sourceCtx, provider, location)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "provider failed")
+			}
+			readings[i] = reading{weather: weather, err: err}
+		}(i, weatherProviders[name])
+	}
+	wg.Wait()
+
+	var answered []*WeatherResponse
+	var sources []WeatherSource
+	var errs []error
+	for i, r := range readings {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		answered = append(answered, r.weather)
+		sources = append(sources, WeatherSource{Provider: names[i], TempC: r.weather.TempC})
+	}
+	if len(answered) == 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// The first provider that answered gives the other fields, such as the time
+	weather := *answered[0]
+	weather.TempC = medianTempC(sources)
+	weather.TempF = celsiusToFahrenheit(weather.TempC)
+	weather.TempK = celsiusToKelvin(weather.TempC)
+	weather.Sources = sources
+	return &weather, nil
+}
+
+// medianTempC returns the median temperature of sources, the average of the
+// two middle ones for an even count.
+func medianTempC(sources []WeatherSource) float64 {
+	temps := make([]float64, len(sources))
+	for i, source := range sources {
+		temps[i] = source.TempC
+	}
+	sort.Float64s(temps)
+
+	middle := len(temps) / 2
+	if len(temps)%2 == 0 {
+		return (temps[middle-1] + temps[middle]) / 2
+	}
+	return temps[middle]
+}
@@ -0,0 +1,89 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WeatherAlert is an active weather alert for the location, only filled in
+// when ?alerts=true.
+type WeatherAlert struct {
+	Headline string `json:"headline" xml:"headline"`
+	Severity string `json:"severity" xml:"severity"`
+	Area     string `json:"area" xml:"area"`
+}
+
+type WeatherAPIAlertsResponse struct {
+	Alerts struct {
+		Alert []struct {
+			Headline string `json:"headline"`
+			Severity string `json:"severity"`
+			Areas    string `json:"areas"`
+		} `json:"alert"`
+	} `json:"alerts"`
+}
+
+// getWeatherAlerts returns the active alerts at location from WeatherAPI's
+// forecast endpoint, which is the only one that reports them.
+func getWeatherAlerts(ctx context.Context, location *Location) ([]WeatherAlert, error) {
+	ctx, span := tracer.Start(ctx, "get-weather-alerts")
+	defer span.End()
+	span.SetAttributes(attribute.String("city", location.City))
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateLocation(ctx, location); err != nil {
+		return nil, err
+	}
+
+	weatherAPIKey := currentWeatherAPIKey()
+	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
+		// There are no alerts in the mock data
+		span.SetAttributes(attribute.Bool("mock_data", true))
+		return nil, nil
+	}
+
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/forecast.json?key=%s&q=%s&days=1&aqi=no&alerts=yes", weatherAPIKey, url.QueryEscape(location.City))
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	release, err := acquireWeatherAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request to WeatherAPI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("WeatherAPI forecast returned status %d, response body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("WeatherAPI forecast returned status %d", resp.StatusCode)
+	}
+
+	var alertsResp WeatherAPIAlertsResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&alertsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode WeatherAPI forecast response: %w", err)
+	}
+
+	alerts := make([]WeatherAlert, 0, len(alertsResp.Alerts.Alert))
+	for _, alert := range alertsResp.Alerts.Alert {
+		alerts = append(alerts, WeatherAlert{Headline: alert.Headline, Severity: alert.Severity, Area: alert.Areas})
+	}
+	span.SetAttributes(attribute.Int("weather.alerts", len(alerts)))
+	return alerts, nil
+}
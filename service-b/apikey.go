@@ -0,0 +1,153 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// weatherAPIKeyPollInterval is how often WEATHER_API_KEY_FILE is re-read, so
+// Kubernetes secrets updated in place are picked up without a SIGHUP.
+const weatherAPIKeyPollInterval = 30 * time.Second
+
+// WeatherAPI keys are 31 characters long; the bounds leave room for other
+// formats without accepting obviously truncated or concatenated values.
+const (
+	minWeatherAPIKeyLength = 16
+	maxWeatherAPIKeyLength = 64
+)
+
+// weatherAPIKeyValidationTimeout bounds the startup call validating the key.
+const weatherAPIKeyValidationTimeout = 5 * time.Second
+
+// activeWeatherAPIKey holds the current WeatherAPI key; it is swapped atomically
+// when the key file changes.
+var activeWeatherAPIKey atomic.Value
+
+// currentWeatherAPIKey returns the WeatherAPI key in use.
+func currentWeatherAPIKey() string {
+	key, _ := activeWeatherAPIKey.Load().(string)
+	return key
+}
+
+// loadWeatherAPIKey reads the key from WEATHER_API_KEY_FILE when set, or else
+// from WEATHER_API_KEY, and reports whether it changed.
+func loadWeatherAPIKey() (bool, error) {
+	key := os.Getenv("WEATHER_API_KEY")
+	if cfg.WeatherAPIKeyFile != "" {
+		data, err := os.ReadFile(cfg.WeatherAPIKeyFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read WEATHER_API_KEY_FILE: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if err := checkWeatherAPIKeyFormat(key); err != nil {
+		return false, err
+	}
+	return activeWeatherAPIKey.Swap(key) != key, nil
+}
+
+// checkWeatherAPIKeyFormat rejects keys that cannot be valid, such as ones
+// truncated or pasted with quotes, before they surface as a 401 from WeatherAPI.
+// No key, or the placeholder, is fine: the mock weather is served instead.
+func checkWeatherAPIKeyFormat(key string) error {
+	if !weatherAPIKeyConfigured(key) {
+		return nil
+	}
+	if len(key) < minWeatherAPIKeyLength || len(key) > maxWeatherAPIKeyLength {
+		return fmt.Errorf("malformed WeatherAPI key: must be %d to %d characters long, got %d", minWeatherAPIKeyLength, maxWeatherAPIKeyLength, len(key))
+	}
+	for _, c := range key {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return fmt.Errorf("malformed WeatherAPI key: must only contain letters and digits, got %q", c)
+		}
+	}
+	return nil
+}
+
+// weatherAPIKeyConfigured reports whether key is an actual key rather than
+// unset or the placeholder from .env.example.
+func weatherAPIKeyConfigured(key string) bool {
+	return key != "" && key != "your_weather_api_key_here"
+}
+
+// validateWeatherAPIKey makes one cheap WeatherAPI call with the current key
+// when WEATHER_VALIDATE_KEY_ON_START=true and fails if WeatherAPI rejects it.
+// Other failures are only logged, so an upstream outage does not keep the
+// service from starting.
+func validateWeatherAPIKey(ctx context.Context) error {
+	key := currentWeatherAPIKey()
+	if !weatherAPIKeyConfigured(key) {
+		return errors.New("WEATHER_VALIDATE_KEY_ON_START=true requires a WeatherAPI key")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, weatherAPIKeyValidationTimeout)
+	defer cancel()
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/timezone.json?key=%s&q=London", key)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		// Leave out the URL, which carries the key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		log.Printf("Could not validate the WeatherAPI key at startup: %v", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("WeatherAPI rejected the key with status %d", resp.StatusCode)
+	case http.StatusOK:
+		log.Println("WeatherAPI key validated")
+	default:
+		log.Printf("Could not validate the WeatherAPI key at startup: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// watchWeatherAPIKey reloads the key from WEATHER_API_KEY_FILE on SIGHUP and
+// every weatherAPIKeyPollInterval until ctx is done. A failed reload keeps the
+// previous key.
+func watchWeatherAPIKey(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(weatherAPIKeyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		case <-ticker.C:
+		}
+
+		changed, err := loadWeatherAPIKey()
+		if err != nil {
+			log.Printf("Keeping the current WeatherAPI key: %v", err)
+			continue
+		}
+		if changed {
+			log.Println("Reloaded the WeatherAPI key from WEATHER_API_KEY_FILE")
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package serviceb
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// auditZipcodeNotFound writes the audit record of a CEP that no provider could
+// resolve, for reports of frequently failing CEPs. The record goes to the
+// AUDIT_LOG_CHANNEL channel at AUDIT_LOG_LEVEL, apart from the error logs.
+func auditZipcodeNotFound(ctx context.Context, cep string, providers []LocationProvider) {
+	if cfg.AuditLogRedactCEP {
+		cep = maskCEP(cep)
+	}
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name())
+	}
+
+	attrs := []slog.Attr{
+		slog.String("channel", cfg.AuditLogChannel),
+		slog.String("event", "zipcode_not_found"),
+		slog.String("cep", cep),
+		slog.Any("providers", names),
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	slog.LogAttrs(ctx, cfg.AuditLogLevel, "zipcode not found", attrs...)
+}
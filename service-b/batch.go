@@ -0,0 +1,331 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// batchConcurrency bounds the CEPs of one batch request looked up at once.
+const batchConcurrency = 5
+
+type BatchRequest struct {
+	CEPs []string `json:"ceps"`
+}
+
+// BatchItem is the outcome of one CEP of a batch: its weather, or the error a
+// single /weather request for it would have returned.
+type BatchItem struct {
+	CEP     string           `json:"cep"`
+	Weather *WeatherResponse `json:"weather,omitempty"`
+	Error   *ErrorResponse   `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchItem `json:"results"`
+}
+
+// handleWeatherBatch looks up the weather for up to MAX_BATCH_SIZE CEPs in one
+// request. Items fail independently, so the response is a 200 whenever the
+// batch itself is valid.
+func handleWeatherBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetName("handle-weather-batch-request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := negotiateFormat(r); !ok {
+		writeErrorResponse(w, r, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	if _, ok := negotiateSchemaVersion(r); !ok {
+		writeErrorResponse(w, r, "unsupported schema version", http.StatusNotAcceptable)
+		return
+	}
+
+	var req BatchRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("batch.size", len(req.CEPs)))
+	if len(req.CEPs) == 0 {
+		writeErrorResponse(w, r, "empty batch", http.StatusUnprocessableEntity)
+		return
+	}
+	async := r.URL.Query().Get("async") == "true"
+	maxSize := cfg.MaxBatchSize
+	if async {
+		maxSize = cfg.MaxBatchJobSize
+	}
+	if len(req.CEPs) > maxSize {
+		writeErrorResponse(w, r, "batch too large", http.StatusUnprocessableEntity)
+		return
+	}
+
+	provider, ok := selectWeatherProvider(r)
+	if !ok {
+		writeErrorResponse(w, r, "invalid weather provider", http.StatusBadRequest)
+		return
+	}
+
+	if async {
+		submitBatchJob(w, r, req.CEPs, provider)
+		return
+	}
+
+	// The items run under their own span, which outlives the request span
+	// when the handler timeout answers before the batch notices it was cancelled
+	ctx, runSpan := tracer.Start(ctx, "run-batch")
+	defer runSpan.End()
+
+	// The remaining items are cancelled once the response grows past
+	// MAX_BATCH_RESPONSE_BYTES
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	guard := &batchSizeGuard{abort: abort}
+
+	// Resolve every location first, so the distinct cities can be fetched in
+	// bulk before looking up the weather of each item
+	lookups := make([]*batchLookup, len(req.CEPs))
+	runBatch(ctx, len(lookups), func(i int) {
+		lookups[i] = resolveBatchItem(ctx, req.CEPs[i])
+	})
+	if ctx.Err() != nil {
+		cancelBatch(w, r, runSpan, lookups)
+		return
+	}
+
+	var locations []*Location
+	for _, lookup := range lookups {
+		if lookup.location != nil {
+			locations = append(locations, lookup.location)
+		}
+	}
+	prefetchBulkWeather(ctx, provider, locations)
+
+	runBatch(ctx, len(lookups), func(i int) {
+		finishBatchItem(lookups[i], provider)
+		guard.add(lookups[i].item)
+	})
+	if errors.Is(context.Cause(ctx), ErrBatchResponseTooLarge) {
+		abortOversizedBatch(w, r, runSpan, lookups, guard)
+		return
+	}
+	if ctx.Err() != nil {
+		cancelBatch(w, r, runSpan, lookups)
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchItem, len(lookups))}
+	failed := 0
+	for i, lookup := range lookups {
+		response.Results[i] = lookup.item
+		if lookup.item.Error != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("batch.failed", failed))
+
+	encodeResponse(w, r, http.StatusOK, response)
+}
+
+// runBatch calls fn for every index below n, batchConcurrency at a time, and
+// stops dispatching once ctx is done.
+func runBatch(ctx context.Context, n int, fn func(i int)) {
+	var group errgroup.Group
+	group.SetLimit(batchConcurrency)
+	for i := range n {
+		if ctx.Err() != nil {
+			break
+		}
+		group.Go(func() error {
+			fn(i)
+			return nil
+		})
+	}
+	group.Wait()
+}
+
+// cancelBatch ends a batch whose request was cancelled or timed out midway:
+// it ends the spans of the items left unfinished and records how many items
+// were cancelled, including the ones never dispatched. A client that went
+// away gets no response; one whose deadline passed gets a 504.
+func cancelBatch(w http.ResponseWriter, r *http.Request, runSpan trace.Span, lookups []*batchLookup) {
+	cancelled := endUnfinishedItems(lookups)
+	runSpan.SetAttributes(attribute.Int("batch.cancelled", cancelled))
+	runSpan.RecordError(r.Context().Err())
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("batch.cancelled", cancelled))
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		writeErrorResponse(w, r, "request timed out", http.StatusGatewayTimeout)
+	}
+}
+
+// batchSizeGuard adds up the encoded size of the items of a batch as they
+// complete, so a batch of many distinct cities cannot build an unbounded
+// response in memory.
+type batchSizeGuard struct {
+	abort     context.CancelCauseFunc
+	bytes     atomic.Int64
+	completed atomic.Int64
+}
+
+// add counts item towards MAX_BATCH_RESPONSE_BYTES, aborting the batch with
+// ErrBatchResponseTooLarge once it is exceeded. It reports whether the item
+// still fits.
+func (g *batchSizeGuard) add(item BatchItem) bool {
+	if cfg.MaxBatchResponseBytes <= 0 {
+		return true
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return true
+	}
+	if g.bytes.Add(int64(len(data))) > cfg.MaxBatchResponseBytes {
+		g.abort(ErrBatchResponseTooLarge)
+		return false
+	}
+	g.completed.Add(1)
+	return true
+}
+
+// abortOversizedBatch ends a batch whose response outgrew
+// MAX_BATCH_RESPONSE_BYTES with a 413, recording how many items completed
+// before it was aborted.
+func abortOversizedBatch(w http.ResponseWriter, r *http.Request, runSpan trace.Span, lookups []*batchLookup, guard *batchSizeGuard) {
+	cancelled := endUnfinishedItems(lookups)
+	attrs := []attribute.KeyValue{
+		attribute.Int64("batch.completed_before_abort", guard.completed.Load()),
+		attribute.Int("batch.cancelled", cancelled),
+	}
+	runSpan.SetAttributes(attrs...)
+	runSpan.RecordError(ErrBatchResponseTooLarge)
+	trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+	writeErrorResponse(w, r, "batch response too large", http.StatusRequestEntityTooLarge)
+}
+
+// endUnfinishedItems ends the spans of the items of a cancelled batch left
+// unfinished and returns how many items were cancelled, including the ones
+// never dispatched.
+func endUnfinishedItems(lookups []*batchLookup) int {
+	cancelled := 0
+	for _, lookup := range lookups {
+		switch {
+		case lookup == nil:
+			cancelled++
+		case !lookup.finished:
+			cancelled++
+			lookup.span.AddEvent("batch.item_cancelled")
+			lookup.span.End()
+		case lookup.cancelled:
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// batchLookup is one CEP of a batch as it goes from its location to its
+// weather. Each runs in its own child span, so the cache and provider
+// attributes of concurrent items do not overwrite each other.
+type batchLookup struct {
+	ctx      context.Context
+	span     trace.Span
+	location *Location
+	item     BatchItem
+
+	// finished is set once the item's span has ended, and cancelled when
+	// its lookup failed because the request was cancelled
+	finished  bool
+	cancelled bool
+}
+
+// resolveBatchItem starts the span of one CEP of a batch and resolves its
+// location, leaving location nil and the error in item when that fails.
+func resolveBatchItem(ctx context.Context, cep string) *batchLookup {
+	ctx, span := tracer.Start(ctx, "batch-item")
+	span.SetAttributes(attribute.String("cep", cep))
+	lookup := &batchLookup{ctx: ctx, span: span, item: BatchItem{CEP: formatResponseCEP(cep)}}
+
+	normalized, ok := normalizeCEP(cep)
+	if !ok {
+		lookup.item.Error = batchItemError("invalid zipcode", http.StatusUnprocessableEntity)
+		return lookup
+	}
+
+	location, err := resolveLocation(ctx, normalized)
+	if err != nil {
+		span.RecordError(err)
+		lookup.cancelled = ctx.Err() != nil
+		var rateLimited *RateLimitedError
+		switch {
+		case errors.Is(err, ErrZipcodeNotFound):
+			lookup.item.Error = batchItemError("can not find zipcode", http.StatusNotFound)
+		case errors.As(err, &rateLimited):
+			lookup.item.Error = batchItemError("upstream rate limited, try again later", http.StatusTooManyRequests)
+		case errors.Is(err, ErrUpstreamTLS):
+			log.Printf("Error getting location: %v", err)
+			lookup.item.Error = batchItemError("upstream tls error", http.StatusBadGateway)
+		default:
+			log.Printf("Error getting location: %v", err)
+			lookup.item.Error = batchItemError("internal server error", http.StatusInternalServerError)
+		}
+		return lookup
+	}
+	distinct.observeLocation(location)
+	lookup.location = location
+	return lookup
+}
+
+// finishBatchItem looks up the weather of a resolved batch item and ends its span.
+func finishBatchItem(lookup *batchLookup, provider WeatherProvider) {
+	defer func() {
+		lookup.span.End()
+		lookup.finished = true
+	}()
+	if lookup.location == nil {
+		return
+	}
+
+	weather, err := lookupWeather(lookup.ctx, provider, lookup.location)
+	if err != nil {
+		lookup.span.RecordError(err)
+		lookup.cancelled = lookup.ctx.Err() != nil
+		log.Printf("Error getting weather: %v", err)
+		switch {
+		case errors.Is(err, ErrInvalidLocation):
+			lookup.item.Error = batchItemError("invalid location", http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrImplausibleWeather):
+			lookup.item.Error = batchItemError("implausible weather data from upstream", http.StatusBadGateway)
+		case errors.Is(err, ErrMissingTemperature):
+			lookup.item.Error = batchItemError("incomplete weather data from upstream", http.StatusBadGateway)
+		case errors.Is(err, ErrRegionMismatch):
+			lookup.item.Error = batchItemError("weather region mismatch from upstream", http.StatusBadGateway)
+		case errors.Is(err, ErrUpstreamTLS):
+			lookup.item.Error = batchItemError("upstream tls error", http.StatusBadGateway)
+		default:
+			lookup.item.Error = batchItemError("internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if cfg.ExposeMockFlag {
+		weather.Mock = &weather.IsMock
+	}
+	includeExtraUnits(weather)
+	lookup.item.Weather = weather
+}
+
+func batchItemError(message string, statusCode int) *ErrorResponse {
+	return &ErrorResponse{Code: errorCode(message, statusCode), Message: message}
+}
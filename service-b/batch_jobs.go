@@ -0,0 +1,274 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+const (
+	batchJobRunning   = "running"
+	batchJobCompleted = "completed"
+	batchJobCancelled = "cancelled"
+	batchJobAborted   = "aborted"
+)
+
+// BatchJobResponse is the state of an async batch job. Results holds the
+// items finished so far, in the order of the submitted CEPs.
+type BatchJobResponse struct {
+	JobID     string      `json:"job_id"`
+	Status    string      `json:"status"`
+	Total     int         `json:"total"`
+	Completed int         `json:"completed"`
+	Failed    int         `json:"failed"`
+	Results   []BatchItem `json:"results"`
+	CreatedAt time.Time   `json:"created_at"`
+
+	// Set once the job is over, when it is forgotten
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Why an aborted job stopped
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// batchJob is a batch looked up in the background by POST
+// /weather/batch?async=true.
+type batchJob struct {
+	id      string
+	cancel  context.CancelFunc
+	created time.Time
+
+	mu       sync.Mutex
+	status   string
+	items    []BatchItem
+	done     []bool
+	failed   int
+	finished int
+	expires  time.Time
+	err      *ErrorResponse
+}
+
+// batchJobs holds the async batch jobs by ID until BATCH_JOB_RETENTION after
+// they are over.
+var batchJobs = struct {
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}{jobs: make(map[string]*batchJob)}
+
+// runningBatchJobs counts the async batch jobs still running, bounded by
+// MAX_BATCH_JOBS.
+var runningBatchJobs atomic.Int64
+
+// submitBatchJob starts looking up a batch in the background and answers
+// with a 202 pointing at the job. The job runs detached from the request, so
+// neither the client going away nor the handler timeout stops it, in its own
+// trace linked to the submitting request. Past MAX_BATCH_JOBS running jobs,
+// new ones are turned away.
+func submitBatchJob(w http.ResponseWriter, r *http.Request, ceps []string, provider WeatherProvider) {
+	span := trace.SpanFromContext(r.Context())
+	if running := runningBatchJobs.Add(1); cfg.MaxBatchJobs > 0 && running > int64(cfg.MaxBatchJobs) {
+		runningBatchJobs.Add(-1)
+		span.AddEvent("batch.job_limit_reached")
+		writeErrorResponse(w, r, "too many batch jobs", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	job := &batchJob{
+		id:      shared.NewUUID(),
+		cancel:  cancel,
+		created: time.Now(),
+		status:  batchJobRunning,
+		items:   make([]BatchItem, len(ceps)),
+		done:    make([]bool, len(ceps)),
+	}
+	batchJobs.mu.Lock()
+	batchJobs.jobs[job.id] = job
+	batchJobs.mu.Unlock()
+
+	span.SetAttributes(attribute.String("batch.job_id", job.id))
+	ctx, jobSpan := tracer.Start(ctx, "run-batch-job",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(r.Context())),
+		trace.WithAttributes(
+			attribute.String("batch.job_id", job.id),
+			attribute.Int("batch.size", len(ceps)),
+		),
+	)
+	go job.run(ctx, jobSpan, ceps, provider)
+
+	w.Header().Set("Location", absoluteURL(r, "/weather/batch/"+job.id))
+	encodeResponse(w, r, http.StatusAccepted, job.response())
+}
+
+// run looks up the weather of every CEP of the job, recording each item as
+// it finishes so polling sees the partial results. Like a synchronous batch,
+// the job is aborted once its results outgrow MAX_BATCH_RESPONSE_BYTES, as
+// they are kept in memory until it expires.
+func (j *batchJob) run(ctx context.Context, span trace.Span, ceps []string, provider WeatherProvider) {
+	defer span.End()
+	defer runningBatchJobs.Add(-1)
+	defer j.cancel()
+
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	guard := &batchSizeGuard{abort: abort}
+
+	lookups := make([]*batchLookup, len(ceps))
+	runBatch(ctx, len(lookups), func(i int) {
+		lookups[i] = resolveBatchItem(ctx, ceps[i])
+	})
+
+	var locations []*Location
+	for _, lookup := range lookups {
+		if lookup != nil && lookup.location != nil {
+			locations = append(locations, lookup.location)
+		}
+	}
+	if ctx.Err() == nil {
+		prefetchBulkWeather(ctx, provider, locations)
+	}
+
+	runBatch(ctx, len(lookups), func(i int) {
+		if lookups[i] == nil {
+			return
+		}
+		finishBatchItem(lookups[i], provider)
+		if !lookups[i].cancelled && guard.add(lookups[i].item) {
+			j.record(i, lookups[i].item)
+		}
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case errors.Is(context.Cause(ctx), ErrBatchResponseTooLarge):
+		j.status = batchJobAborted
+		j.err = &ErrorResponse{
+			Code:    errorCode("batch response too large", http.StatusRequestEntityTooLarge),
+			Message: "batch response too large",
+		}
+		cancelled := endUnfinishedItems(lookups)
+		span.SetAttributes(
+			attribute.Int64("batch.completed_before_abort", guard.completed.Load()),
+			attribute.Int("batch.cancelled", cancelled),
+		)
+		span.RecordError(ErrBatchResponseTooLarge)
+	case ctx.Err() != nil:
+		j.status = batchJobCancelled
+		cancelled := endUnfinishedItems(lookups)
+		span.SetAttributes(attribute.Int("batch.cancelled", cancelled))
+		span.AddEvent("batch.job_cancelled")
+	default:
+		j.status = batchJobCompleted
+	}
+	span.SetAttributes(attribute.Int("batch.failed", j.failed))
+	j.expires = time.Now().Add(cfg.BatchJobRetention)
+	time.AfterFunc(cfg.BatchJobRetention, func() { forgetBatchJob(j.id) })
+}
+
+func (j *batchJob) record(i int, item BatchItem) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.items[i] = item
+	j.done[i] = true
+	j.finished++
+	if item.Error != nil {
+		j.failed++
+	}
+}
+
+// over reports whether the job has stopped running, however it ended.
+func (j *batchJob) over() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status != batchJobRunning
+}
+
+func (j *batchJob) response() BatchJobResponse {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	response := BatchJobResponse{
+		JobID:     j.id,
+		Status:    j.status,
+		Total:     len(j.items),
+		Completed: j.finished,
+		Failed:    j.failed,
+		Results:   make([]BatchItem, 0, j.finished),
+		CreatedAt: j.created,
+		Error:     j.err,
+	}
+	for i, item := range j.items {
+		if j.done[i] {
+			response.Results = append(response.Results, item)
+		}
+	}
+	if !j.expires.IsZero() {
+		response.ExpiresAt = &j.expires
+	}
+	return response
+}
+
+func lookupBatchJob(id string) (*batchJob, bool) {
+	batchJobs.mu.Lock()
+	defer batchJobs.mu.Unlock()
+	job, ok := batchJobs.jobs[id]
+	return job, ok
+}
+
+// cancelBatchJobs stops every running batch job; it is registered to run when
+// the server starts shutting down, as the jobs would not outlive the process.
+func cancelBatchJobs() {
+	batchJobs.mu.Lock()
+	defer batchJobs.mu.Unlock()
+	for _, job := range batchJobs.jobs {
+		job.cancel()
+	}
+}
+
+func forgetBatchJob(id string) {
+	batchJobs.mu.Lock()
+	defer batchJobs.mu.Unlock()
+	delete(batchJobs.jobs, id)
+}
+
+// handleBatchJob reports the status and partial results of an async batch job.
+func handleBatchJob(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-batch-job-request")
+	span.SetAttributes(attribute.String("batch.job_id", r.PathValue("job_id")))
+
+	job, ok := lookupBatchJob(r.PathValue("job_id"))
+	if !ok {
+		writeErrorResponse(w, r, "can not find batch job", http.StatusNotFound)
+		return
+	}
+	encodeResponse(w, r, http.StatusOK, job.response())
+}
+
+// handleCancelBatchJob stops an async batch job. The items already finished
+// stay available until the job expires; a job already over answers 409.
+func handleCancelBatchJob(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-cancel-batch-job-request")
+	span.SetAttributes(attribute.String("batch.job_id", r.PathValue("job_id")))
+
+	job, ok := lookupBatchJob(r.PathValue("job_id"))
+	if !ok {
+		writeErrorResponse(w, r, "can not find batch job", http.StatusNotFound)
+		return
+	}
+	if job.over() {
+		writeErrorResponse(w, r, "batch job already finished", http.StatusConflict)
+		return
+	}
+	job.cancel()
+	encodeResponse(w, r, http.StatusAccepted, job.response())
+}
@@ -0,0 +1,147 @@
+package serviceb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+// Cache stores values by key until they expire. ttlCache keeps them in the
+// process and redisCache in Redis, where every instance shares them.
+type Cache[V any] interface {
+	Get(key string) (V, bool)
+	// GetWithTTL is like Get but also returns how long the value has left.
+	GetWithTTL(key string) (V, time.Duration, bool)
+	// GetEntry is like Get but also returns the entry metadata, such as when
+	// it was stored.
+	GetEntry(key string) (cacheEntry[V], bool)
+	Set(key string, value V)
+	// SetWithTTL stores value with its own ttl instead of the cache's default.
+	SetWithTTL(key string, value V, ttl time.Duration)
+	// Backend names the implementation, for span attributes.
+	Backend() string
+}
+
+// newCache returns a Redis-backed cache when REDIS_URL is set and an
+// in-memory one otherwise. name namespaces the keys in Redis.
+func newCache[V any](name string, ttl time.Duration) Cache[V] {
+	if redisClient != nil {
+		return newRedisCache[V](redisClient, name, ttl)
+	}
+	return newTTLCache[V](ttl)
+}
+
+type cacheEntry[V any] struct {
+	value     V
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// ttlCache is a minimal in-memory cache whose entries expire after a fixed TTL.
+// Expired entries are evicted lazily when they are read.
+type ttlCache[V any] struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]cacheEntry[V]
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry[V]),
+	}
+}
+
+func (c *ttlCache[V]) Get(key string) (V, bool) {
+	entry, ok := c.GetEntry(key)
+	return entry.value, ok
+}
+
+func (c *ttlCache[V]) GetWithTTL(key string) (V, time.Duration, bool) {
+	entry, ok := c.GetEntry(key)
+	return entry.value, entry.expiresAt.Sub(shared.Now()), ok
+}
+
+func (c *ttlCache[V]) GetEntry(key string) (cacheEntry[V], bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		return cacheEntry[V]{}, false
+	}
+	if shared.Now().After(entry.expiresAt) {
+		c.mu.Lock()
+		if current, ok := c.entries[key]; ok && shared.Now().After(current.expiresAt) {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return cacheEntry[V]{}, false
+	}
+	return entry, true
+}
+
+func (c *ttlCache[V]) Backend() string { return "memory" }
+
+func (c *ttlCache[V]) Set(key string, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL skips caching when ttl <= 0, and a cache created with a zero TTL
+// stays disabled.
+func (c *ttlCache[V]) SetWithTTL(key string, value V, ttl time.Duration) {
+	if c.ttl <= 0 || ttl <= 0 {
+		return
+	}
+	now := shared.Now()
+	c.mu.Lock()
+	c.entries[key] = cacheEntry[V]{
+		value:     value,
+		storedAt:  now,
+		expiresAt: now.Add(ttl),
+	}
+	c.mu.Unlock()
+}
+
+// setCacheExpiryAttributes records on span how long the entry of the named
+// cache has left and when it expires, when it is stored or served.
+func setCacheExpiryAttributes(span trace.Span, name string, expiresAt time.Time) {
+	span.SetAttributes(
+		attribute.Int64("cache."+name+".ttl_seconds", int64(expiresAt.Sub(shared.Now()).Round(time.Second).Seconds())),
+		attribute.String("cache."+name+".expires_at", expiresAt.UTC().Format(time.RFC3339)),
+	)
+}
+
+// parseCacheControl returns the freshness lifetime a Cache-Control header
+// grants a shared cache like ours: s-maxage over max-age, and zero for
+// no-store or no-cache. It reports false when the header sets no lifetime.
+func parseCacheControl(value string) (time.Duration, bool) {
+	var maxAge, sharedMaxAge time.Duration
+	var hasMaxAge, hasSharedMaxAge bool
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+		switch name {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age", "s-maxage":
+			seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			if name == "max-age" {
+				maxAge, hasMaxAge = time.Duration(seconds)*time.Second, true
+			} else {
+				sharedMaxAge, hasSharedMaxAge = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+	if hasSharedMaxAge {
+		return sharedMaxAge, true
+	}
+	return maxAge, hasMaxAge
+}
@@ -0,0 +1,125 @@
+package serviceb
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+
+	"shared"
+)
+
+// hllPrecision gives 2^12 registers: 4 KiB per counter and about 1.6% standard
+// error, regardless of how many values are observed.
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct strings added to it without
+// keeping the strings themselves.
+type hyperLogLog struct {
+	seed      maphash.Seed
+	registers [1 << hllPrecision]uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{seed: maphash.MakeSeed()}
+}
+
+func (h *hyperLogLog) add(value string) {
+	hash := maphash.String(h.seed, value)
+	index := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	const m = float64(len(h.registers))
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum, zeros := 0.0, 0
+	for _, register := range h.registers {
+		sum += math.Ldexp(1, -int(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha * m * m / sum
+	// Small range correction: linear counting is more accurate while many
+	// registers are still empty.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// DistinctStats are the approximate distinct CEPs and cities served in the
+// current window.
+type DistinctStats struct {
+	CEPs        uint64    `json:"ceps"`
+	Cities      uint64    `json:"cities"`
+	WindowStart time.Time `json:"window_start"`
+}
+
+// distinctCounter tracks approximate distinct CEPs and cities served, starting
+// over every DISTINCT_COUNT_WINDOW (never when it is zero).
+type distinctCounter struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	ceps        *hyperLogLog
+	cities      *hyperLogLog
+}
+
+var distinct = &distinctCounter{
+	windowStart: shared.Now(),
+	ceps:        newHyperLogLog(),
+	cities:      newHyperLogLog(),
+}
+
+// observeLocation counts the CEP of location and its city.
+func (d *distinctCounter) observeLocation(location *Location) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rotate()
+	d.ceps.add(location.CEP)
+	d.cities.add(cityKey(location.City, location.UF))
+}
+
+// observeCity counts a city looked up by name, without a CEP.
+func (d *distinctCounter) observeCity(city string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rotate()
+	d.cities.add(cityKey(city, ""))
+}
+
+func (d *distinctCounter) snapshot() DistinctStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rotate()
+	return DistinctStats{
+		CEPs:        d.ceps.estimate(),
+		Cities:      d.cities.estimate(),
+		WindowStart: d.windowStart.UTC(),
+	}
+}
+
+// rotate starts a new window once the current one is over. The caller must
+// hold d.mu.
+func (d *distinctCounter) rotate() {
+	if cfg.DistinctCountWindow <= 0 || shared.Since(d.windowStart) < cfg.DistinctCountWindow {
+		return
+	}
+	d.windowStart = shared.Now()
+	d.ceps = newHyperLogLog()
+	d.cities = newHyperLogLog()
+}
+
+func cityKey(city, uf string) string {
+	return strings.ToLower(city) + "/" + uf
+}
@@ -0,0 +1,131 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// datasetEntry is one row of CEP_DATASET_FILE. CEP may be a full CEP or a
+// prefix of one, e.g. "01001" for every CEP starting with 01001.
+type datasetEntry struct {
+	CEP    string `json:"cep"`
+	City   string `json:"city"`
+	UF     string `json:"uf"`
+	Region string `json:"region"`
+	IBGE   string `json:"ibge"`
+	DDD    string `json:"ddd"`
+}
+
+// datasetProvider resolves CEPs from CEP_DATASET_FILE, loaded in memory at
+// startup, without calling any upstream. The longest prefix of the CEP found
+// in the dataset wins.
+type datasetProvider struct {
+	locations map[string]Location
+}
+
+func (*datasetProvider) Name() string { return "offline" }
+
+func (p *datasetProvider) Resolve(_ context.Context, cep string) (*Location, error) {
+	for n := len(cep); n > 0; n-- {
+		if location, ok := p.locations[cep[:n]]; ok {
+			location.CEP = cep
+			return &location, nil
+		}
+	}
+	return nil, ErrZipcodeNotFound
+}
+
+// loadCEPDataset reads a CSV (with a header row naming the columns) or JSON
+// (an array of objects) dataset of CEPs, chosen by the file extension.
+func loadCEPDataset(path string) (*datasetProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CEP_DATASET_FILE: %w", err)
+	}
+	defer file.Close()
+
+	var entries []datasetEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		entries, err = readCSVDataset(file)
+	case ".json":
+		err = json.NewDecoder(file).Decode(&entries)
+	default:
+		return nil, fmt.Errorf("invalid CEP_DATASET_FILE %q: must be a .csv or .json file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CEP_DATASET_FILE: %w", err)
+	}
+
+	provider := &datasetProvider{locations: make(map[string]Location, len(entries))}
+	for i, entry := range entries {
+		cep := strings.NewReplacer("-", "", ".", "", " ", "").Replace(entry.CEP)
+		if cep == "" || len(cep) > 8 || strings.Trim(cep, "0123456789") != "" {
+			return nil, fmt.Errorf("invalid CEP_DATASET_FILE entry %d: CEP %q must be up to 8 digits", i+1, entry.CEP)
+		}
+		if entry.City == "" || entry.UF == "" {
+			return nil, fmt.Errorf("invalid CEP_DATASET_FILE entry %d: city and uf are required", i+1)
+		}
+		uf := strings.ToUpper(entry.UF)
+		region := entry.Region
+		if region == "" {
+			region = brazilianRegions[uf]
+		}
+		provider.locations[cep] = Location{
+			City:   entry.City,
+			UF:     uf,
+			Region: region,
+			IBGE:   entry.IBGE,
+			DDD:    entry.DDD,
+		}
+	}
+	return provider, nil
+}
+
+func readCSVDataset(r io.Reader) ([]datasetEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["cep"]; !ok {
+		return nil, errors.New("missing cep column")
+	}
+
+	var entries []datasetEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entries = append(entries, datasetEntry{
+			CEP:    field("cep"),
+			City:   field("city"),
+			UF:     field("uf"),
+			Region: field("region"),
+			IBGE:   field("ibge"),
+			DDD:    field("ddd"),
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package serviceb
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+const maxCityNameLength = 100
+
+type CityRequest struct {
+	City string `json:"city"`
+}
+
+// handleWeatherByCity looks up the weather for a city name directly, skipping
+// the CEP resolution.
+func handleWeatherByCity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetName("handle-weather-by-city-request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := negotiateFormat(r); !ok {
+		writeErrorResponse(w, r, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	if _, ok := negotiateSchemaVersion(r); !ok {
+		writeErrorResponse(w, r, "unsupported schema version", http.StatusNotAcceptable)
+		return
+	}
+
+	var req CityRequest
+	if shared.IsFormRequest(r) {
+		if err := r.ParseForm(); err != nil {
+			span.RecordError(err)
+			writeErrorResponse(w, r, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.City = r.FormValue("city")
+	} else if err := decodeJSONBody(r, &req); err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	city := strings.Join(strings.Fields(req.City), " ")
+	if city == "" || utf8.RuneCountInString(city) > maxCityNameLength {
+		writeErrorResponse(w, r, "invalid city", http.StatusUnprocessableEntity)
+		return
+	}
+	span.SetAttributes(attribute.String("city", city))
+	distinct.observeCity(city)
+
+	provider, ok := selectWeatherProvider(r)
+	if !ok {
+		writeErrorResponse(w, r, "invalid weather provider", http.StatusBadRequest)
+		return
+	}
+
+	weather, err := lookupWeather(ctx, provider, &Location{City: city})
+	if err != nil {
+		span.RecordError(err)
+		writeWeatherError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Get("formatted") == "true" {
+		formatTemperatures(weather)
+	}
+	if cfg.ExposeMockFlag {
+		weather.Mock = &weather.IsMock
+	}
+	includeExtraUnits(weather)
+	if r.URL.Query().Get("includeCoords") == "true" {
+		includeCoordinates(weather)
+	}
+	if r.URL.Query().Get("includeMeasuredAt") == "true" {
+		includeMeasuredAt(weather)
+	}
+	if r.URL.Query().Get("extended") == "true" {
+		includeExtended(weather)
+	}
+	encodeResponse(w, r, http.StatusOK, weather)
+}
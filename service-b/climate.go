@@ -0,0 +1,74 @@
+package serviceb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// climateFallbackSource marks responses built from climateNormals instead of
+// live provider data.
+const climateFallbackSource = "climate_fallback"
+
+// climateNormals holds the approximate monthly mean temperature (°C, January
+// to December) of each state's capital, a rough stand-in for the whole UF.
+var climateNormals = map[string][12]float64{
+	"AC": {26.0, 26.1, 26.0, 25.8, 24.8, 23.8, 23.6, 24.8, 25.8, 26.2, 26.2, 26.0},
+	"AL": {27.4, 27.5, 27.4, 26.9, 26.0, 25.0, 24.4, 24.5, 25.3, 26.2, 26.8, 27.1},
+	"AP": {26.6, 26.3, 26.3, 26.5, 26.8, 26.8, 26.9, 27.6, 28.1, 28.3, 28.2, 27.6},
+	"AM": {26.5, 26.4, 26.5, 26.6, 26.9, 27.0, 27.2, 28.0, 28.4, 28.3, 27.8, 27.1},
+	"BA": {26.8, 27.0, 27.1, 26.4, 25.4, 24.5, 23.9, 24.0, 24.8, 25.6, 26.1, 26.5},
+	"CE": {27.5, 27.3, 26.9, 26.8, 26.8, 26.4, 26.2, 26.5, 27.0, 27.4, 27.6, 27.7},
+	"DF": {21.6, 21.8, 21.8, 21.4, 20.3, 19.1, 19.1, 20.9, 22.5, 22.4, 21.6, 21.5},
+	"ES": {27.0, 27.6, 27.3, 26.1, 24.6, 23.5, 22.8, 23.1, 23.6, 24.5, 25.3, 26.3},
+	"GO": {24.0, 24.2, 24.2, 23.8, 22.4, 21.0, 21.1, 23.1, 25.1, 25.0, 24.2, 23.9},
+	"MA": {26.6, 26.3, 26.3, 26.4, 26.6, 26.5, 26.4, 26.8, 27.2, 27.5, 27.6, 27.3},
+	"MT": {27.0, 26.9, 27.0, 26.6, 24.8, 23.4, 23.3, 25.4, 27.5, 27.8, 27.4, 27.0},
+	"MS": {24.9, 24.7, 24.6, 23.4, 21.3, 20.0, 19.9, 21.8, 23.6, 24.5, 24.8, 24.9},
+	"MG": {23.0, 23.4, 23.1, 22.0, 20.2, 19.1, 18.8, 19.7, 21.1, 22.0, 22.4, 22.6},
+	"PA": {26.3, 26.0, 26.1, 26.4, 26.7, 26.7, 26.6, 26.8, 26.9, 27.1, 27.3, 26.9},
+	"PB": {27.3, 27.4, 27.3, 26.9, 26.1, 25.2, 24.6, 24.7, 25.6, 26.4, 26.9, 27.2},
+	"PR": {20.4, 20.6, 19.6, 17.4, 14.8, 13.4, 13.1, 14.3, 15.4, 17.1, 18.9, 19.9},
+	"PE": {27.4, 27.4, 27.3, 26.8, 26.0, 25.1, 24.5, 24.6, 25.5, 26.4, 26.9, 27.2},
+	"PI": {27.2, 26.8, 26.8, 27.0, 27.2, 27.0, 27.1, 28.2, 29.5, 30.1, 29.8, 28.8},
+	"RJ": {26.6, 27.1, 26.6, 25.1, 23.4, 22.2, 21.9, 22.4, 22.7, 23.6, 24.6, 25.8},
+	"RN": {27.3, 27.4, 27.2, 26.9, 26.3, 25.4, 24.8, 24.9, 25.7, 26.4, 26.9, 27.2},
+	"RS": {24.7, 24.6, 23.3, 20.4, 17.2, 14.8, 14.4, 15.6, 17.1, 19.6, 21.6, 23.5},
+	"RO": {25.8, 25.9, 26.0, 26.0, 25.6, 24.8, 24.6, 25.8, 26.6, 26.6, 26.3, 26.0},
+	"RR": {27.6, 27.9, 28.3, 28.3, 27.3, 26.5, 26.3, 26.9, 27.9, 28.5, 28.5, 27.9},
+	"SC": {24.7, 24.9, 24.2, 22.0, 19.5, 17.4, 16.6, 17.2, 18.3, 20.1, 21.8, 23.5},
+	"SP": {22.4, 22.7, 22.0, 20.1, 17.9, 16.7, 16.3, 17.5, 18.1, 19.4, 20.3, 21.5},
+	"SE": {27.2, 27.3, 27.3, 26.9, 26.0, 25.1, 24.5, 24.6, 25.4, 26.2, 26.7, 27.0},
+	"TO": {26.4, 26.4, 26.5, 26.7, 26.7, 25.9, 25.8, 27.2, 28.6, 27.9, 26.9, 26.5},
+}
+
+// climateFallbackWeather returns the climatological average of the location's UF for
+// the current month, used when CLIMATE_FALLBACK=true and no provider could
+// answer. It reports false when the UF is unknown, e.g. for city lookups.
+func climateFallbackWeather(ctx context.Context, location *Location, cause error) (*WeatherResponse, bool) {
+	normals, ok := climateNormals[strings.ToUpper(location.UF)]
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	tempC := normals[now.Month()-1]
+	trace.SpanFromContext(ctx).AddEvent("weather.climate_fallback", trace.WithAttributes(
+		attribute.String("uf", location.UF),
+		attribute.Int("month", int(now.Month())),
+		attribute.String("error", cause.Error()),
+	))
+	weather := &WeatherResponse{
+		City:      location.City,
+		TempC:     tempC,
+		TempF:     celsiusToFahrenheit(tempC),
+		TempK:     celsiusToKelvin(tempC),
+		LocalTime: now.Format(localTimeLayout),
+		Source:    climateFallbackSource,
+	}
+	weather.setFeelsLike(tempC)
+	return weather, true
+}
@@ -0,0 +1,65 @@
+package serviceb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shared/sharedtest"
+)
+
+func TestTTLCacheExpiry(t *testing.T) {
+	fake := sharedtest.UseFakeClock(t)
+	cache := newTTLCache[string](time.Minute)
+	cache.Set("key", "value")
+
+	fake.Advance(40 * time.Second)
+	value, ttl, ok := cache.GetWithTTL("key")
+	if !ok || value != "value" {
+		t.Fatalf("GetWithTTL after 40s = %q, %v; want value, true", value, ok)
+	}
+	if ttl != 20*time.Second {
+		t.Errorf("ttl after 40s = %v, want 20s", ttl)
+	}
+
+	fake.Advance(21 * time.Second)
+	if _, ok := cache.Get("key"); ok {
+		t.Fatal("Get after 61s found the entry, want it expired")
+	}
+	if _, ok := cache.entries["key"]; ok {
+		t.Error("expired entry was not evicted")
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	setupTestService(t)
+	fake := sharedtest.UseFakeClock(t)
+	cfg.CacheRefreshAhead = 10 * time.Second
+	weatherCache = newTTLCache[WeatherResponse](time.Minute)
+	provider := weatherProviders[defaultWeatherProvider]
+	location := &Location{City: "São Paulo", UF: "SP"}
+	key := weatherCacheKey(provider, location)
+	expiresAt := fake.Now().Add(time.Minute)
+
+	// Far from its expiry, the entry is left alone
+	refreshAhead(context.Background(), provider, location, key, expiresAt)
+	if _, refreshing := refreshing.Load(key); refreshing {
+		t.Fatal("refresh started a minute before the expiry")
+	}
+
+	fake.Advance(55 * time.Second)
+	refreshAhead(context.Background(), provider, location, key, expiresAt)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, ok := weatherCache.GetEntry(key); ok {
+			if !entry.storedAt.Equal(fake.Now()) {
+				t.Errorf("refreshed entry stored at %v, want %v", entry.storedAt, fake.Now())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh 5s before the expiry did not store the weather")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
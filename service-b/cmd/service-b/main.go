@@ -0,0 +1,8 @@
+// Command service-b runs Service B on its own.
+package main
+
+import serviceb "service-b"
+
+func main() {
+	serviceb.Main()
+}
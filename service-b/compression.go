@@ -0,0 +1,52 @@
+package serviceb
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// decompressRequests transparently inflates request bodies sent with
+// Content-Encoding: gzip, e.g. large batches, and caps every body at
+// MAX_REQUEST_BYTES once decompressed, so a small gzip bomb cannot expand
+// without bound. Other encodings are rejected with a 415.
+func decompressRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+		case "gzip":
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(attribute.String("http.request.content_encoding", encoding))
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				span.RecordError(err)
+				writeErrorResponse(w, r, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			r.Body = gzipRequestBody{Reader: gz, body: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		default:
+			writeErrorResponse(w, r, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxRequestBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gzipRequestBody reads a request body through its gzip reader and closes both.
+type gzipRequestBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipRequestBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
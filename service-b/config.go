@@ -0,0 +1,1296 @@
+package serviceb
+
+import (
+	"compress/gzip"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"shared"
+)
+
+const (
+	routeNormalizationRewrite  = "rewrite"
+	routeNormalizationRedirect = "redirect"
+	routeNormalizationOff      = "off"
+)
+
+const (
+	responseCEPFormatPlain  = "plain"
+	responseCEPFormatDashed = "dashed"
+)
+
+// Config holds the runtime configuration of Service B, loaded once at startup.
+type Config struct {
+	CacheTTL                  time.Duration
+	SLOLatency                time.Duration
+	SLOLatencyOverrides       map[string]time.Duration
+	RetryMaxAttempts          int
+	RetryBaseDelay            time.Duration
+	FastModeTimeout           time.Duration
+	RedactCEPInTraces         bool
+	ViaCEPRateLimitMaxWait    time.Duration
+	WarmupCEPs                []string
+	WarmupWeather             bool
+	RouteNormalization        string
+	MaxRedirects              int
+	TempFormatDecimals        int
+	CEPProviders              []string
+	LogsExporter              string
+	HandlerTimeout            time.Duration
+	HealthCheckCacheTTL       time.Duration
+	OutboundHTTPProxy         *url.URL
+	MaxConcurrentRequests     int
+	LimiterWaitThreshold      time.Duration
+	DNSResolver               string
+	EnvelopeResponses         bool
+	TrustIncomingTraceContext bool
+	WeatherProviderSplit      map[string]int
+	EnableDebugEndpoints      bool
+	ChaosEnabled              bool
+	ChaosFailureRate          float64
+	ChaosLatency              time.Duration
+	WeatherHedgeDelay         time.Duration
+	TracesSampleRatio         float64
+	DistinctCountWindow       time.Duration
+	DrainTimeout              time.Duration
+	TrustProxy                bool
+	OTelOptional              bool
+	EndpointTimeouts          map[string]time.Duration
+	ExposeMockFlag            bool
+	PrettyJSON                bool
+	RequestBudget             time.Duration
+	RedisOptions              *redis.Options
+	ForwardHeaders            []string
+	MaxUpstreamBytes          int64
+	FeatureFlags              map[string]bool
+	GRPCAddr                  string
+	WeatherAPIKeyFile         string
+	AggregateWeather          bool
+	SLOAvailabilityTarget     float64
+	SLOBurnWindows            []time.Duration
+	SLOBurnRateThreshold      float64
+	MaxBatchSize              int
+	TracesExporters           []string
+	TempSanityMinC            float64
+	TempSanityMaxC            float64
+	MinRequestTimeout         time.Duration
+	MaxRequestTimeout         time.Duration
+	AuditLogLevel             slog.Level
+	AuditLogChannel           string
+	AuditLogRedactCEP         bool
+	MinHTTPMajor              int
+	MinHTTPMinor              int
+	ClimateFallback           bool
+	DisabledEndpoints         []string
+	WeatherBulk               bool
+	GzipLevel                 int
+	PodName                   string
+	UpstreamFailureThreshold  float64
+	UpstreamFailureWindow     time.Duration
+	WeatherProviderTimeout    time.Duration
+	TraceHeaders              bool
+	TraceHeadersAllowlist     []string
+	ShedLatencyTarget         time.Duration
+	StrictJSON                bool
+	CacheMinTTL               time.Duration
+	CacheMaxTTL               time.Duration
+	CacheRefreshAhead         time.Duration
+	StreamInterval            time.Duration
+	WeatherValidateKeyOnStart bool
+	UnassignedCEPPrefixes     []string
+	EnablePprof               bool
+	PprofAddr                 string
+	RetryAfterJitter          time.Duration
+	CEPDatasetFile            string
+	OfflineOnly               bool
+	CEPStageBudgetPct         int
+	MetricsExemplars          bool
+	WeatherMaxConcurrent      int
+	TempCalibrationOffsetC    float64
+	WriteTimeout              time.Duration
+	OTLPInsecure              bool
+	OTLPCertificate           string
+	OTLPRootCAs               *x509.CertPool
+	RequestIDFormat           string
+	RequireSampledTrace       bool
+	MaxLocationLength         int
+	HealthCheckTimeout        time.Duration
+	HealthCheckDeadline       time.Duration
+	ResponseCEPFormat         string
+	MaxBatchJobSize           int
+	BatchJobRetention         time.Duration
+	MaxBatchJobs              int
+	TrustSamplingPriority     bool
+	MaxSSEStreams             int
+	MaxResponseBytes          int
+	DeployEnv                 string
+	LogLevel                  slog.Level
+	MockWeatherSpan           bool
+	MaxRequestBytes           int64
+	MockTempC                 float64
+	SetGlobalOTel             bool
+	StrictRegionMatch         bool
+	TempExtraUnits            []string
+	MaxBatchResponseBytes     int64
+	ResponseSchemaVersion     string
+}
+
+var cfg *Config
+
+func loadConfig() (*Config, error) {
+	cacheTTL, err := getEnvDuration("CACHE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if cacheTTL < 0 {
+		return nil, fmt.Errorf("CACHE_TTL must not be negative, got %s", cacheTTL)
+	}
+
+	sloLatency, err := getEnvMillis("SLO_LATENCY_MS", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	sloOverrides, err := getEnvMillisMap("SLO_LATENCY_OVERRIDES")
+	if err != nil {
+		return nil, err
+	}
+
+	retryMaxAttempts, err := getEnvInt("RETRY_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return nil, err
+	}
+	if retryMaxAttempts < 1 {
+		return nil, fmt.Errorf("RETRY_MAX_ATTEMPTS must be at least 1, got %d", retryMaxAttempts)
+	}
+	retryBaseDelay, err := getEnvDuration("RETRY_BASE_DELAY", 200*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	fastModeTimeout, err := getEnvDuration("FAST_MODE_TIMEOUT", 300*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	redactCEP, err := getEnvBool("REDACT_CEP_IN_TRACES", false)
+	if err != nil {
+		return nil, err
+	}
+
+	viaCEPRateLimitMaxWait, err := getEnvDuration("VIACEP_RATE_LIMIT_MAX_WAIT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	warmupWeather, err := getEnvBool("WARMUP_WEATHER", false)
+	if err != nil {
+		return nil, err
+	}
+
+	routeNormalization := os.Getenv("ROUTE_NORMALIZATION")
+	switch routeNormalization {
+	case "":
+		routeNormalization = routeNormalizationRewrite
+	case routeNormalizationRewrite, routeNormalizationRedirect, routeNormalizationOff:
+	default:
+		return nil, fmt.Errorf("invalid ROUTE_NORMALIZATION %q: must be rewrite, redirect or off", routeNormalization)
+	}
+
+	maxRedirects, err := getEnvInt("MAX_REDIRECTS", 3)
+	if err != nil {
+		return nil, err
+	}
+	if maxRedirects < 0 {
+		return nil, fmt.Errorf("MAX_REDIRECTS must not be negative, got %d", maxRedirects)
+	}
+
+	tempFormatDecimals, err := getEnvInt("TEMP_FORMAT_DECIMALS", 1)
+	if err != nil {
+		return nil, err
+	}
+	if tempFormatDecimals < 0 || tempFormatDecimals > 6 {
+		return nil, fmt.Errorf("TEMP_FORMAT_DECIMALS must be between 0 and 6, got %d", tempFormatDecimals)
+	}
+
+	cepProviders := getEnvList("CEP_PROVIDERS")
+	if len(cepProviders) == 0 {
+		cepProviders = []string{"viacep"}
+	}
+
+	logsExporter := os.Getenv("OTEL_LOGS_EXPORTER")
+	switch logsExporter {
+	case "", "none":
+		logsExporter = "none"
+	case logsExporterOTLP:
+	default:
+		return nil, fmt.Errorf("invalid OTEL_LOGS_EXPORTER %q: must be otlp or none", logsExporter)
+	}
+
+	handlerTimeout, err := getEnvDuration("HANDLER_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if handlerTimeout < 0 {
+		return nil, fmt.Errorf("HANDLER_TIMEOUT must not be negative, got %s", handlerTimeout)
+	}
+
+	healthCheckCacheTTL, err := getEnvDuration("HEALTH_CHECK_CACHE_TTL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	var outboundHTTPProxy *url.URL
+	if value := os.Getenv("OUTBOUND_HTTP_PROXY"); value != "" {
+		outboundHTTPProxy, err = url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OUTBOUND_HTTP_PROXY %q: %w", value, err)
+		}
+		switch outboundHTTPProxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid OUTBOUND_HTTP_PROXY %q: scheme must be http, https or socks5", outboundHTTPProxy.Redacted())
+		}
+		if outboundHTTPProxy.Host == "" {
+			return nil, fmt.Errorf("invalid OUTBOUND_HTTP_PROXY %q: missing host", outboundHTTPProxy.Redacted())
+		}
+	}
+
+	maxConcurrentRequests, err := getEnvInt("MAX_CONCURRENT_REQUESTS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxConcurrentRequests < 0 {
+		return nil, fmt.Errorf("MAX_CONCURRENT_REQUESTS must not be negative, got %d", maxConcurrentRequests)
+	}
+	limiterWaitThreshold, err := getEnvDuration("LIMITER_WAIT_THRESHOLD", 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsResolver := os.Getenv("DNS_RESOLVER")
+	if dnsResolver != "" {
+		// A bare address uses the standard DNS port
+		if _, _, err := net.SplitHostPort(dnsResolver); err != nil {
+			dnsResolver = net.JoinHostPort(dnsResolver, "53")
+		}
+		if host, _, _ := net.SplitHostPort(dnsResolver); net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid DNS_RESOLVER %q: must be an IP address, optionally with a port", os.Getenv("DNS_RESOLVER"))
+		}
+	}
+
+	envelopeResponses, err := getEnvBool("ENVELOPE_RESPONSES", false)
+	if err != nil {
+		return nil, err
+	}
+
+	trustIncomingTraceContext, err := getEnvBool("TRUST_INCOMING_TRACE_CONTEXT", true)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherProviderSplit, err := getEnvPercentMap("WEATHER_PROVIDER_SPLIT")
+	if err != nil {
+		return nil, err
+	}
+	for name := range weatherProviderSplit {
+		if _, ok := weatherProviders[name]; !ok {
+			return nil, fmt.Errorf("invalid WEATHER_PROVIDER_SPLIT: unknown weather provider %q", name)
+		}
+	}
+
+	enableDebugEndpoints, err := getEnvBool("ENABLE_DEBUG_ENDPOINTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	chaosEnabled, err := getEnvBool("CHAOS_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	chaosFailureRate, err := getEnvFloat("CHAOS_FAILURE_RATE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if chaosFailureRate < 0 || chaosFailureRate > 1 {
+		return nil, fmt.Errorf("CHAOS_FAILURE_RATE must be between 0.0 and 1.0, got %g", chaosFailureRate)
+	}
+	chaosLatency, err := getEnvMillis("CHAOS_LATENCY_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if !chaosEnabled && (chaosFailureRate > 0 || chaosLatency > 0) {
+		log.Printf("Ignoring CHAOS_FAILURE_RATE and CHAOS_LATENCY_MS: failure injection requires CHAOS_ENABLED=true")
+		chaosFailureRate, chaosLatency = 0, 0
+	}
+
+	weatherHedgeDelay, err := getEnvMillis("WEATHER_HEDGE_DELAY_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	deployEnv, preset, err := shared.LoadDeployPreset()
+	if err != nil {
+		return nil, err
+	}
+	logLevel := preset.LogLevel
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := logLevel.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be DEBUG, INFO, WARN or ERROR", value)
+		}
+	}
+
+	tracesSampleRatio, err := getEnvFloat("TRACES_SAMPLE_RATIO", preset.TracesSampleRatio)
+	if err != nil {
+		return nil, err
+	}
+	if tracesSampleRatio < 0 || tracesSampleRatio > 1 {
+		return nil, fmt.Errorf("TRACES_SAMPLE_RATIO must be between 0.0 and 1.0, got %g", tracesSampleRatio)
+	}
+
+	distinctCountWindow, err := getEnvDuration("DISTINCT_COUNT_WINDOW", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	drainTimeout, err := getEnvDuration("DRAIN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	trustProxy, err := getEnvBool("TRUST_PROXY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	otelOptional, err := getEnvBool("OTEL_OPTIONAL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointTimeouts, err := getEnvDurationMap("ENDPOINT_TIMEOUTS")
+	if err != nil {
+		return nil, err
+	}
+
+	exposeMockFlag, err := getEnvBool("EXPOSE_MOCK_FLAG", false)
+	if err != nil {
+		return nil, err
+	}
+
+	prettyJSON, err := getEnvBool("PRETTY_JSON", false)
+	if err != nil {
+		return nil, err
+	}
+
+	requestBudget, err := getEnvDuration("REQUEST_BUDGET", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// REDIS_URL shares the location and weather caches between instances
+	var redisOptions *redis.Options
+	if value := os.Getenv("REDIS_URL"); value != "" {
+		redisOptions, err = redis.ParseURL(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+	}
+
+	var forwardHeaders []string
+	for _, name := range getEnvList("FORWARD_HEADERS") {
+		forwardHeaders = append(forwardHeaders, http.CanonicalHeaderKey(name))
+	}
+
+	maxUpstreamBytes, err := getEnvInt("MAX_UPSTREAM_BYTES", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxUpstreamBytes <= 0 {
+		return nil, fmt.Errorf("MAX_UPSTREAM_BYTES must be positive, got %d", maxUpstreamBytes)
+	}
+
+	flags, err := parseFeatureFlags(os.Getenv("FEATURE_FLAGS"))
+	if err != nil {
+		return nil, err
+	}
+
+	grpcAddr := os.Getenv("GRPC_ADDR")
+
+	weatherAPIKeyFile := os.Getenv("WEATHER_API_KEY_FILE")
+
+	aggregateWeather, err := getEnvBool("AGGREGATE_WEATHER", false)
+	if err != nil {
+		return nil, err
+	}
+
+	sloAvailabilityTarget, err := getEnvFloat("SLO_AVAILABILITY_TARGET", 0.999)
+	if err != nil {
+		return nil, err
+	}
+	if sloAvailabilityTarget <= 0 || sloAvailabilityTarget >= 1 {
+		return nil, fmt.Errorf("SLO_AVAILABILITY_TARGET must be between 0.0 and 1.0 (exclusive), got %g", sloAvailabilityTarget)
+	}
+
+	sloBurnWindows := []time.Duration{5 * time.Minute, time.Hour}
+	if windows := getEnvList("SLO_BURN_WINDOWS"); len(windows) > 0 {
+		sloBurnWindows = nil
+		for _, value := range windows {
+			window, err := time.ParseDuration(value)
+			if err != nil || window < shared.BurnBucketWidth {
+				return nil, fmt.Errorf("invalid SLO_BURN_WINDOWS entry %q: must be a duration of at least %s", value, shared.BurnBucketWidth)
+			}
+			sloBurnWindows = append(sloBurnWindows, window)
+		}
+	}
+
+	sloBurnRateThreshold, err := getEnvFloat("SLO_BURN_RATE_THRESHOLD", 14.4)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBatchSize, err := getEnvInt("MAX_BATCH_SIZE", 20)
+	if err != nil {
+		return nil, err
+	}
+	if maxBatchSize < 1 {
+		return nil, fmt.Errorf("MAX_BATCH_SIZE must be at least 1, got %d", maxBatchSize)
+	}
+
+	tracesExporters := getEnvList("OTEL_TRACES_EXPORTER")
+	if len(tracesExporters) == 0 {
+		tracesExporters = []string{"otlp"}
+	}
+	for _, name := range tracesExporters {
+		if !traceExporterNames[name] {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER entry %q: must be otlp, zipkin or console", name)
+		}
+	}
+
+	tempSanityMinC, err := getEnvFloat("TEMP_SANITY_MIN_C", -90)
+	if err != nil {
+		return nil, err
+	}
+	tempSanityMaxC, err := getEnvFloat("TEMP_SANITY_MAX_C", 60)
+	if err != nil {
+		return nil, err
+	}
+	if tempSanityMinC >= tempSanityMaxC {
+		return nil, fmt.Errorf("TEMP_SANITY_MIN_C must be below TEMP_SANITY_MAX_C, got %g and %g", tempSanityMinC, tempSanityMaxC)
+	}
+
+	minRequestTimeout, err := getEnvDuration("MIN_REQUEST_TIMEOUT", 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	maxRequestTimeout, err := getEnvDuration("MAX_REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if minRequestTimeout <= 0 || minRequestTimeout > maxRequestTimeout {
+		return nil, fmt.Errorf("MIN_REQUEST_TIMEOUT must be positive and at most MAX_REQUEST_TIMEOUT, got %s and %s", minRequestTimeout, maxRequestTimeout)
+	}
+
+	auditLogLevel := slog.LevelInfo
+	if value := os.Getenv("AUDIT_LOG_LEVEL"); value != "" {
+		if err := auditLogLevel.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid AUDIT_LOG_LEVEL %q: must be DEBUG, INFO, WARN or ERROR", value)
+		}
+	}
+	auditLogChannel := os.Getenv("AUDIT_LOG_CHANNEL")
+	if auditLogChannel == "" {
+		auditLogChannel = "audit"
+	}
+	auditLogRedactCEP, err := getEnvBool("AUDIT_LOG_REDACT_CEP", false)
+	if err != nil {
+		return nil, err
+	}
+
+	minHTTPMajor, minHTTPMinor := 0, 0
+	if value := os.Getenv("MIN_HTTP_VERSION"); value != "" {
+		var ok bool
+		if minHTTPMajor, minHTTPMinor, ok = http.ParseHTTPVersion("HTTP/" + value); !ok {
+			return nil, fmt.Errorf("invalid MIN_HTTP_VERSION %q: must be a version like 1.1", value)
+		}
+	}
+
+	climateFallback, err := getEnvBool("CLIMATE_FALLBACK", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var disabledEndpoints []string
+	for _, path := range getEnvList("DISABLED_ENDPOINTS") {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid DISABLED_ENDPOINTS entry %q: must be a path like /location", path)
+		}
+		disabledEndpoints = append(disabledEndpoints, path)
+	}
+
+	weatherBulk, err := getEnvBool("WEATHER_BULK", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// An invalid level only costs efficiency, so it falls back instead of failing
+	gzipLevel, err := getEnvInt("GZIP_LEVEL", shared.DefaultGzipLevel)
+	if err != nil || gzipLevel < gzip.BestSpeed || gzipLevel > gzip.BestCompression {
+		slog.Warn("invalid GZIP_LEVEL, using the default", "value", os.Getenv("GZIP_LEVEL"), "default", shared.DefaultGzipLevel)
+		gzipLevel = shared.DefaultGzipLevel
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName = os.Getenv("HOSTNAME")
+	}
+
+	upstreamFailureThreshold, err := getEnvFloat("UPSTREAM_FAILURE_THRESHOLD", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	if upstreamFailureThreshold <= 0 || upstreamFailureThreshold > 1 {
+		return nil, fmt.Errorf("UPSTREAM_FAILURE_THRESHOLD must be between 0.0 (exclusive) and 1.0, got %g", upstreamFailureThreshold)
+	}
+	upstreamFailureWindow, err := getEnvDuration("UPSTREAM_FAILURE_WINDOW", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if upstreamFailureWindow < upstreamHealthBucketWidth {
+		return nil, fmt.Errorf("UPSTREAM_FAILURE_WINDOW must be at least %s, got %s", upstreamHealthBucketWidth, upstreamFailureWindow)
+	}
+
+	weatherProviderTimeout, err := getEnvDuration("WEATHER_PROVIDER_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if weatherProviderTimeout < 0 {
+		return nil, fmt.Errorf("WEATHER_PROVIDER_TIMEOUT must not be negative, got %s", weatherProviderTimeout)
+	}
+
+	traceHeaders, err := getEnvBool("TRACE_HEADERS", false)
+	if err != nil {
+		return nil, err
+	}
+	traceHeadersAllowlist := shared.DefaultTraceHeaders
+	if names := getEnvList("TRACE_HEADERS_ALLOWLIST"); len(names) > 0 {
+		traceHeadersAllowlist = nil
+		for _, name := range names {
+			traceHeadersAllowlist = append(traceHeadersAllowlist, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	shedLatencyTarget, err := getEnvMillis("SHED_LATENCY_TARGET_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	strictJSON, err := getEnvBool("STRICT_JSON", false)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMinTTL, err := getEnvDuration("CACHE_MIN_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+	cacheMaxTTL, err := getEnvDuration("CACHE_MAX_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cacheMinTTL < 0 || cacheMaxTTL < 0 {
+		return nil, fmt.Errorf("CACHE_MIN_TTL and CACHE_MAX_TTL must not be negative, got %s and %s", cacheMinTTL, cacheMaxTTL)
+	}
+	if cacheMaxTTL > 0 && cacheMinTTL > cacheMaxTTL {
+		return nil, fmt.Errorf("CACHE_MIN_TTL (%s) must not exceed CACHE_MAX_TTL (%s)", cacheMinTTL, cacheMaxTTL)
+	}
+
+	cacheRefreshAhead, err := getEnvDuration("CACHE_REFRESH_AHEAD", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cacheRefreshAhead < 0 {
+		return nil, fmt.Errorf("CACHE_REFRESH_AHEAD must not be negative, got %s", cacheRefreshAhead)
+	}
+
+	streamInterval, err := getEnvDuration("STREAM_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if streamInterval < minStreamInterval {
+		return nil, fmt.Errorf("STREAM_INTERVAL must be at least %s, got %s", minStreamInterval, streamInterval)
+	}
+
+	weatherValidateKeyOnStart, err := getEnvBool("WEATHER_VALIDATE_KEY_ON_START", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// CEPs starting with 00 are not assigned to any region
+	unassignedCEPPrefixes := []string{"00"}
+	if _, ok := os.LookupEnv("UNASSIGNED_CEP_PREFIXES"); ok {
+		unassignedCEPPrefixes = getEnvList("UNASSIGNED_CEP_PREFIXES")
+	}
+	for _, prefix := range unassignedCEPPrefixes {
+		if len(prefix) > 8 || strings.Trim(prefix, "0123456789") != "" {
+			return nil, fmt.Errorf("invalid UNASSIGNED_CEP_PREFIXES entry %q: must be up to 8 digits", prefix)
+		}
+	}
+
+	enablePprof, err := getEnvBool("ENABLE_PPROF", false)
+	if err != nil {
+		return nil, err
+	}
+	pprofAddr := os.Getenv("PPROF_ADDR")
+	if pprofAddr == "" {
+		pprofAddr = "localhost:6061"
+	}
+
+	retryAfterJitter, err := getEnvDuration("RETRY_AFTER_JITTER", 0)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfterJitter < 0 {
+		return nil, fmt.Errorf("RETRY_AFTER_JITTER must not be negative, got %s", retryAfterJitter)
+	}
+
+	cepDatasetFile := os.Getenv("CEP_DATASET_FILE")
+	offlineOnly, err := getEnvBool("OFFLINE_ONLY", false)
+	if err != nil {
+		return nil, err
+	}
+	if offlineOnly && cepDatasetFile == "" {
+		return nil, errors.New("OFFLINE_ONLY=true requires CEP_DATASET_FILE")
+	}
+
+	cepStageBudgetPct, err := getEnvInt("CEP_STAGE_BUDGET_PCT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cepStageBudgetPct < 0 || cepStageBudgetPct >= 100 {
+		return nil, fmt.Errorf("CEP_STAGE_BUDGET_PCT must be between 0 and 99, got %d", cepStageBudgetPct)
+	}
+
+	metricsExemplars, err := getEnvBool("METRICS_EXEMPLARS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherMaxConcurrent, err := getEnvInt("WEATHER_MAX_CONCURRENT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if weatherMaxConcurrent < 0 {
+		return nil, fmt.Errorf("WEATHER_MAX_CONCURRENT must not be negative, got %d", weatherMaxConcurrent)
+	}
+
+	tempCalibrationOffsetC, err := getEnvFloat("TEMP_CALIBRATION_OFFSET_C", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	writeTimeout, err := getEnvDuration("WRITE_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if writeTimeout <= 0 {
+		return nil, fmt.Errorf("WRITE_TIMEOUT must be positive, got %s", writeTimeout)
+	}
+	// The handler timeout's 503 could never be written otherwise
+	if handlerTimeout > 0 && writeTimeout <= handlerTimeout {
+		return nil, fmt.Errorf("WRITE_TIMEOUT must be longer than HANDLER_TIMEOUT, got %s and %s", writeTimeout, handlerTimeout)
+	}
+
+	// A collector reached over https:// is expected to speak TLS
+	otlpInsecure, err := getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", !strings.HasPrefix(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "https://"))
+	if err != nil {
+		return nil, err
+	}
+	otlpCertificate := os.Getenv("OTEL_EXPORTER_OTLP_CERTIFICATE")
+	var otlpRootCAs *x509.CertPool
+	if otlpCertificate != "" {
+		if otlpInsecure {
+			return nil, errors.New("OTEL_EXPORTER_OTLP_CERTIFICATE requires OTEL_EXPORTER_OTLP_INSECURE=false")
+		}
+		if otlpRootCAs, err = shared.LoadOTLPCertificate(otlpCertificate); err != nil {
+			return nil, err
+		}
+	}
+
+	requestIDFormat := os.Getenv("REQUEST_ID_FORMAT")
+	switch requestIDFormat {
+	case "":
+		requestIDFormat = shared.RequestIDFormatUUID
+	case shared.RequestIDFormatUUID, shared.RequestIDFormatULID, shared.RequestIDFormatTrace:
+	default:
+		return nil, fmt.Errorf("invalid REQUEST_ID_FORMAT %q: must be uuid, ulid or trace", requestIDFormat)
+	}
+
+	requireSampledTrace, err := getEnvBool("REQUIRE_SAMPLED_TRACE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLocationLength, err := getEnvInt("MAX_LOCATION_LENGTH", 200)
+	if err != nil {
+		return nil, err
+	}
+	if maxLocationLength <= 0 {
+		return nil, fmt.Errorf("MAX_LOCATION_LENGTH must be positive, got %d", maxLocationLength)
+	}
+
+	healthCheckTimeout, err := getEnvDuration("HEALTH_CHECK_TIMEOUT", 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if healthCheckTimeout <= 0 {
+		return nil, fmt.Errorf("HEALTH_CHECK_TIMEOUT must be positive, got %s", healthCheckTimeout)
+	}
+	healthCheckDeadline, err := getEnvDuration("HEALTH_CHECK_DEADLINE", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if healthCheckDeadline <= 0 {
+		return nil, fmt.Errorf("HEALTH_CHECK_DEADLINE must be positive, got %s", healthCheckDeadline)
+	}
+
+	responseCEPFormat := os.Getenv("RESPONSE_CEP_FORMAT")
+	switch responseCEPFormat {
+	case "":
+		responseCEPFormat = responseCEPFormatPlain
+	case responseCEPFormatPlain, responseCEPFormatDashed:
+	default:
+		return nil, fmt.Errorf("invalid RESPONSE_CEP_FORMAT %q: must be plain or dashed", responseCEPFormat)
+	}
+
+	maxBatchJobSize, err := getEnvInt("MAX_BATCH_JOB_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if maxBatchJobSize < 1 {
+		return nil, fmt.Errorf("MAX_BATCH_JOB_SIZE must be at least 1, got %d", maxBatchJobSize)
+	}
+
+	batchJobRetention, err := getEnvDuration("BATCH_JOB_RETENTION", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if batchJobRetention <= 0 {
+		return nil, fmt.Errorf("BATCH_JOB_RETENTION must be positive, got %s", batchJobRetention)
+	}
+
+	maxBatchJobs, err := getEnvInt("MAX_BATCH_JOBS", 10)
+	if err != nil {
+		return nil, err
+	}
+	if maxBatchJobs < 0 {
+		return nil, fmt.Errorf("MAX_BATCH_JOBS must not be negative, got %d", maxBatchJobs)
+	}
+
+	trustSamplingPriority, err := getEnvBool("TRUST_SAMPLING_PRIORITY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSSEStreams, err := getEnvInt("MAX_SSE_STREAMS", 100)
+	if err != nil {
+		return nil, err
+	}
+	if maxSSEStreams < 0 {
+		return nil, fmt.Errorf("MAX_SSE_STREAMS must not be negative, got %d", maxSSEStreams)
+	}
+
+	maxResponseBytes, err := getEnvInt("MAX_RESPONSE_BYTES", 10<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxResponseBytes <= 0 {
+		return nil, fmt.Errorf("MAX_RESPONSE_BYTES must be positive, got %d", maxResponseBytes)
+	}
+
+	mockWeatherSpan, err := getEnvBool("MOCK_WEATHER_SPAN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRequestBytes, err := getEnvInt("MAX_REQUEST_BYTES", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxRequestBytes <= 0 {
+		return nil, fmt.Errorf("MAX_REQUEST_BYTES must be positive, got %d", maxRequestBytes)
+	}
+
+	mockTempC, err := getEnvFloat("MOCK_TEMP_C", 22.5)
+	if err != nil {
+		return nil, err
+	}
+	if mockTempC < tempSanityMinC || mockTempC > tempSanityMaxC {
+		return nil, fmt.Errorf("MOCK_TEMP_C must be between TEMP_SANITY_MIN_C and TEMP_SANITY_MAX_C, got %g", mockTempC)
+	}
+
+	setGlobalOTel, err := getEnvBool("SET_GLOBAL_OTEL", true)
+	if err != nil {
+		return nil, err
+	}
+
+	strictRegionMatch, err := getEnvBool("STRICT_REGION_MATCH", false)
+	if err != nil {
+		return nil, err
+	}
+
+	tempExtraUnits := getEnvList("TEMP_EXTRA_UNITS")
+	for i, unit := range tempExtraUnits {
+		tempExtraUnits[i] = strings.ToLower(unit)
+		switch tempExtraUnits[i] {
+		case unitRankine, unitReaumur:
+		default:
+			return nil, fmt.Errorf("invalid TEMP_EXTRA_UNITS entry %q: must be rankine or reaumur", unit)
+		}
+	}
+
+	maxBatchResponseBytes, err := getEnvInt("MAX_BATCH_RESPONSE_BYTES", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxBatchResponseBytes < 0 {
+		return nil, fmt.Errorf("MAX_BATCH_RESPONSE_BYTES must not be negative, got %d", maxBatchResponseBytes)
+	}
+
+	responseSchemaVersion := latestSchemaVersion
+	if value := os.Getenv("RESPONSE_SCHEMA_VERSION"); value != "" {
+		var ok bool
+		if responseSchemaVersion, ok = parseSchemaVersion(value); !ok {
+			return nil, fmt.Errorf("invalid RESPONSE_SCHEMA_VERSION %q: must be 1 or 2", value)
+		}
+	}
+
+	return &Config{
+		CacheTTL:                  cacheTTL,
+		SLOLatency:                sloLatency,
+		SLOLatencyOverrides:       sloOverrides,
+		RetryMaxAttempts:          retryMaxAttempts,
+		RetryBaseDelay:            retryBaseDelay,
+		FastModeTimeout:           fastModeTimeout,
+		RedactCEPInTraces:         redactCEP,
+		ViaCEPRateLimitMaxWait:    viaCEPRateLimitMaxWait,
+		WarmupCEPs:                getEnvList("WARMUP_CEPS"),
+		WarmupWeather:             warmupWeather,
+		RouteNormalization:        routeNormalization,
+		MaxRedirects:              maxRedirects,
+		TempFormatDecimals:        tempFormatDecimals,
+		CEPProviders:              cepProviders,
+		LogsExporter:              logsExporter,
+		HandlerTimeout:            handlerTimeout,
+		HealthCheckCacheTTL:       healthCheckCacheTTL,
+		OutboundHTTPProxy:         outboundHTTPProxy,
+		MaxConcurrentRequests:     maxConcurrentRequests,
+		LimiterWaitThreshold:      limiterWaitThreshold,
+		DNSResolver:               dnsResolver,
+		EnvelopeResponses:         envelopeResponses,
+		TrustIncomingTraceContext: trustIncomingTraceContext,
+		WeatherProviderSplit:      weatherProviderSplit,
+		EnableDebugEndpoints:      enableDebugEndpoints,
+		ChaosEnabled:              chaosEnabled,
+		ChaosFailureRate:          chaosFailureRate,
+		ChaosLatency:              chaosLatency,
+		WeatherHedgeDelay:         weatherHedgeDelay,
+		TracesSampleRatio:         tracesSampleRatio,
+		DistinctCountWindow:       distinctCountWindow,
+		DrainTimeout:              drainTimeout,
+		TrustProxy:                trustProxy,
+		OTelOptional:              otelOptional,
+		EndpointTimeouts:          endpointTimeouts,
+		ExposeMockFlag:            exposeMockFlag,
+		PrettyJSON:                prettyJSON,
+		RequestBudget:             requestBudget,
+		RedisOptions:              redisOptions,
+		ForwardHeaders:            forwardHeaders,
+		MaxUpstreamBytes:          int64(maxUpstreamBytes),
+		FeatureFlags:              flags,
+		GRPCAddr:                  grpcAddr,
+		WeatherAPIKeyFile:         weatherAPIKeyFile,
+		AggregateWeather:          aggregateWeather,
+		SLOAvailabilityTarget:     sloAvailabilityTarget,
+		SLOBurnWindows:            sloBurnWindows,
+		SLOBurnRateThreshold:      sloBurnRateThreshold,
+		MaxBatchSize:              maxBatchSize,
+		TracesExporters:           tracesExporters,
+		TempSanityMinC:            tempSanityMinC,
+		TempSanityMaxC:            tempSanityMaxC,
+		MinRequestTimeout:         minRequestTimeout,
+		MaxRequestTimeout:         maxRequestTimeout,
+		AuditLogLevel:             auditLogLevel,
+		AuditLogChannel:           auditLogChannel,
+		AuditLogRedactCEP:         auditLogRedactCEP,
+		MinHTTPMajor:              minHTTPMajor,
+		MinHTTPMinor:              minHTTPMinor,
+		ClimateFallback:           climateFallback,
+		DisabledEndpoints:         disabledEndpoints,
+		WeatherBulk:               weatherBulk,
+		GzipLevel:                 gzipLevel,
+		PodName:                   podName,
+		UpstreamFailureThreshold:  upstreamFailureThreshold,
+		UpstreamFailureWindow:     upstreamFailureWindow,
+		WeatherProviderTimeout:    weatherProviderTimeout,
+		TraceHeaders:              traceHeaders,
+		TraceHeadersAllowlist:     traceHeadersAllowlist,
+		ShedLatencyTarget:         shedLatencyTarget,
+		StrictJSON:                strictJSON,
+		CacheMinTTL:               cacheMinTTL,
+		CacheMaxTTL:               cacheMaxTTL,
+		CacheRefreshAhead:         cacheRefreshAhead,
+		StreamInterval:            streamInterval,
+		WeatherValidateKeyOnStart: weatherValidateKeyOnStart,
+		UnassignedCEPPrefixes:     unassignedCEPPrefixes,
+		EnablePprof:               enablePprof,
+		PprofAddr:                 pprofAddr,
+		RetryAfterJitter:          retryAfterJitter,
+		CEPDatasetFile:            cepDatasetFile,
+		OfflineOnly:               offlineOnly,
+		CEPStageBudgetPct:         cepStageBudgetPct,
+		MetricsExemplars:          metricsExemplars,
+		WeatherMaxConcurrent:      weatherMaxConcurrent,
+		TempCalibrationOffsetC:    tempCalibrationOffsetC,
+		WriteTimeout:              writeTimeout,
+		OTLPInsecure:              otlpInsecure,
+		OTLPCertificate:           otlpCertificate,
+		OTLPRootCAs:               otlpRootCAs,
+		RequestIDFormat:           requestIDFormat,
+		RequireSampledTrace:       requireSampledTrace,
+		MaxLocationLength:         maxLocationLength,
+		HealthCheckTimeout:        healthCheckTimeout,
+		HealthCheckDeadline:       healthCheckDeadline,
+		ResponseCEPFormat:         responseCEPFormat,
+		MaxBatchJobSize:           maxBatchJobSize,
+		BatchJobRetention:         batchJobRetention,
+		MaxBatchJobs:              maxBatchJobs,
+		TrustSamplingPriority:     trustSamplingPriority,
+		MaxSSEStreams:             maxSSEStreams,
+		MaxResponseBytes:          maxResponseBytes,
+		DeployEnv:                 deployEnv,
+		LogLevel:                  logLevel,
+		MockWeatherSpan:           mockWeatherSpan,
+		MaxRequestBytes:           int64(maxRequestBytes),
+		MockTempC:                 mockTempC,
+		SetGlobalOTel:             setGlobalOTel,
+		StrictRegionMatch:         strictRegionMatch,
+		TempExtraUnits:            tempExtraUnits,
+		MaxBatchResponseBytes:     int64(maxBatchResponseBytes),
+		ResponseSchemaVersion:     responseSchemaVersion,
+	}, nil
+}
+
+// logEffective logs the configuration the process runs with as a single
+// SLO returns the availability objective set by the SLO_* variables.
+func (c *Config) SLO() shared.SLO {
+	return shared.SLO{
+		AvailabilityTarget: c.SLOAvailabilityTarget,
+		BurnWindows:        c.SLOBurnWindows,
+		BurnRateThreshold:  c.SLOBurnRateThreshold,
+	}
+}
+
+// structured line. Secrets are never logged, only whether they are set.
+func (c *Config) logEffective(listenAddr string) {
+	proxy := ""
+	if c.OutboundHTTPProxy != nil {
+		proxy = c.OutboundHTTPProxy.Redacted()
+	}
+	redisAddr := ""
+	if c.RedisOptions != nil {
+		redisAddr = c.RedisOptions.Addr
+	}
+	weatherAPIKey := currentWeatherAPIKey()
+
+	slog.Info("effective configuration",
+		"listen_addr", listenAddr,
+		"otlp_endpoint", otlpEndpoint(),
+		"traces_sampler", tracesSampler(),
+		"logs_exporter", c.LogsExporter,
+		"cep_providers", c.CEPProviders,
+		"weather_provider_split", c.WeatherProviderSplit,
+		"weather_api_key_set", weatherAPIKey != "" && weatherAPIKey != "your_weather_api_key_here",
+		"openweathermap_api_key_set", os.Getenv("OPENWEATHERMAP_API_KEY") != "",
+		"cache_ttl", c.CacheTTL,
+		"redis_addr", redisAddr,
+		"health_check_cache_ttl", c.HealthCheckCacheTTL,
+		"handler_timeout", c.HandlerTimeout,
+		"fast_mode_timeout", c.FastModeTimeout,
+		"slo_latency", c.SLOLatency,
+		"slo_latency_overrides", c.SLOLatencyOverrides,
+		"retry_max_attempts", c.RetryMaxAttempts,
+		"retry_base_delay", c.RetryBaseDelay,
+		"viacep_rate_limit_max_wait", c.ViaCEPRateLimitMaxWait,
+		"max_redirects", c.MaxRedirects,
+		"max_concurrent_requests", c.MaxConcurrentRequests,
+		"limiter_wait_threshold", c.LimiterWaitThreshold,
+		"outbound_http_proxy", proxy,
+		"dns_resolver", c.DNSResolver,
+		"redact_cep_in_traces", c.RedactCEPInTraces,
+		"trust_incoming_trace_context", c.TrustIncomingTraceContext,
+		"route_normalization", c.RouteNormalization,
+		"envelope_responses", c.EnvelopeResponses,
+		"temp_format_decimals", c.TempFormatDecimals,
+		"warmup_ceps", c.WarmupCEPs,
+		"warmup_weather", c.WarmupWeather,
+		"enable_debug_endpoints", c.EnableDebugEndpoints,
+		"chaos_enabled", c.ChaosEnabled,
+		"chaos_failure_rate", c.ChaosFailureRate,
+		"chaos_latency", c.ChaosLatency,
+		"weather_hedge_delay", c.WeatherHedgeDelay,
+		"distinct_count_window", c.DistinctCountWindow,
+		"drain_timeout", c.DrainTimeout,
+		"trust_proxy", c.TrustProxy,
+		"otel_optional", c.OTelOptional,
+		"endpoint_timeouts", c.EndpointTimeouts,
+		"expose_mock_flag", c.ExposeMockFlag,
+		"pretty_json", c.PrettyJSON,
+		"request_budget", c.RequestBudget,
+		"forward_headers", c.ForwardHeaders,
+		"max_upstream_bytes", c.MaxUpstreamBytes,
+		"feature_flags", c.FeatureFlags,
+		"grpc_addr", c.GRPCAddr,
+		"weather_api_key_file", c.WeatherAPIKeyFile,
+		"aggregate_weather", c.AggregateWeather,
+		"slo_availability_target", c.SLOAvailabilityTarget,
+		"slo_burn_windows", c.SLOBurnWindows,
+		"slo_burn_rate_threshold", c.SLOBurnRateThreshold,
+		"max_batch_size", c.MaxBatchSize,
+		"traces_exporters", c.TracesExporters,
+		"temp_sanity_min_c", c.TempSanityMinC,
+		"temp_sanity_max_c", c.TempSanityMaxC,
+		"min_request_timeout", c.MinRequestTimeout,
+		"max_request_timeout", c.MaxRequestTimeout,
+		"audit_log_level", c.AuditLogLevel,
+		"audit_log_channel", c.AuditLogChannel,
+		"audit_log_redact_cep", c.AuditLogRedactCEP,
+		"min_http_version", fmt.Sprintf("%d.%d", c.MinHTTPMajor, c.MinHTTPMinor),
+		"climate_fallback", c.ClimateFallback,
+		"disabled_endpoints", c.DisabledEndpoints,
+		"weather_bulk", c.WeatherBulk,
+		"gzip_level", c.GzipLevel,
+		"pod_name", c.PodName,
+		"upstream_failure_threshold", c.UpstreamFailureThreshold,
+		"upstream_failure_window", c.UpstreamFailureWindow,
+		"weather_provider_timeout", c.WeatherProviderTimeout,
+		"trace_headers", c.TraceHeaders,
+		"shed_latency_target", c.ShedLatencyTarget,
+		"strict_json", c.StrictJSON,
+		"cache_min_ttl", c.CacheMinTTL,
+		"cache_max_ttl", c.CacheMaxTTL,
+		"cache_refresh_ahead", c.CacheRefreshAhead,
+		"stream_interval", c.StreamInterval,
+		"weather_validate_key_on_start", c.WeatherValidateKeyOnStart,
+		"unassigned_cep_prefixes", c.UnassignedCEPPrefixes,
+		"enable_pprof", c.EnablePprof,
+		"pprof_addr", c.PprofAddr,
+		"retry_after_jitter", c.RetryAfterJitter,
+		"cep_dataset_file", c.CEPDatasetFile,
+		"offline_only", c.OfflineOnly,
+		"cep_stage_budget_pct", c.CEPStageBudgetPct,
+		"metrics_exemplars", c.MetricsExemplars,
+		"weather_max_concurrent", c.WeatherMaxConcurrent,
+		"temp_calibration_offset_c", c.TempCalibrationOffsetC,
+		"write_timeout", c.WriteTimeout,
+		"otlp_insecure", c.OTLPInsecure,
+		"otlp_certificate", c.OTLPCertificate,
+		"request_id_format", c.RequestIDFormat,
+		"require_sampled_trace", c.RequireSampledTrace,
+		"max_location_length", c.MaxLocationLength,
+		"health_check_timeout", c.HealthCheckTimeout,
+		"health_check_deadline", c.HealthCheckDeadline,
+		"response_cep_format", c.ResponseCEPFormat,
+		"max_batch_job_size", c.MaxBatchJobSize,
+		"batch_job_retention", c.BatchJobRetention,
+		"max_batch_jobs", c.MaxBatchJobs,
+		"trust_sampling_priority", c.TrustSamplingPriority,
+		"max_sse_streams", c.MaxSSEStreams,
+		"max_response_bytes", c.MaxResponseBytes,
+		"deploy_env", c.DeployEnv,
+		"log_level", c.LogLevel,
+		"mock_weather_span", c.MockWeatherSpan,
+		"max_request_bytes", c.MaxRequestBytes,
+		"mock_temp_c", c.MockTempC,
+		"set_global_otel", c.SetGlobalOTel,
+		"strict_region_match", c.StrictRegionMatch,
+		"temp_extra_units", c.TempExtraUnits,
+		"max_batch_response_bytes", c.MaxBatchResponseBytes,
+		"response_schema_version", c.ResponseSchemaVersion,
+	)
+}
+
+// tracesSampler describes the sampler the tracer provider picks up from the
+// standard OTEL_TRACES_SAMPLER(_ARG) variables, unless TRACES_SAMPLE_RATIO
+// selects the error-aware sampler.
+func tracesSampler() string {
+	if cfg.TracesSampleRatio < 1 {
+		return fmt.Sprintf("error_aware_ratio:%g", cfg.TracesSampleRatio)
+	}
+	sampler := os.Getenv("OTEL_TRACES_SAMPLER")
+	if sampler == "" {
+		return "parentbased_always_on"
+	}
+	if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		return sampler + ":" + arg
+	}
+	return sampler
+}
+
+// getEnvList parses a comma-separated list, ignoring empty items.
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return b, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return d, nil
+}
+
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return f, nil
+}
+
+func getEnvMillis(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative number of milliseconds", key, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// getEnvMillisMap parses a "key=ms,key=ms" list, e.g. "/weather=3000,/health=100".
+func getEnvMillisMap(key string) (map[string]time.Duration, error) {
+	pairs, err := parseKeyValueList(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	result := make(map[string]time.Duration, len(pairs))
+	for k, v := range pairs {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q: must be a non-negative number of milliseconds", key, k)
+		}
+		result[k] = time.Duration(ms) * time.Millisecond
+	}
+	return result, nil
+}
+
+// getEnvDurationMap parses a "key=duration,key=duration" list, e.g.
+// "/weather=10s,/health=500ms".
+func getEnvDurationMap(key string) (map[string]time.Duration, error) {
+	pairs, err := parseKeyValueList(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	result := make(map[string]time.Duration, len(pairs))
+	for k, v := range pairs {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid %s entry %q: must be a non-negative duration such as 10s", key, k)
+		}
+		result[k] = d
+	}
+	return result, nil
+}
+
+// getEnvPercentMap parses a "key=percent,key=percent" list whose percentages
+// add up to 100, e.g. "weatherapi=80,openweathermap=20".
+func getEnvPercentMap(key string) (map[string]int, error) {
+	pairs, err := parseKeyValueList(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]int, len(pairs))
+	total := 0
+	for k, v := range pairs {
+		percent, err := strconv.Atoi(v)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid %s entry %q: must be a percentage between 0 and 100", key, k)
+		}
+		result[k] = percent
+		total += percent
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("invalid %s: percentages must add up to 100, got %d", key, total)
+	}
+	return result, nil
+}
+
+func parseKeyValueList(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("malformed entry %q, expected key=value", item)
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package serviceb
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	formatJSON    = "json"
+	formatGeoJSON = "geojson"
+	formatMsgPack = "msgpack"
+	formatXML     = "xml"
+)
+
+// GeoJSONFeature is the GeoJSON representation of a WeatherResponse. Geometry is
+// null when the coordinates of the location are unknown (e.g. mock data).
+type GeoJSONFeature struct {
+	Type       string           `json:"type"`
+	Geometry   *GeoJSONGeometry `json:"geometry"`
+	Properties WeatherResponse  `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// negotiateFormat picks the response format from the ?format query parameter or
+// the Accept header. It reports false when the client explicitly demands only
+// formats we cannot produce.
+func negotiateFormat(r *http.Request) (string, bool) {
+	switch r.URL.Query().Get("format") {
+	case "":
+	case formatJSON:
+		return formatJSON, true
+	case formatGeoJSON:
+		return formatGeoJSON, true
+	case formatMsgPack:
+		return formatMsgPack, true
+	case formatXML:
+		return formatXML, true
+	default:
+		return "", false
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return formatJSON, true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/geo+json":
+			return formatGeoJSON, true
+		case "application/msgpack", "application/x-msgpack":
+			return formatMsgPack, true
+		case "application/xml", "text/xml":
+			return formatXML, true
+		case "application/json", "application/*", "*/*":
+			return formatJSON, true
+		}
+	}
+	return "", false
+}
+
+// encodeResponse writes v with statusCode in the format negotiated for r, so
+// every handler answers the same Accept header the same way. MessagePack uses
+// the JSON field names; GeoJSON and XML only apply to weather responses, other
+// values are sent as plain JSON. Error responses are always JSON. API payloads
+// are wrapped in a SuccessEnvelope when ENVELOPE_RESPONSES=true, and ?fields
+// trims weather responses to the listed fields. In every format, field names
+// follow the negotiated schema version.
+func encodeResponse(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	format, ok := negotiateFormat(r)
+	if !ok {
+		writeErrorResponse(w, r, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	version, ok := negotiateSchemaVersion(r)
+	if !ok {
+		writeErrorResponse(w, r, "unsupported schema version", http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Version")
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("response.schema_version", version))
+
+	// ?fields selects which fields of a weather response are sent
+	var fields []string
+	if _, ok := v.(*WeatherResponse); ok {
+		if fields, ok = requestedFields(r); !ok {
+			writeErrorResponse(w, r, "unknown field", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Polling clients revalidate with If-None-Match and get a bodiless 304
+	// while the reading has not changed
+	if weather, ok := v.(*WeatherResponse); ok && statusCode == http.StatusOK {
+		etag := weatherETag(weather)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	// GeoJSON bodies must remain a valid Feature, so they are never enveloped
+	geoJSON, xmlBody := format == formatGeoJSON, format == formatXML
+	if _, ok := v.(*WeatherResponse); !ok {
+		geoJSON, xmlBody = false, false
+	}
+	if xmlBody {
+		writeXMLResponse(w, r, statusCode, v.(*WeatherResponse), version)
+		return
+	}
+	wrap := envelopeable(v)
+	contentType := "application/json"
+	if geoJSON {
+		v = newGeoJSONFeature(v.(*WeatherResponse))
+		contentType = "application/geo+json"
+	}
+	v = versionedPayload(v, version)
+	// A GeoJSON Feature keeps its full properties
+	if fields != nil && !geoJSON {
+		for i, name := range fields {
+			fields[i] = schemaFieldName(name, version)
+		}
+		masked, err := maskFields(v, fields)
+		if err != nil {
+			log.Printf("Failed to mask response fields: %v", err)
+			writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		v = masked
+	}
+	if cfg.EnvelopeResponses && !geoJSON && wrap {
+		v = SuccessEnvelope{Status: envelopeStatusSuccess, Data: v}
+	}
+
+	if format == formatMsgPack {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			log.Printf("Failed to encode MessagePack response: %v", err)
+			writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeBody(w, r, statusCode, "application/msgpack", buf.Bytes())
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if cfg.PrettyJSON || r.URL.Query().Get("pretty") == "true" {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, statusCode, contentType, buf.Bytes())
+}
+
+// writeBody sends an encoded response, unless it is larger than
+// MAX_RESPONSE_BYTES: a runaway payload, e.g. from an oversized batch, is
+// answered with a 500 instead. The size is recorded on the request span
+// either way.
+func writeBody(w http.ResponseWriter, r *http.Request, statusCode int, contentType string, body []byte) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Int("http.response.encoded_size", len(body)))
+	if len(body) > cfg.MaxResponseBytes {
+		span.AddEvent("http.response_too_large", trace.WithAttributes(
+			attribute.Int("http.response.encoded_size", len(body)),
+			attribute.Int("http.response.max_size", cfg.MaxResponseBytes),
+		))
+		log.Printf("Refusing to send a %d-byte response, above MAX_RESPONSE_BYTES (%d)", len(body), cfg.MaxResponseBytes)
+		writeErrorResponse(w, r, "response too large", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// writeXMLResponse writes weather as a <weather> document laid out as version,
+// for clients that only consume XML. It keeps every field and is never
+// enveloped, as the masking and the envelope work on the JSON representation.
+func writeXMLResponse(w http.ResponseWriter, r *http.Request, statusCode int, weather *WeatherResponse, version string) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).EncodeElement(versionedPayload(weather, version), xml.StartElement{Name: xml.Name{Local: "weather"}}); err != nil {
+		log.Printf("Failed to encode XML response: %v", err)
+		writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, statusCode, "application/xml; charset=utf-8", buf.Bytes())
+}
+
+func newGeoJSONFeature(weather *WeatherResponse) GeoJSONFeature {
+	feature := GeoJSONFeature{Type: "Feature", Properties: *weather}
+	if weather.HasCoordinates {
+		feature.Geometry = &GeoJSONGeometry{
+			Type:        "Point",
+			Coordinates: []float64{weather.Longitude, weather.Latitude},
+		}
+	}
+	return feature
+}
@@ -0,0 +1,28 @@
+package serviceb
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routes are the patterns registered by handleRoute, listed by handleRoot.
+var routes []string
+
+// handleRoute registers handler for pattern on mux unless its path is listed
+// in DISABLED_ENDPOINTS, in which case the route is left out and answers 404.
+// Every path registered also answers OPTIONS with its description.
+func handleRoute(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	path := pattern
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		path = p
+	}
+	if slices.Contains(cfg.DisabledEndpoints, path) {
+		slog.Info("endpoint disabled", "pattern", pattern)
+		return
+	}
+	mux.HandleFunc(pattern, handler)
+	routes = append(routes, pattern)
+	handleOptionsRoute(mux, path)
+}
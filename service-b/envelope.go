@@ -0,0 +1,37 @@
+package serviceb
+
+const (
+	envelopeStatusSuccess = "success"
+	envelopeStatusError   = "error"
+)
+
+// SuccessEnvelope wraps successful payloads when ENVELOPE_RESPONSES=true.
+type SuccessEnvelope struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data"`
+}
+
+// ErrorEnvelope wraps error responses when ENVELOPE_RESPONSES=true.
+type ErrorEnvelope struct {
+	Status string        `json:"status"`
+	Error  ErrorResponse `json:"error"`
+}
+
+// errorBody returns the body of an error response, enveloped when configured.
+func errorBody(code, message, traceparent string) interface{} {
+	response := ErrorResponse{Code: code, Message: message, Trace: traceparent}
+	if cfg.EnvelopeResponses {
+		return ErrorEnvelope{Status: envelopeStatusError, Error: response}
+	}
+	return response
+}
+
+// envelopeable reports whether v is an API payload that gets enveloped, as
+// opposed to, e.g., health checks whose format probes depend on.
+func envelopeable(v interface{}) bool {
+	switch v.(type) {
+	case *WeatherResponse, *WeatherHistoryResponse, *WeatherForecastResponse, PendingWeatherResponse, *Location, BatchResponse:
+		return true
+	}
+	return false
+}
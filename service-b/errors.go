@@ -0,0 +1,112 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorCodes maps the messages of our error responses to their codes.
+var errorCodes = map[string]string{
+	"invalid request body":                   "invalid_request_body",
+	"invalid delay":                          "invalid_delay",
+	"invalid zipcode":                        "invalid_zipcode",
+	"invalid location":                       "invalid_location",
+	"invalid city":                           "invalid_city",
+	"invalid address":                        "invalid_address",
+	"invalid weather provider":               "invalid_weather_provider",
+	"unknown field":                          "unknown_field",
+	"service overloaded":                     "load_shed",
+	"too many streams":                       "too_many_streams",
+	"invalid date":                           "invalid_date",
+	"empty batch":                            "empty_batch",
+	"batch too large":                        "batch_too_large",
+	"batch response too large":               "batch_response_too_large",
+	"unknown feature flag":                   "unknown_feature_flag",
+	"can not find batch job":                 "batch_job_not_found",
+	"too many batch jobs":                    "too_many_batch_jobs",
+	"batch job already finished":             "batch_job_finished",
+	"can not find zipcode":                   "zipcode_not_found",
+	"not acceptable":                         "not_acceptable",
+	"unsupported schema version":             "unsupported_schema_version",
+	"http version not supported":             "http_version_not_supported",
+	"unsupported media type":                 "unsupported_media_type",
+	"unsupported content encoding":           "unsupported_content_encoding",
+	"invalid gzip body":                      "invalid_gzip_body",
+	"request body too large":                 "request_body_too_large",
+	"upstream rate limited, try again later": "upstream_rate_limited",
+	"upstream tls error":                     "upstream_tls_error",
+	"viacep timed out":                       "upstream_timeout",
+	"viacep unavailable":                     "upstream_unavailable",
+	"incomplete weather data from upstream":  "upstream_missing_temperature",
+	"implausible weather data from upstream": "implausible_weather",
+	"weather region mismatch from upstream":  "weather_region_mismatch",
+	"not enough time left for the request":   "deadline_too_short",
+	"request timed out":                      "handler_timeout",
+	"chaos failure injected":                 "chaos_injected",
+	"sampled trace context required":         "trace_context_required",
+	"response too large":                     "response_too_large",
+	"internal server error":                  "internal_error",
+}
+
+// errorCode returns the stable, machine-readable code for a client-facing error
+// message, falling back to the snake-cased status text for unlisted messages.
+func errorCode(message string, statusCode int) string {
+	if code, ok := errorCodes[message]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
+
+// ErrZipcodeNotFound is returned when the CEP is well formed but does not exist.
+var ErrZipcodeNotFound = errors.New("can not find zipcode")
+
+// ErrInvalidLocation is returned when a location has no usable city to look
+// the weather up by, e.g. from an edge-case CEP provider response: an empty
+// one, or one longer than MAX_LOCATION_LENGTH.
+var ErrInvalidLocation = errors.New("invalid location")
+
+// ErrImplausibleWeather is returned when a provider reports a temperature
+// outside TEMP_SANITY_MIN_C..TEMP_SANITY_MAX_C, as some do during outages.
+var ErrImplausibleWeather = errors.New("implausible weather data")
+
+// ErrMissingTemperature is returned when a provider answers without the
+// temperature, which would otherwise decode as a genuine 0°C.
+var ErrMissingTemperature = errors.New("weather data missing the temperature")
+
+// ErrRegionMismatch is returned with STRICT_REGION_MATCH=true when WeatherAPI
+// places the city in another state than the CEP's UF, even after retrying
+// with the state spelled out.
+var ErrRegionMismatch = errors.New("weather region does not match the zipcode state")
+
+// ErrBatchResponseTooLarge cancels the items of a batch left running once its
+// response outgrows MAX_BATCH_RESPONSE_BYTES.
+var ErrBatchResponseTooLarge = errors.New("batch response too large")
+
+// RateLimitedError is returned when an upstream provider keeps throttling us.
+// RetryAfter is the delay the provider asked for, or zero when it gave none.
+type RateLimitedError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("%s rate limited the request (retry after %s)", e.Provider, e.RetryAfter)
+}
+
+// traceParent returns the W3C traceparent of the span in ctx, or "" when there
+// is no valid span.
+func traceParent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
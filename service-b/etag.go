@@ -0,0 +1,31 @@
+package serviceb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// weatherETag returns a weak ETag for weather, hashed from the reading itself
+// (city, temperature, local time of the reading and source), so it stays the
+// same until the provider reports new data.
+func weatherETag(weather *WeatherResponse) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%g|%s|%s", weather.City, weather.TempC, weather.LocalTime, weather.Source)
+	return fmt.Sprintf(`W/"%016x"`, h.Sum64())
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag, using
+// the weak comparison conditional GETs call for.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package serviceb
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// traceExporterNames are the values OTEL_TRACES_EXPORTER accepts.
+var traceExporterNames = map[string]bool{
+	"otlp":    true,
+	"zipkin":  true,
+	"console": true,
+}
+
+// newTraceExporter creates the span exporter named by an OTEL_TRACES_EXPORTER
+// entry.
+func newTraceExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "otlp":
+		security := otlptracegrpc.WithInsecure()
+		if !cfg.OTLPInsecure {
+			security = otlptracegrpc.WithTLSCredentials(otlpCredentials())
+		}
+		return otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(otlpEndpoint()), security)
+	case "zipkin":
+		return zipkin.New(zipkinEndpoint())
+	case "console":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q", name)
+}
+
+// zipkinEndpoint returns the Zipkin spans endpoint from the environment.
+func zipkinEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return "http://localhost:9411/api/v2/spans"
+}
@@ -0,0 +1,57 @@
+package serviceb
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PendingWeatherResponse is returned in fast mode when the weather lookup did not
+// finish within FAST_MODE_TIMEOUT. Temperatures are null until a later request
+// picks up the value the background lookup stored in the cache.
+type PendingWeatherResponse struct {
+	City           string   `json:"city"`
+	TempC          *float64 `json:"temp_C"`
+	TempF          *float64 `json:"temp_F"`
+	TempK          *float64 `json:"temp_K"`
+	WeatherPending bool     `json:"weather_pending"`
+}
+
+type weatherResult struct {
+	weather *WeatherResponse
+	err     error
+}
+
+// getWeatherFast races the weather lookup against FAST_MODE_TIMEOUT. It reports
+// pending=true when the deadline won; the lookup keeps running in the background
+// so its result still warms the cache.
+func getWeatherFast(ctx context.Context, provider WeatherProvider, location *Location) (weather *WeatherResponse, pending bool, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	results := make(chan weatherResult, 1)
+	go func() {
+		weather, err := getWeather(context.WithoutCancel(ctx), provider, location)
+		results <- weatherResult{weather: weather, err: err}
+	}()
+
+	timer := time.NewTimer(cfg.FastModeTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-results:
+		span.SetAttributes(attribute.String("fast_mode.path", "complete"))
+		return res.weather, false, res.err
+	case <-timer.C:
+		span.SetAttributes(attribute.String("fast_mode.path", "pending"))
+		return nil, true, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func writePendingWeatherResponse(w http.ResponseWriter, r *http.Request, location string) {
+	encodeResponse(w, r, http.StatusOK, PendingWeatherResponse{City: location, WeatherPending: true})
+}
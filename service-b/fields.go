@@ -0,0 +1,75 @@
+package serviceb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// weatherFields are the JSON names of the WeatherResponse fields ?fields can select.
+var weatherFields = jsonFieldNames(reflect.TypeOf(WeatherResponse{}))
+
+// jsonFieldNames returns the names t's fields are marshaled under, skipping
+// the ones left out of the JSON.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// requestedFields parses the ?fields query parameter, e.g. "city,temp_C". It
+// returns nil when every field is wanted, and reports false when one of the
+// names is not a field of the response. Names of either schema version are
+// accepted and returned in the legacy layout.
+func requestedFields(r *http.Request) ([]string, bool) {
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		return nil, true
+	}
+	var fields []string
+	for _, name := range strings.Split(param, ",") {
+		name = legacyFieldName(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !weatherFields[name] {
+			return nil, false
+		}
+		fields = append(fields, name)
+	}
+	return fields, true
+}
+
+// maskFields marshals v and keeps only fields of the result, so any response
+// can be trimmed to the shape a client asks for. Fields the response left out,
+// such as empty optional ones, stay absent.
+func maskFields(v interface{}, fields []string) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	masked := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		if value, ok := all[name]; ok {
+			masked[name] = value
+		}
+	}
+	return masked, nil
+}
@@ -0,0 +1,127 @@
+package serviceb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Experimental behavior that can be switched on and off at runtime.
+const (
+	flagHedging        = "hedging"
+	flagFastMode       = "fast_mode"
+	flagWeatherHistory = "weather_history"
+)
+
+// defaultFeatureFlags lists every known flag with its value when
+// FEATURE_FLAGS does not set it.
+var defaultFeatureFlags = map[string]bool{
+	flagHedging:        true,
+	flagFastMode:       true,
+	flagWeatherHistory: true,
+}
+
+// featureFlagRegistry holds the current value of every feature flag. It is
+// loaded from FEATURE_FLAGS at startup and changed through POST /debug/flags.
+type featureFlagRegistry struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+var featureFlags *featureFlagRegistry
+
+func newFeatureFlagRegistry(flags map[string]bool) *featureFlagRegistry {
+	return &featureFlagRegistry{flags: flags}
+}
+
+// parseFeatureFlags parses a "flag=bool,flag=bool" list over the defaults.
+func parseFeatureFlags(value string) (map[string]bool, error) {
+	pairs, err := parseKeyValueList(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEATURE_FLAGS: %w", err)
+	}
+	flags := make(map[string]bool, len(defaultFeatureFlags))
+	for name, enabled := range defaultFeatureFlags {
+		flags[name] = enabled
+	}
+	for name, v := range pairs {
+		if _, ok := defaultFeatureFlags[name]; !ok {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS: unknown flag %q", name)
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS entry %q: must be true or false", name)
+		}
+		flags[name] = enabled
+	}
+	return flags, nil
+}
+
+func (f *featureFlagRegistry) enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.flags[name]
+}
+
+func (f *featureFlagRegistry) snapshot() map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	flags := make(map[string]bool, len(f.flags))
+	for name, enabled := range f.flags {
+		flags[name] = enabled
+	}
+	return flags
+}
+
+// update applies changes, all or nothing: an unknown flag changes none.
+func (f *featureFlagRegistry) update(changes map[string]bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name := range changes {
+		if _, ok := f.flags[name]; !ok {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+	}
+	for name, enabled := range changes {
+		f.flags[name] = enabled
+	}
+	return nil
+}
+
+// handleFeatureFlags lists the feature flags on GET and changes the ones in
+// the JSON body, e.g. {"hedging": false}, on POST. Changes take effect on the
+// next request and last until the process restarts.
+func handleFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var changes map[string]bool
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			writeErrorResponse(w, r, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := featureFlags.update(changes); err != nil {
+			writeErrorResponse(w, r, "unknown feature flag", http.StatusBadRequest)
+			return
+		}
+
+		names := make([]string, 0, len(changes))
+		for name := range changes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.StringSlice("feature_flags.changed", names))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	encodeResponse(w, r, http.StatusOK, featureFlags.snapshot())
+}
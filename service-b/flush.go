@@ -0,0 +1,68 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// flushTimeout bounds each ForceFlush of /debug/flush.
+const flushTimeout = 5 * time.Second
+
+// FlushResponse reports the outcome of flushing each signal: "ok", "disabled"
+// when its provider is a no-op, or the error.
+type FlushResponse struct {
+	Traces  string `json:"traces"`
+	Metrics string `json:"metrics"`
+	Logs    string `json:"logs"`
+}
+
+// flusher is implemented by the SDK providers, not by the no-op ones.
+type flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+// handleFlush exports the buffered spans, metrics and log records right away,
+// so tests can assert against the collector without waiting for the batch
+// interval. The span of this request is still open and is not part of it.
+func handleFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ok := true
+	forceFlush := func(provider any) string {
+		f, isFlusher := provider.(flusher)
+		if !isFlusher {
+			return "disabled"
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), flushTimeout)
+		defer cancel()
+		if err := f.ForceFlush(ctx); err != nil {
+			ok = false
+			return err.Error()
+		}
+		return "ok"
+	}
+	response := FlushResponse{
+		Traces:  forceFlush(tracerProvider),
+		Metrics: forceFlush(otel.GetMeterProvider()),
+		Logs:    forceFlush(global.GetLoggerProvider()),
+	}
+
+	statusCode := http.StatusOK
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode flush response: %v", err)
+	}
+}
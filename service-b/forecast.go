@@ -0,0 +1,199 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// forecastMaxDays is how far ahead WeatherAPI's forecast endpoint goes on the
+// free plan; longer preferences are served this many days.
+const forecastMaxDays = 3
+
+// WeatherForecastResponse is served instead of WeatherResponse for
+// Prefer: forecast=Nd.
+type WeatherForecastResponse struct {
+	City string               `json:"city"`
+	Days []WeatherForecastDay `json:"forecast"`
+}
+
+// WeatherForecastDay is the forecast for one day of WeatherForecastResponse.
+type WeatherForecastDay struct {
+	Date     string  `json:"date"`
+	AvgTempC float64 `json:"avg_temp_C"`
+	AvgTempF float64 `json:"avg_temp_F"`
+	AvgTempK float64 `json:"avg_temp_K"`
+	MaxTempC float64 `json:"max_temp_C"`
+	MaxTempF float64 `json:"max_temp_F"`
+	MaxTempK float64 `json:"max_temp_K"`
+	MinTempC float64 `json:"min_temp_C"`
+	MinTempF float64 `json:"min_temp_F"`
+	MinTempK float64 `json:"min_temp_K"`
+}
+
+// parseForecastPreference looks for a forecast preference in the Prefer
+// headers (RFC 7240), e.g. "forecast=3d" or "forecast=3", returning the
+// requested number of days. Like any preference, a malformed one is ignored.
+func parseForecastPreference(headers []string) (int, bool) {
+	for _, header := range headers {
+		for _, preference := range strings.Split(header, ",") {
+			// Parameters after ";" do not apply to forecast
+			preference, _, _ = strings.Cut(preference, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "forecast") {
+				continue
+			}
+			value = strings.TrimSuffix(strings.Trim(strings.TrimSpace(value), `"`), "d")
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 1 {
+				return 0, false
+			}
+			return days, true
+		}
+	}
+	return 0, false
+}
+
+// getWeatherForecast returns the next days of forecast at location, starting
+// today, from the forecast cache or else from WeatherAPI.
+func getWeatherForecast(ctx context.Context, location *Location, days int) (*WeatherForecastResponse, error) {
+	ctx, span := tracer.Start(ctx, "get-weather-forecast")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("city", location.City),
+		attribute.Int("weather.forecast_days", days),
+	)
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateLocation(ctx, location); err != nil {
+		return nil, err
+	}
+
+	key := forecastCacheKey(location, days)
+	span.SetAttributes(attribute.String("cache.forecast.backend", forecastCache.Backend()))
+	if forecast, ok := forecastCache.Get(key); ok {
+		span.SetAttributes(attribute.Bool("cache.forecast.hit", true))
+		return &forecast, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.forecast.hit", false))
+
+	forecast, err := fetchWeatherForecast(ctx, location, days)
+	if err != nil {
+		return nil, err
+	}
+	forecastCache.Set(key, *forecast)
+	return forecast, nil
+}
+
+// forecastCacheKey identifies a forecast by the location and the days asked
+// for, like weatherCacheKey.
+func forecastCacheKey(location *Location, days int) string {
+	return strings.ToLower(strings.TrimSpace(location.City)) + "|" + strings.ToUpper(location.UF) + "|" + strconv.Itoa(days)
+}
+
+// fetchWeatherForecast queries WeatherAPI's forecast endpoint for the next
+// days at location.
+func fetchWeatherForecast(ctx context.Context, location *Location, days int) (*WeatherForecastResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	weatherAPIKey := currentWeatherAPIKey()
+	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
+		// Return mock data for testing when API key is not configured
+		span.SetAttributes(
+			attribute.Bool("mock_data", true),
+			attribute.Float64("mock.temp_c", cfg.MockTempC),
+		)
+		forecast := &WeatherForecastResponse{City: location.City}
+		today := time.Now()
+		for i := range days {
+			day := today.AddDate(0, 0, i).Format(historyDateLayout)
+			forecast.Days = append(forecast.Days, newWeatherForecastDay(day, cfg.MockTempC, cfg.MockTempC, cfg.MockTempC))
+		}
+		return forecast, nil
+	}
+
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/forecast.json?key=%s&q=%s&days=%d&aqi=no&alerts=no", weatherAPIKey, url.QueryEscape(location.City), days)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	release, err := acquireWeatherAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request to WeatherAPI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("WeatherAPI forecast returned status %d, response body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("WeatherAPI forecast returned status %d", resp.StatusCode)
+	}
+
+	// The forecast days come in the same shape as the history
+	var forecastResp WeatherAPIHistoryResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&forecastResp); err != nil {
+		return nil, fmt.Errorf("failed to decode WeatherAPI forecast response: %w", err)
+	}
+	if len(forecastResp.Forecast.Forecastday) == 0 {
+		return nil, fmt.Errorf("WeatherAPI forecast has no data for %s", location.City)
+	}
+
+	forecast := &WeatherForecastResponse{City: location.City}
+	for _, day := range forecastResp.Forecast.Forecastday {
+		forecast.Days = append(forecast.Days, newWeatherForecastDay(day.Date, day.Day.AvgTempC, day.Day.MaxTempC, day.Day.MinTempC))
+	}
+	return forecast, nil
+}
+
+func newWeatherForecastDay(date string, avgC, maxC, minC float64) WeatherForecastDay {
+	return WeatherForecastDay{
+		Date:     date,
+		AvgTempC: avgC,
+		AvgTempF: celsiusToFahrenheit(avgC),
+		AvgTempK: celsiusToKelvin(avgC),
+		MaxTempC: maxC,
+		MaxTempF: celsiusToFahrenheit(maxC),
+		MaxTempK: celsiusToKelvin(maxC),
+		MinTempC: minC,
+		MinTempF: celsiusToFahrenheit(minC),
+		MinTempK: celsiusToKelvin(minC),
+	}
+}
+
+// writeWeatherForecast answers a Prefer: forecast request with the forecast of
+// location, noting in Preference-Applied how many days were served.
+func writeWeatherForecast(w http.ResponseWriter, r *http.Request, location *Location, days int) {
+	forecast, err := getWeatherForecast(r.Context(), location, days)
+	if err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		log.Printf("Error getting weather forecast: %v", err)
+		if errors.Is(err, ErrInvalidLocation) {
+			writeErrorResponse(w, r, "invalid location", http.StatusUnprocessableEntity)
+			return
+		}
+		writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Preference-Applied", fmt.Sprintf("forecast=%dd", days))
+	encodeResponse(w, r, http.StatusOK, forecast)
+}
@@ -0,0 +1,121 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"service-b/weatherpb"
+)
+
+// weatherGRPCServer serves the weather lookup by CEP over gRPC with the same
+// resolution and caching as POST /weather.
+type weatherGRPCServer struct {
+	weatherpb.UnimplementedWeatherServiceServer
+}
+
+func (weatherGRPCServer) GetWeather(ctx context.Context, req *weatherpb.CEPRequest) (*weatherpb.WeatherResponse, error) {
+	span := trace.SpanFromContext(ctx)
+
+	cep, ok := normalizeCEP(req.GetCep())
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid zipcode")
+	}
+	span.SetAttributes(attribute.String("cep", cep))
+
+	location, err := resolveLocation(ctx, cep)
+	if err != nil {
+		span.RecordError(err)
+		var rateLimited *RateLimitedError
+		switch {
+		case errors.Is(err, ErrZipcodeNotFound):
+			return nil, status.Error(codes.NotFound, "can not find zipcode")
+		case errors.As(err, &rateLimited):
+			return nil, status.Error(codes.Unavailable, "upstream rate limited, try again later")
+		case errors.Is(err, ErrUpstreamTLS):
+			log.Printf("Error getting location: %v", err)
+			return nil, status.Error(codes.Unavailable, "upstream tls error")
+		}
+		log.Printf("Error getting location: %v", err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	distinct.observeLocation(location)
+
+	weather, err := getWeather(ctx, weatherProviders[defaultWeatherProvider], location)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Error getting weather: %v", err)
+		switch {
+		case errors.Is(err, ErrInvalidLocation):
+			return nil, status.Error(codes.FailedPrecondition, "invalid location")
+		case errors.Is(err, ErrImplausibleWeather):
+			return nil, status.Error(codes.Unavailable, "implausible weather data from upstream")
+		case errors.Is(err, ErrMissingTemperature):
+			return nil, status.Error(codes.Unavailable, "incomplete weather data from upstream")
+		case errors.Is(err, ErrRegionMismatch):
+			return nil, status.Error(codes.Unavailable, "weather region mismatch from upstream")
+		case errors.Is(err, ErrUpstreamTLS):
+			return nil, status.Error(codes.Unavailable, "upstream tls error")
+		}
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	return &weatherpb.WeatherResponse{
+		City:      weather.City,
+		TempC:     weather.TempC,
+		TempF:     weather.TempF,
+		TempK:     weather.TempK,
+		LocalTime: weather.LocalTime,
+	}, nil
+}
+
+// requireSampledTraceRPC is requireSampledTrace for gRPC calls, which it
+// rejects with InvalidArgument when their metadata has no valid, sampled
+// traceparent.
+func requireSampledTraceRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	carrier := propagation.MapCarrier{}
+	if values := md.Get("traceparent"); len(values) > 0 {
+		carrier.Set("traceparent", values[0])
+	}
+	if !hasSampledTraceContext(carrier) {
+		trace.SpanFromContext(ctx).AddEvent("trace.context_required")
+		return nil, status.Error(codes.InvalidArgument, "sampled trace context required")
+	}
+	return handler(ctx, req)
+}
+
+// startGRPCServer serves WeatherService on GRPC_ADDR in the background,
+// instrumented with otelgrpc so trace context propagates like over HTTP.
+func startGRPCServer(addr string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tracerProvider), otelgrpc.WithPropagators(propagation.TraceContext{}))),
+	}
+	if cfg.RequireSampledTrace {
+		options = append(options, grpc.UnaryInterceptor(requireSampledTraceRPC))
+	}
+	server := grpc.NewServer(options...)
+	weatherpb.RegisterWeatherServiceServer(server, weatherGRPCServer{})
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
@@ -0,0 +1,192 @@
+package serviceb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	healthHealthy   = "healthy"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+
+	dependencyUp   = "up"
+	dependencyDown = "down"
+	dependencyMock = "mock"
+
+	// healthProbeCEP is a CEP known to exist (Praça da Sé, São Paulo)
+	healthProbeCEP = "01001000"
+)
+
+type DependencyHealth struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type DetailedHealthResponse struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+	CheckedAt    time.Time                   `json:"checked_at"`
+}
+
+var (
+	healthCache *ttlCache[DetailedHealthResponse]
+	healthGroup singleflight.Group
+)
+
+// handleDetailedHealth reports the status of each dependency. Losing ViaCEP
+// makes the service unhealthy (503), since no request can be served; losing
+// WeatherAPI or the collector only degrades it. Results are cached for
+// HEALTH_CHECK_CACHE_TTL so frequent probes do not hammer the upstreams.
+func handleDetailedHealth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetName("handle-detailed-health-request")
+
+	health, cached := healthCache.Get("detailed")
+	if !cached {
+		result, _, _ := healthGroup.Do("detailed", func() (interface{}, error) {
+			// Detach from the caller's cancellation: other probes may be waiting on this result
+			health := checkDependencies(context.WithoutCancel(ctx))
+			healthCache.Set("detailed", health)
+			return health, nil
+		})
+		health = result.(DetailedHealthResponse)
+	}
+	span.SetAttributes(
+		attribute.Bool("cache.health.hit", cached),
+		attribute.String("health.status", health.Status),
+	)
+
+	statusCode := http.StatusOK
+	if health.Status == healthUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	encodeResponse(w, r, statusCode, health)
+}
+
+// dependencyChecks are the checks of the dependencies, by name.
+var dependencyChecks = map[string]func(ctx context.Context) (string, error){
+	"viacep":     checkViaCEP,
+	"weatherapi": checkWeatherAPI,
+	"collector":  checkCollector,
+}
+
+// checkDependencies runs every dependency check concurrently, all of them
+// within HEALTH_CHECK_DEADLINE, so one hanging dependency cannot hold the
+// others or the probe up.
+func checkDependencies(ctx context.Context) DetailedHealthResponse {
+	ctx, span := tracer.Start(ctx, "check-dependencies")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, cfg.HealthCheckDeadline)
+	defer cancel()
+
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		dependencies = make(map[string]DependencyHealth, len(dependencyChecks))
+	)
+	for name, check := range dependencyChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health := checkDependency(ctx, check)
+			mu.Lock()
+			dependencies[name] = health
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := healthHealthy
+	for name, dependency := range dependencies {
+		if dependency.Status != dependencyDown {
+			continue
+		}
+		if name == "viacep" {
+			status = healthUnhealthy
+			break
+		}
+		status = healthDegraded
+	}
+	span.SetAttributes(attribute.String("health.status", status))
+
+	return DetailedHealthResponse{
+		Status:       status,
+		Dependencies: dependencies,
+		CheckedAt:    time.Now().UTC(),
+	}
+}
+
+// checkDependency runs a single check, bounded by HEALTH_CHECK_TIMEOUT. Checks
+// return the status to report when they succeed.
+func checkDependency(ctx context.Context, check func(ctx context.Context) (string, error)) DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, cfg.HealthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status, err := check(ctx)
+	health := DependencyHealth{Status: status, LatencyMs: milliseconds(time.Since(start))}
+	if err != nil {
+		health.Status = dependencyDown
+		health.Error = err.Error()
+	}
+	return health
+}
+
+func checkViaCEP(ctx context.Context) (string, error) {
+	return dependencyUp, probeHTTP(ctx, fmt.Sprintf("https://viacep.com.br/ws/%s/json/", healthProbeCEP))
+}
+
+func checkWeatherAPI(ctx context.Context) (string, error) {
+	weatherAPIKey := currentWeatherAPIKey()
+	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
+		// Mock data is served without calling WeatherAPI
+		return dependencyMock, nil
+	}
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", weatherAPIKey, url.QueryEscape("Sao Paulo"))
+	return dependencyUp, probeHTTP(ctx, apiURL)
+}
+
+func checkCollector(ctx context.Context) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", otlpEndpoint())
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return dependencyUp, nil
+}
+
+func probeHTTP(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := newOutboundClient(cfg.HealthCheckTimeout).Do(req)
+	if err != nil {
+		// Do not leak the WeatherAPI key through the error's URL
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
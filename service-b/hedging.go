@@ -0,0 +1,84 @@
+package serviceb
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type hedgeResult[T any] struct {
+	value   T
+	err     error
+	attempt int
+}
+
+// fetchHedged fetches the weather of location from provider through hedge.
+func fetchHedged(ctx context.Context, provider WeatherProvider, location *Location) (*WeatherResponse, error) {
+	return hedge(ctx, func(ctx context.Context) (*WeatherResponse, error) {
+		return provider.Fetch(ctx, location)
+	})
+}
+
+// hedge runs fetch and, when WEATHER_HEDGE_DELAY_MS is set and the first
+// attempt has not answered within it, sends one second attempt, unless the
+// hedging feature flag is off. The first successful answer wins and the other
+// attempt is cancelled. Every weather provider call, single or bulk, goes
+// through it.
+// Hedging is capped at a single extra request to bound quota usage.
+func hedge[T any](ctx context.Context, fetch func(context.Context) (T, error)) (T, error) {
+	if cfg.WeatherHedgeDelay <= 0 || !featureFlags.enabled(flagHedging) {
+		return fetch(ctx)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult[T], 2)
+	attempt := func(n int) {
+		attemptCtx, attemptSpan := tracer.Start(ctx, "weather-attempt", trace.WithAttributes(
+			attribute.Int("weather.hedge.attempt", n),
+		))
+		defer attemptSpan.End()
+
+		value, err := fetch(attemptCtx)
+		if err != nil {
+			attemptSpan.RecordError(err)
+		}
+		results <- hedgeResult[T]{value: value, err: err, attempt: n}
+	}
+
+	go attempt(1)
+	timer := time.NewTimer(cfg.WeatherHedgeDelay)
+	defer timer.Stop()
+
+	hedged := false
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			hedged = true
+			pending++
+			span.AddEvent("weather.hedged", trace.WithAttributes(
+				attribute.Int64("weather.hedge.delay_ms", cfg.WeatherHedgeDelay.Milliseconds()),
+			))
+			go attempt(2)
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				span.SetAttributes(
+					attribute.Bool("weather.hedge.fired", hedged),
+					attribute.Int("weather.hedge.winner", res.attempt),
+				)
+				return res.value, nil
+			}
+			if pending == 0 {
+				span.SetAttributes(attribute.Bool("weather.hedge.fired", hedged))
+				var zero T
+				return zero, res.err
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const historyDateLayout = "2006-01-02"
+
+// historyMaxDays is how far back WeatherAPI's history endpoint goes on the
+// free plan.
+const historyMaxDays = 7
+
+// WeatherHistoryResponse is served instead of WeatherResponse for ?date=.
+type WeatherHistoryResponse struct {
+	City     string  `json:"city"`
+	Date     string  `json:"date"`
+	AvgTempC float64 `json:"avg_temp_C"`
+	AvgTempF float64 `json:"avg_temp_F"`
+	AvgTempK float64 `json:"avg_temp_K"`
+	MaxTempC float64 `json:"max_temp_C"`
+	MaxTempF float64 `json:"max_temp_F"`
+	MaxTempK float64 `json:"max_temp_K"`
+	MinTempC float64 `json:"min_temp_C"`
+	MinTempF float64 `json:"min_temp_F"`
+	MinTempK float64 `json:"min_temp_K"`
+}
+
+type WeatherAPIHistoryResponse struct {
+	Forecast struct {
+		Forecastday []struct {
+			Date string `json:"date"`
+			Day  struct {
+				AvgTempC float64 `json:"avgtemp_c"`
+				MaxTempC float64 `json:"maxtemp_c"`
+				MinTempC float64 `json:"mintemp_c"`
+			} `json:"day"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+// parseHistoryDate parses a ?date= value, accepting only the days WeatherAPI
+// has history for: today and the historyMaxDays before it.
+func parseHistoryDate(value string, now time.Time) (time.Time, bool) {
+	date, err := time.ParseInLocation(historyDateLayout, value, now.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if date.After(today) || date.Before(today.AddDate(0, 0, -historyMaxDays)) {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// getWeatherHistory returns the day's average, maximum and minimum
+// temperatures at location from WeatherAPI's history endpoint.
+func getWeatherHistory(ctx context.Context, location *Location, date time.Time) (*WeatherHistoryResponse, error) {
+	ctx, span := tracer.Start(ctx, "get-weather-history")
+	defer span.End()
+
+	day := date.Format(historyDateLayout)
+	span.SetAttributes(
+		attribute.String("city", location.City),
+		attribute.String("weather.history_date", day),
+	)
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateLocation(ctx, location); err != nil {
+		return nil, err
+	}
+
+	weatherAPIKey := currentWeatherAPIKey()
+	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
+		// Return mock data for testing when API key is not configured
+		span.SetAttributes(
+			attribute.Bool("mock_data", true),
+			attribute.Float64("mock.temp_c", cfg.MockTempC),
+		)
+		return newWeatherHistoryResponse(location.City, day, cfg.MockTempC, cfg.MockTempC, cfg.MockTempC), nil
+	}
+
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/history.json?key=%s&q=%s&dt=%s", weatherAPIKey, url.QueryEscape(location.City), day)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	release, err := acquireWeatherAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request to WeatherAPI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("WeatherAPI history returned status %d, response body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("WeatherAPI history returned status %d", resp.StatusCode)
+	}
+
+	var historyResp WeatherAPIHistoryResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&historyResp); err != nil {
+		return nil, fmt.Errorf("failed to decode WeatherAPI history response: %w", err)
+	}
+	if len(historyResp.Forecast.Forecastday) == 0 {
+		return nil, fmt.Errorf("WeatherAPI history has no data for %s", day)
+	}
+
+	stats := historyResp.Forecast.Forecastday[0].Day
+	return newWeatherHistoryResponse(location.City, day, stats.AvgTempC, stats.MaxTempC, stats.MinTempC), nil
+}
+
+func newWeatherHistoryResponse(city, date string, avgC, maxC, minC float64) *WeatherHistoryResponse {
+	return &WeatherHistoryResponse{
+		City:     city,
+		Date:     date,
+		AvgTempC: avgC,
+		AvgTempF: celsiusToFahrenheit(avgC),
+		AvgTempK: celsiusToKelvin(avgC),
+		MaxTempC: maxC,
+		MaxTempF: celsiusToFahrenheit(maxC),
+		MaxTempK: celsiusToKelvin(maxC),
+		MinTempC: minC,
+		MinTempF: celsiusToFahrenheit(minC),
+		MinTempK: celsiusToKelvin(minC),
+	}
+}
+
+// writeWeatherHistory answers a ?date= request with the history of location.
+func writeWeatherHistory(w http.ResponseWriter, r *http.Request, location *Location, date time.Time) {
+	history, err := getWeatherHistory(r.Context(), location, date)
+	if err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		log.Printf("Error getting weather history: %v", err)
+		if errors.Is(err, ErrInvalidLocation) {
+			writeErrorResponse(w, r, "invalid location", http.StatusUnprocessableEntity)
+			return
+		}
+		writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	encodeResponse(w, r, http.StatusOK, history)
+}
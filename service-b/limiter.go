@@ -0,0 +1,45 @@
+package serviceb
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// concurrencyLimit bounds the number of requests handled at once to
+// MAX_CONCURRENT_REQUESTS. Further requests queue for a free slot; the time
+// spent queueing is recorded in request_queue_wait_seconds, and waits longer
+// than LIMITER_WAIT_THRESHOLD are flagged on the request span.
+func concurrencyLimit(next http.Handler) http.Handler {
+	if cfg.MaxConcurrentRequests <= 0 {
+		return next
+	}
+	slots := make(chan struct{}, cfg.MaxConcurrentRequests)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		start := time.Now()
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			// The client gave up while queued, there is no one left to answer
+			requestQueueWait.Record(ctx, time.Since(start).Seconds())
+			return
+		}
+		defer func() { <-slots }()
+
+		wait := time.Since(start)
+		requestQueueWait.Record(ctx, wait.Seconds())
+		if wait > cfg.LimiterWaitThreshold {
+			trace.SpanFromContext(ctx).AddEvent("limiter.waited", trace.WithAttributes(
+				attribute.Int64("limiter.wait_ms", wait.Milliseconds()),
+				attribute.Int("limiter.max_concurrent", cfg.MaxConcurrentRequests),
+			))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
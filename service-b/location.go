@@ -0,0 +1,155 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+// handleLocation resolves only the location of the CEP in the request body,
+// without looking up the weather.
+func handleLocation(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-location-request")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := decodeCEPRequest(r)
+	if err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	respondWithLocation(w, r, req.CEP)
+}
+
+// handleLocationByPath is the GET /location/{cep} counterpart of handleLocation.
+func handleLocationByPath(w http.ResponseWriter, r *http.Request) {
+	trace.SpanFromContext(r.Context()).SetName("handle-location-request")
+	respondWithLocation(w, r, r.PathValue("cep"))
+}
+
+// handleHeadProbe answers HEAD on GET routes with the headers of a successful
+// response and no body, without any upstream work, for uptime checkers.
+func handleHeadProbe(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-head-probe")
+	span.SetAttributes(attribute.Bool("http.head_probe", true))
+
+	format, ok := negotiateFormat(r)
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+	contentType := "application/json"
+	if format == formatMsgPack {
+		contentType = "application/msgpack"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+}
+
+func respondWithLocation(w http.ResponseWriter, r *http.Request, rawCEP string) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	if _, ok := negotiateFormat(r); !ok {
+		writeErrorResponse(w, r, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	cep, ok := normalizeCEP(rawCEP)
+	if !ok {
+		writeErrorResponse(w, r, "invalid zipcode", http.StatusUnprocessableEntity)
+		return
+	}
+
+	location, err := resolveLocation(ctx, cep)
+	if err != nil {
+		span.RecordError(err)
+		writeLocationError(w, r, err)
+		return
+	}
+	distinct.observeLocation(location)
+
+	if r.URL.Query().Get("includeMeta") == "true" {
+		location.Meta = location.meta()
+	}
+	response := *location
+	response.CEP = formatResponseCEP(response.CEP)
+	encodeResponse(w, r, http.StatusOK, &response)
+}
+
+// resolveLocation returns the location of cep, serving it from the cache when possible.
+func resolveLocation(ctx context.Context, cep string) (*Location, error) {
+	span := trace.SpanFromContext(ctx)
+
+	// CEPs in ranges that are not assigned always 404 at the provider
+	for _, prefix := range cfg.UnassignedCEPPrefixes {
+		if strings.HasPrefix(cep, prefix) {
+			span.AddEvent("cep.known_unassigned", trace.WithAttributes(attribute.String("cep.prefix", prefix)))
+			return nil, ErrZipcodeNotFound
+		}
+	}
+
+	span.SetAttributes(attribute.String("cache.location.backend", locationCache.Backend()))
+	if entry, ok := locationCache.GetEntry(cep); ok {
+		span.SetAttributes(attribute.Bool("cache.location.hit", true))
+		setCacheExpiryAttributes(span, "location", entry.expiresAt)
+		location := entry.value
+		setLocationMetaAttributes(span, &location)
+		return &location, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.location.hit", false))
+
+	location, err := getLocationFromCEP(ctx, cep)
+	if err != nil {
+		return nil, err
+	}
+	locationCache.Set(cep, *location)
+	if cfg.CacheTTL > 0 {
+		setCacheExpiryAttributes(span, "location", shared.Now().Add(cfg.CacheTTL))
+	}
+	setLocationMetaAttributes(span, location)
+	return location, nil
+}
+
+// setLocationMetaAttributes records the IBGE code and DDD of location on span,
+// skipping the ones the provider did not return.
+func setLocationMetaAttributes(span trace.Span, location *Location) {
+	if location.IBGE != "" {
+		span.SetAttributes(attribute.String("cep.ibge", location.IBGE))
+	}
+	if location.DDD != "" {
+		span.SetAttributes(attribute.String("cep.ddd", location.DDD))
+	}
+}
+
+func writeLocationError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrZipcodeNotFound) {
+		writeErrorResponse(w, r, "can not find zipcode", http.StatusNotFound)
+		return
+	}
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) {
+		writeRateLimitedResponse(w, r, rateLimited)
+		return
+	}
+	if errors.Is(err, ErrUpstreamTLS) {
+		log.Printf("Error getting location: %v", err)
+		writeErrorResponse(w, r, "upstream tls error", http.StatusBadGateway)
+		return
+	}
+	log.Printf("Error getting location: %v", err)
+	writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+}
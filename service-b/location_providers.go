@@ -0,0 +1,182 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LocationProvider resolves a normalized CEP to its location. Implementations
+// return ErrZipcodeNotFound when the CEP does not exist.
+type LocationProvider interface {
+	Name() string
+	Resolve(ctx context.Context, cep string) (*Location, error)
+}
+
+// locationProviders are tried in order (CEP_PROVIDERS) until one resolves the CEP.
+var locationProviders []LocationProvider
+
+func newLocationProviders(names []string) ([]LocationProvider, error) {
+	providers := make([]LocationProvider, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "viacep":
+			providers = append(providers, viaCEPProvider{})
+		case "brasilapi":
+			providers = append(providers, brasilAPIProvider{})
+		default:
+			return nil, fmt.Errorf("unknown CEP provider %q", name)
+		}
+	}
+	return providers, nil
+}
+
+// resolveWithProviders tries each provider in turn. A CEP is only reported as
+// not found when every provider agrees; otherwise the last failure is returned.
+func resolveWithProviders(ctx context.Context, providers []LocationProvider, cep string) (*Location, error) {
+	span := trace.SpanFromContext(ctx)
+
+	var lastErr error
+	notFound := 0
+	for _, provider := range providers {
+		location, err := provider.Resolve(ctx, cep)
+		if err == nil {
+			resolver := "online"
+			if _, ok := provider.(*datasetProvider); ok {
+				resolver = "offline"
+			}
+			span.SetAttributes(
+				attribute.String("cep.provider", provider.Name()),
+				attribute.String("resolver", resolver),
+			)
+			return location, nil
+		}
+
+		span.AddEvent("cep.provider_failed", trace.WithAttributes(
+			attribute.String("cep.provider", provider.Name()),
+			attribute.String("error", err.Error()),
+		))
+		if errors.Is(err, ErrZipcodeNotFound) {
+			notFound++
+		}
+		lastErr = err
+	}
+
+	if notFound == len(providers) {
+		auditZipcodeNotFound(ctx, cep, providers)
+		return nil, ErrZipcodeNotFound
+	}
+	return nil, lastErr
+}
+
+type viaCEPProvider struct{}
+
+func (viaCEPProvider) Name() string { return "viacep" }
+
+func (viaCEPProvider) Resolve(ctx context.Context, cep string) (*Location, error) {
+	// Make request to ViaCEP
+	url := fmt.Sprintf("https://viacep.com.br/ws/%s/json/", cep)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to ViaCEP: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp, err = retryRateLimited(ctx, upstreamClient, req, resp, "viacep", cfg.ViaCEPRateLimitMaxWait)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ViaCEP returned status %d", resp.StatusCode)
+	}
+
+	var viaCEPResp ViaCEPResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&viaCEPResp); err != nil {
+		if errors.Is(err, ErrUpstreamTooLarge) {
+			return nil, fmt.Errorf("ViaCEP: %w", err)
+		}
+		return nil, ErrZipcodeNotFound
+	}
+
+	// Check if CEP was found
+	if viaCEPResp.Erro {
+		return nil, ErrZipcodeNotFound
+	}
+
+	return &Location{
+		CEP:     cep,
+		City:    viaCEPResp.Localidade,
+		UF:      viaCEPResp.UF,
+		Region:  viaCEPResp.Regiao,
+		IBGE:    viaCEPResp.IBGE,
+		DDD:     viaCEPResp.DDD,
+		Address: &viaCEPResp,
+	}, nil
+}
+
+type BrasilAPIResponse struct {
+	CEP          string `json:"cep"`
+	State        string `json:"state"`
+	City         string `json:"city"`
+	Neighborhood string `json:"neighborhood"`
+	Street       string `json:"street"`
+}
+
+type brasilAPIProvider struct{}
+
+func (brasilAPIProvider) Name() string { return "brasilapi" }
+
+func (brasilAPIProvider) Resolve(ctx context.Context, cep string) (*Location, error) {
+	url := fmt.Sprintf("https://brasilapi.com.br/api/cep/v1/%s", cep)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to BrasilAPI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrZipcodeNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("BrasilAPI returned status %d", resp.StatusCode)
+	}
+
+	var brasilAPIResp BrasilAPIResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&brasilAPIResp); err != nil {
+		return nil, fmt.Errorf("failed to decode BrasilAPI response: %w", err)
+	}
+
+	return &Location{
+		CEP:    cep,
+		City:   brasilAPIResp.City,
+		UF:     brasilAPIResp.State,
+		Region: brazilianRegions[brasilAPIResp.State],
+		Address: &ViaCEPResponse{
+			CEP:        brasilAPIResp.CEP,
+			Logradouro: brasilAPIResp.Street,
+			Bairro:     brasilAPIResp.Neighborhood,
+			Localidade: brasilAPIResp.City,
+			UF:         brasilAPIResp.State,
+			Regiao:     brazilianRegions[brasilAPIResp.State],
+		},
+	}, nil
+}
@@ -0,0 +1,127 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+const logsExporterOTLP = "otlp"
+
+// initLogger exports slog records (and log.Printf output, which slog.SetDefault
+// redirects) through OTLP when OTEL_LOGS_EXPORTER=otlp. Records logged with a
+// context carry its trace and span IDs.
+func initLogger(ctx context.Context) (func(), error) {
+	if cfg.LogsExporter != logsExporterOTLP {
+		// slog writes through the log package, which only needs its level set
+		slog.SetLogLoggerLevel(cfg.LogLevel)
+		return func() {}, nil
+	}
+
+	// Create OTLP log exporter
+	security := otlploggrpc.WithInsecure()
+	if !cfg.OTLPInsecure {
+		security = otlploggrpc.WithTLSCredentials(otlpCredentials())
+	}
+	exporter, err := otlploggrpc.New(ctx, otlploggrpc.WithEndpoint(otlpEndpoint()), security)
+	if err != nil {
+		if cfg.OTelOptional {
+			slog.Warn("continuing without OTLP logs: failed to create OTLP log exporter", "error", err)
+			slog.SetLogLoggerLevel(cfg.LogLevel)
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+	}
+
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create logger provider
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(res),
+	)
+
+	// Set global logger provider and keep writing to stderr alongside the export
+	global.SetLoggerProvider(lp)
+	slog.SetDefault(slog.New(fanoutHandler{
+		slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}),
+		levelHandler{Handler: otelslog.NewHandler("service-b", otelslog.WithLoggerProvider(lp)), level: cfg.LogLevel},
+	}))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := lp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down logger provider: %v", err)
+		}
+	}, nil
+}
+
+// fanoutHandler sends every record to all of its handlers.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// levelHandler drops the records below LOG_LEVEL before they reach a handler
+// that has no level of its own.
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
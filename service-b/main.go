@@ -1,26 +1,34 @@
-package main
+package serviceb
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
+	"shared"
 )
 
 type CEPRequest struct {
@@ -28,107 +36,433 @@ type CEPRequest struct {
 }
 
 type WeatherResponse struct {
-	City  string  `json:"city"`
-	TempC float64 `json:"temp_C"`
-	TempF float64 `json:"temp_F"`
-	TempK float64 `json:"temp_K"`
+	City  string  `json:"city" xml:"city"`
+	TempC float64 `json:"temp_C" xml:"temp_C"`
+	TempF float64 `json:"temp_F" xml:"temp_F"`
+	TempK float64 `json:"temp_K" xml:"temp_K"`
+
+	// Temperature in the TEMP_EXTRA_UNITS, only filled in for those listed
+	TempRankine *float64 `json:"temp_rankine,omitempty" xml:"temp_rankine,omitempty"`
+	TempReaumur *float64 `json:"temp_reaumur,omitempty" xml:"temp_reaumur,omitempty"`
+
+	// Apparent temperature reported by the provider, the actual one when it
+	// gives none
+	FeelsLikeC float64 `json:"feelslike_C" xml:"feelslike_C"`
+	FeelsLikeF float64 `json:"feelslike_F" xml:"feelslike_F"`
+	FeelsLikeK float64 `json:"feelslike_K" xml:"feelslike_K"`
+
+	// Local time at the location when the reading was taken, "2006-01-02 15:04"
+	LocalTime string `json:"local_time,omitempty" xml:"local_time,omitempty"`
+
+	// Display-ready temperatures, only filled in when ?formatted=true
+	TempCFormatted string `json:"temp_C_formatted,omitempty" xml:"temp_C_formatted,omitempty"`
+	TempFFormatted string `json:"temp_F_formatted,omitempty" xml:"temp_F_formatted,omitempty"`
+
+	// Location metadata, only filled in when ?includeMeta=true
+	Meta *LocationMeta `json:"meta,omitempty" xml:"meta,omitempty"`
+
+	// Full postal address of the CEP, only filled in when ?fullAddress=true
+	Address *ViaCEPResponse `json:"address,omitempty" xml:"address,omitempty"`
+
+	// Processing breakdown, only filled in when ?timings=true
+	Timings *ResponseTimings `json:"timings,omitempty" xml:"timings,omitempty"`
+
+	// Services involved, only filled in when ?topology=true
+	Topology []TopologyHop `json:"topology,omitempty" xml:"hop,omitempty"`
+
+	// Reading of each provider, only filled in when AGGREGATE_WEATHER=true
+	Sources []WeatherSource `json:"sources,omitempty" xml:"reading,omitempty"`
+
+	// Active weather alerts, only filled in when ?alerts=true
+	Alerts []WeatherAlert `json:"alerts,omitempty" xml:"alert,omitempty"`
+
+	// Where the data comes from when not a live provider, e.g. "climate_fallback"
+	Source string `json:"source,omitempty" xml:"source,omitempty"`
+
+	// Whether the mock data was served, only filled in when EXPOSE_MOCK_FLAG=true
+	Mock *bool `json:"mock,omitempty" xml:"mock,omitempty"`
+
+	// Set when the data comes from mockWeather instead of a provider
+	IsMock bool `json:"-" xml:"-"`
+
+	// Coordinates the weather was measured at, only filled in when
+	// ?includeCoords=true and the provider reported them
+	MeasuredLatitude  *float64 `json:"latitude,omitempty" xml:"latitude,omitempty"`
+	MeasuredLongitude *float64 `json:"longitude,omitempty" xml:"longitude,omitempty"`
+
+	// Relative humidity in percent and UV index, only filled in when
+	// ?extended=true and the provider reported them
+	Humidity *int     `json:"humidity,omitempty" xml:"humidity,omitempty"`
+	UV       *float64 `json:"uv,omitempty" xml:"uv,omitempty"`
+
+	// When the provider measured the weather, as opposed to when it was
+	// served, only filled in when ?includeMeasuredAt=true and it reported it
+	MeasuredAt string `json:"measured_at,omitempty" xml:"measured_at,omitempty"`
+
+	// Humidity and UV index as reported by the provider, when known
+	ReportedHumidity *int     `json:"-" xml:"-"`
+	ReportedUV       *float64 `json:"-" xml:"-"`
+
+	// When the provider measured the weather, when known
+	ReportedMeasuredAt time.Time `json:"-" xml:"-"`
+
+	// Coordinates of the location the weather was measured at, when known
+	Latitude       float64 `json:"-" xml:"-"`
+	Longitude      float64 `json:"-" xml:"-"`
+	HasCoordinates bool    `json:"-" xml:"-"`
+
+	// How long the provider allows the data to be cached, when it says so
+	CacheTTL    time.Duration `json:"-" xml:"-"`
+	HasCacheTTL bool          `json:"-" xml:"-"`
 }
 
 type ErrorResponse struct {
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
+
+	// W3C traceparent of the request, when it is traced
+	Trace string `json:"trace,omitempty"`
+}
+
+type Location struct {
+	CEP    string `json:"cep"`
+	City   string `json:"city"`
+	UF     string `json:"uf"`
+	Region string `json:"region"`
+
+	// Only included with ?includeMeta=true
+	Meta *LocationMeta `json:"meta,omitempty"`
+
+	// IBGE municipality code and area code, when the CEP provider knows them
+	IBGE string `json:"-"`
+	DDD  string `json:"-"`
+
+	// Full address as returned by the CEP provider, in ViaCEP's shape
+	Address *ViaCEPResponse `json:"-"`
+}
+
+// LocationMeta carries the identifiers that let clients join our data against
+// external datasets keyed by IBGE municipality code or DDD.
+type LocationMeta struct {
+	IBGE string `json:"ibge,omitempty" xml:"ibge,omitempty"`
+	DDD  string `json:"ddd,omitempty" xml:"ddd,omitempty"`
+}
+
+// meta returns the metadata of the location, nil when there is none.
+func (l *Location) meta() *LocationMeta {
+	if l.IBGE == "" && l.DDD == "" {
+		return nil
+	}
+	return &LocationMeta{IBGE: l.IBGE, DDD: l.DDD}
 }
 
 type ViaCEPResponse struct {
-	CEP         string `json:"cep"`
-	Logradouro  string `json:"logradouro"`
-	Complemento string `json:"complemento"`
-	Bairro      string `json:"bairro"`
-	Localidade  string `json:"localidade"`
-	UF          string `json:"uf"`
-	IBGE        string `json:"ibge"`
-	GIA         string `json:"gia"`
-	DDD         string `json:"ddd"`
-	SIAFI       string `json:"siafi"`
-	Erro        bool   `json:"erro,omitempty"`
+	CEP         string `json:"cep" xml:"cep"`
+	Logradouro  string `json:"logradouro" xml:"logradouro"`
+	Complemento string `json:"complemento" xml:"complemento"`
+	Bairro      string `json:"bairro" xml:"bairro"`
+	Localidade  string `json:"localidade" xml:"localidade"`
+	UF          string `json:"uf" xml:"uf"`
+	Regiao      string `json:"regiao" xml:"regiao"`
+	IBGE        string `json:"ibge" xml:"ibge"`
+	GIA         string `json:"gia" xml:"gia"`
+	DDD         string `json:"ddd" xml:"ddd"`
+	SIAFI       string `json:"siafi" xml:"siafi"`
+	Erro        bool   `json:"erro,omitempty" xml:"erro,omitempty"`
 }
 
 type WeatherAPIResponse struct {
 	Location struct {
-		Name    string `json:"name"`
-		Region  string `json:"region"`
-		Country string `json:"country"`
+		Name    string  `json:"name"`
+		Region  string  `json:"region"`
+		Country string  `json:"country"`
+		Lat     float64 `json:"lat"`
+		Lon     float64 `json:"lon"`
+
+		LocalTime      string `json:"localtime"`
+		LocalTimeEpoch int64  `json:"localtime_epoch"`
 	} `json:"location"`
 	Current struct {
-		TempC float64 `json:"temp_c"`
-		TempF float64 `json:"temp_f"`
+		// Pointers, so a field left out is told apart from a real 0°C
+		TempC *float64 `json:"temp_c"`
+		TempF *float64 `json:"temp_f"`
+
+		FeelsLikeC *float64 `json:"feelslike_c"`
+		Humidity   *int     `json:"humidity"`
+		UV         *float64 `json:"uv"`
+
+		// When the provider measured the conditions, in the location's
+		// local time ("2006-01-02 15:04") and as a Unix time
+		LastUpdated      string `json:"last_updated"`
+		LastUpdatedEpoch int64  `json:"last_updated_epoch"`
 	} `json:"current"`
+
+	// Freshness lifetime from the response's Cache-Control header
+	MaxAge    time.Duration `json:"-"`
+	HasMaxAge bool          `json:"-"`
 }
 
-var tracer trace.Tracer
+var (
+	tracer        trace.Tracer
+	weatherCache  Cache[WeatherResponse]
+	weatherGroup  singleflight.Group
+	locationCache Cache[Location]
+	forecastCache Cache[WeatherForecastResponse]
+)
+
+// tracerProvider is handed explicitly to the instrumentation, so the global
+// one is only set with SET_GLOBAL_OTEL=true.
+var tracerProvider trace.TracerProvider = tracenoop.NewTracerProvider()
+
+// errorBudget tracks the SLO burn rate, against the SLO_* variables.
+var errorBudget *shared.ErrorBudgetTracker
+
+// inFlight tracks the requests being served, for draining on shutdown.
+var inFlight = shared.NewInFlightRequests()
+
+// Main runs Service B on port 8081 until it is told to stop, then drains it.
+func Main() {
+	// Load configuration
+	var err error
+	cfg, err = loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if _, err := loadWeatherAPIKey(); err != nil {
+		log.Fatalf("Failed to load the WeatherAPI key: %v", err)
+	}
+	cfg.logEffective(":8081")
+	shared.LogDeployPreset(cfg.DeployEnv)
+	featureFlags = newFeatureFlagRegistry(cfg.FeatureFlags)
+
+	if cfg.RedisOptions != nil {
+		redisClient = redis.NewClient(cfg.RedisOptions)
+		defer redisClient.Close()
+	}
+	weatherCache = newCache[WeatherResponse]("weather", cfg.CacheTTL)
+	locationCache = newCache[Location]("location", cfg.CacheTTL)
+	forecastCache = newCache[WeatherForecastResponse]("forecast", cfg.CacheTTL)
+	healthCache = newTTLCache[DetailedHealthResponse](cfg.HealthCheckCacheTTL)
+	locationProviders, err = newLocationProviders(cfg.CEPProviders)
+	if err != nil {
+		log.Fatalf("Failed to configure CEP providers: %v", err)
+	}
+	if cfg.CEPDatasetFile != "" {
+		dataset, err := loadCEPDataset(cfg.CEPDatasetFile)
+		if err != nil {
+			log.Fatalf("Failed to load the CEP dataset: %v", err)
+		}
+		log.Printf("Loaded %d CEPs from CEP_DATASET_FILE", len(dataset.locations))
+		// The dataset is tried first, or alone with OFFLINE_ONLY=true
+		if cfg.OfflineOnly {
+			locationProviders = []LocationProvider{dataset}
+		} else {
+			locationProviders = append([]LocationProvider{dataset}, locationProviders...)
+		}
+	}
 
-func main() {
 	// Initialize OpenTelemetry
 	ctx := context.Background()
-	shutdown, err := initTracer(ctx)
+	tp, shutdown, err := initTracer(ctx)
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
 	defer shutdown()
+	if tp != nil {
+		tracerProvider = tp
+	}
+
+	shutdownMeter, err := initMeter(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer shutdownMeter()
+
+	shutdownLogger, err := initLogger(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer shutdownLogger()
+
+	tracer = tracerProvider.Tracer("service-b")
+	var attempts http.RoundTripper = tlsErrorRoundTripper{next: otelhttp.NewTransport(newBaseTransport(cfg.OutboundHTTPProxy, cfg.DNSResolver), otelhttp.WithTracerProvider(tracerProvider), otelhttp.WithPropagators(propagation.TraceContext{}))}
+	if cfg.EnableDebugEndpoints {
+		// Keep each attempt for /debug/upstream/recent
+		attempts = upstreamRecordingRoundTripper{next: attempts}
+	}
+	outboundTransport = upstreamHealthRoundTripper{next: newRetryRoundTripper(attempts, cfg.RetryMaxAttempts, cfg.RetryBaseDelay)}
+	upstreamClient = newOutboundClient(upstreamTimeout)
+	if cfg.WeatherMaxConcurrent > 0 {
+		weatherAPISlots = semaphore.NewWeighted(int64(cfg.WeatherMaxConcurrent))
+	}
+	if err := initMetrics(); err != nil {
+		log.Fatalf("Failed to create metrics: %v", err)
+	}
+	errorBudget = shared.NewErrorBudgetTracker(cfg.SLO())
+	go errorBudget.Monitor(ctx)
+
+	if cfg.WeatherValidateKeyOnStart {
+		if err := validateWeatherAPIKey(ctx); err != nil {
+			log.Fatalf("Failed to validate the WeatherAPI key: %v", err)
+		}
+	}
 
-	tracer = otel.Tracer("service-b")
+	// Pick up rotated WeatherAPI keys without a restart
+	if cfg.WeatherAPIKeyFile != "" {
+		go watchWeatherAPIKey(ctx)
+	}
 
-	// Setup HTTP server with OpenTelemetry instrumentation
+	// Preload frequently requested CEPs without delaying startup
+	if len(cfg.WarmupCEPs) > 0 {
+		go warmUpCaches(ctx, cfg.WarmupCEPs)
+	}
+
+	// Setup HTTP server with OpenTelemetry instrumentation, leaving out the
+	// DISABLED_ENDPOINTS
 	mux := http.NewServeMux()
-	mux.HandleFunc("/weather", handleWeather)
-	mux.HandleFunc("/health", handleHealth)
+	// Exactly "/", so unknown paths still fall through to the mux's 404
+	mux.HandleFunc("GET /{$}", handleRoot)
+	handleOptionsRoute(mux, "/{$}")
+	handleRoute(mux, "/weather", handleWeather)
+	handleRoute(mux, "/weather/city", handleWeatherByCity)
+	handleRoute(mux, "/weather/batch", handleWeatherBatch)
+	handleRoute(mux, "GET /weather/batch/{job_id}", handleBatchJob)
+	handleRoute(mux, "DELETE /weather/batch/{job_id}", handleCancelBatchJob)
+	handleRoute(mux, "/location", handleLocation)
+	handleRoute(mux, "GET /location/{cep}", handleLocationByPath)
+	handleRoute(mux, "HEAD /location/{cep}", handleHeadProbe)
+	handleRoute(mux, "POST /location/search", handleLocationSearch)
+	handleRoute(mux, "/health", handleHealth)
+	handleRoute(mux, "/ready", handleReady)
+	handleRoute(mux, "/metrics", metricsHandler())
+	if cfg.EnableDebugEndpoints {
+		handleRoute(mux, "/stats", handleStats)
+		handleRoute(mux, "/debug/flags", handleFeatureFlags)
+		handleRoute(mux, "/debug/flush", handleFlush)
+		handleRoute(mux, "/debug/upstream/recent", handleRecentUpstream)
+		handleRoute(mux, "/debug/errors", handleRecentErrors)
+	}
+	handleRoute(mux, "/health/detailed", handleDetailedHealth)
 
-	// Wrap the handler with OpenTelemetry instrumentation
-	handler := otelhttp.NewHandler(mux, "service-b")
+	// Long-lived streams, and /debug/slow whose delay is deliberate, are served
+	// outside the per-request middlewares below
+	unbounded := http.NewServeMux()
+	handleRoute(unbounded, "GET /weather/stream/{cep}", handleWeatherStream)
+	if cfg.EnableDebugEndpoints {
+		handleRoute(unbounded, "/debug/slow", shared.SlowHandler(tracer, writeErrorResponse))
+	}
 
-	log.Println("Service B starting on port 8081...")
-	if err := http.ListenAndServe(":8081", handler); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Count requests for /stats when debug endpoints are enabled and for the SLO
+	// burn rate, and track the ones in flight for draining on shutdown
+	var routed http.Handler = sloLatency(requireJSON(shedLoad(concurrencyLimit(requestBudget(requestTimeoutOverride(handlerTimeout(injectChaos(mux))))))))
+	routed = routeUnbounded(unbounded, routed)
+	if cfg.EnableDebugEndpoints {
+		routed = stats.Collect(mux, routed)
 	}
-}
+	routed = errorBudget.Track(routed)
+	routed = inFlight.Track(mux, routed)
+	routed = tagPodName(routed)
+	if cfg.TraceHeaders {
+		routed = shared.TraceHeaders(cfg.TraceHeadersAllowlist, routed)
+	}
+	routed = recordForwardedHeaders(routed)
+	routed = countRetries(routed)
+
+	// Wrap the handler with OpenTelemetry instrumentation; requests are server spans.
+	// Untrusted inbound trace context is not extracted at all, so the request
+	// starts a new trace that neither follows nor links to the claimed one.
+	var inbound propagation.TextMapPropagator = propagation.TraceContext{}
+	if !cfg.TrustIncomingTraceContext {
+		inbound = propagation.NewCompositeTextMapPropagator()
+	}
+	otelOptions := []otelhttp.Option{
+		otelhttp.WithSpanOptions(trace.WithSpanKind(trace.SpanKindServer)),
+		otelhttp.WithTracerProvider(tracerProvider),
+		otelhttp.WithPropagators(inbound),
+	}
+	handler := honorSamplingPriority(otelhttp.NewHandler(detectWriteTimeouts(shared.AssignRequestID(cfg.RequestIDFormat, auditTraceContext(traceResponse(requireSampledTrace(requireHTTPVersion(shared.CompressResponses(cfg.GzipLevel, decompressRequests(normalizeRoutes(mux, routed))))))))), "service-b", otelOptions...))
 
-func initTracer(ctx context.Context) (func(), error) {
-	// Get OTLP endpoint from environment variable
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4317"
+	if cfg.GRPCAddr != "" {
+		grpcServer, err := startGRPCServer(cfg.GRPCAddr)
+		if err != nil {
+			log.Fatalf("Failed to start gRPC server: %v", err)
+		}
+		defer grpcServer.GracefulStop()
+		log.Printf("Service B serving gRPC on %s...", cfg.GRPCAddr)
 	}
 
-	// Create OTLP trace exporter
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(otlpEndpoint),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	if cfg.EnablePprof {
+		pprofServer, err := shared.StartPprofServer(cfg.PprofAddr)
+		if err != nil {
+			log.Fatalf("Failed to start pprof server: %v", err)
+		}
+		defer pprofServer.Close()
+		log.Printf("Service B serving pprof on %s...", cfg.PprofAddr)
+	}
+
+	log.Println("Service B starting on port 8081...")
+	server := &http.Server{Addr: ":8081", Handler: handler, WriteTimeout: cfg.WriteTimeout}
+	server.RegisterOnShutdown(stopStreams)
+	server.RegisterOnShutdown(cancelBatchJobs)
+	inFlight.Serve(server, cfg.DrainTimeout)
+}
+
+// initTracer builds the tracer provider, nil when no exporter could be
+// created, and sets it as the global one unless SET_GLOBAL_OTEL=false.
+func initTracer(ctx context.Context) (*sdktrace.TracerProvider, func(), error) {
+	// Create one trace exporter per OTEL_TRACES_EXPORTER entry, e.g. to send
+	// spans to two backends during a migration
+	var exporters []sdktrace.SpanExporter
+	for _, name := range cfg.TracesExporters {
+		exporter, err := newTraceExporter(ctx, name)
+		if err != nil {
+			if cfg.OTelOptional {
+				slog.Warn("continuing without trace exporter: failed to create it", "exporter", name, "error", err)
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to create %s trace exporter: %w", name, err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		slog.Warn("continuing without traces: no trace exporter could be created")
+		if cfg.SetGlobalOTel {
+			otel.SetTracerProvider(tracenoop.NewTracerProvider())
+		}
+		return nil, func() {}, nil
 	}
 
 	// Create resource
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("service-b"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+	res, err := newResource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, nil, err
 	}
 
-	// Create trace provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
+	// Create a span processor per exporter, masking CEPs before export when
+	// configured; shutting the provider down flushes all of them
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	for _, exporter := range exporters {
+		var processor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(exporter)
+		processor = newErrorKeepingProcessor(processor)
+		if cfg.RedactCEPInTraces {
+			processor = newCEPRedactingProcessor(processor)
+		}
+		options = append(options, sdktrace.WithSpanProcessor(processor))
+	}
+
+	// Create trace provider; a sample ratio below 1 keeps errors regardless
+	if cfg.TracesSampleRatio < 1 {
+		options = append(options, sdktrace.WithSampler(newErrorAwareSampler(cfg.TracesSampleRatio)))
+	}
+	tp := sdktrace.NewTracerProvider(options...)
 
 	// Set global trace provider
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if cfg.SetGlobalOTel {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	}
 
-	return func() {
+	return tp, func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := tp.Shutdown(ctx); err != nil {
@@ -137,144 +471,472 @@ func initTracer(ctx context.Context) (func(), error) {
 	}, nil
 }
 
+// otlpEndpoint returns the OTLP collector endpoint from the environment, as
+// host:port; an http:// or https:// scheme only sets the default of
+// OTEL_EXPORTER_OTLP_INSECURE.
+func otlpEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		return strings.TrimPrefix(endpoint, "https://")
+	}
+	return "localhost:4317"
+}
+
+func newResource(ctx context.Context) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName("service-b"),
+		semconv.ServiceVersion(serviceVersion),
+	}
+	if cfg.PodName != "" {
+		attrs = append(attrs, semconv.K8SPodName(cfg.PodName))
+	}
+	if cfg.DeployEnv != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.DeployEnv))
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
 func handleWeather(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	span := trace.SpanFromContext(ctx)
+	span := trace.SpanFromContext(r.Context())
 	span.SetName("handle-weather-request")
+	requestStart := time.Now()
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Stay within the deadline the caller propagated, if any
+	r, cancel, ok := withRequestDeadline(r)
+	defer cancel()
+	if !ok {
+		writeErrorResponse(w, r, "not enough time left for the request", http.StatusGatewayTimeout)
+		return
+	}
+	ctx := r.Context()
+
+	// Negotiate the response format before doing any upstream work
+	if _, ok := negotiateFormat(r); !ok {
+		writeErrorResponse(w, r, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	if _, ok := negotiateSchemaVersion(r); !ok {
+		writeErrorResponse(w, r, "unsupported schema version", http.StatusNotAcceptable)
+		return
+	}
+
 	// Parse request body
-	var req CEPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	req, err := decodeCEPRequest(r)
+	if err != nil {
 		span.RecordError(err)
-		writeErrorResponse(w, "invalid request body", http.StatusBadRequest)
+		writeDecodeError(w, r, err)
 		return
 	}
 
-	// Validate CEP format
-	if !isValidCEP(req.CEP) {
-		writeErrorResponse(w, "invalid zipcode", http.StatusUnprocessableEntity)
+	// Normalize and validate CEP format
+	cep, ok := normalizeCEP(req.CEP)
+	if !ok {
+		writeErrorResponse(w, r, "invalid zipcode", http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Get location from ViaCEP
-	location, err := getLocationFromCEP(ctx, req.CEP)
+	// A past date asks for that day's history instead of current conditions
+	var historyDate time.Time
+	if value := r.URL.Query().Get("date"); value != "" && featureFlags.enabled(flagWeatherHistory) {
+		if historyDate, ok = parseHistoryDate(value, time.Now()); !ok {
+			writeErrorResponse(w, r, "invalid date", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	// Prefer: forecast=Nd asks for the coming days instead, up to
+	// forecastMaxDays; a past date takes precedence
+	forecastDays, preferForecast := parseForecastPreference(r.Header.Values("Prefer"))
+	if preferForecast {
+		span.SetAttributes(attribute.Int("prefer.forecast_days", forecastDays))
+		forecastDays = min(forecastDays, forecastMaxDays)
+	}
+	w.Header().Add("Vary", "Prefer")
+
+	provider, ok := selectWeatherProvider(r)
+	if !ok {
+		writeErrorResponse(w, r, "invalid weather provider", http.StatusBadRequest)
+		return
+	}
+
+	timings := &requestTimings{}
+
+	// Get location from ViaCEP, served from the cache when available
+	stageStart := time.Now()
+	cepCtx, cancelCEP := stageBudget(ctx, "cep", float64(cfg.CEPStageBudgetPct)/100)
+	location, err := resolveLocation(cepCtx, cep)
+	cepTimedOut := ctx.Err() == nil && errors.Is(cepCtx.Err(), context.DeadlineExceeded)
+	cancelCEP()
+	timings.record("viacep", stageStart)
+	w.Header().Set("Server-Timing", timings.serverTiming())
 	if err != nil {
 		span.RecordError(err)
-		if err.Error() == "CEP not found" || err.Error() == "can not find zipcode" {
-			writeErrorResponse(w, "can not find zipcode", http.StatusNotFound)
-		} else {
-			log.Printf("Error getting location: %v", err)
-			writeErrorResponse(w, "internal server error", http.StatusInternalServerError)
+		if cepTimedOut {
+			writeErrorResponse(w, r, "request timed out", http.StatusGatewayTimeout)
+			return
 		}
+		writeLocationError(w, r, err)
+		return
+	}
+	distinct.observeLocation(location)
+
+	if !historyDate.IsZero() {
+		writeWeatherHistory(w, r, location, historyDate)
+		return
+	}
+	if preferForecast {
+		writeWeatherForecast(w, r, location, forecastDays)
 		return
 	}
 
-	// Get weather from WeatherAPI
-	weather, err := getWeatherFromAPI(ctx, location)
+	// Get weather, served from the cache when available. In fast mode the
+	// location is returned right away if the weather takes too long.
+	ctx, cancelWeather := stageBudget(ctx, "weather", 1)
+	defer cancelWeather()
+	var weather *WeatherResponse
+	stageStart = time.Now()
+	if r.URL.Query().Get("fast") == "true" && featureFlags.enabled(flagFastMode) {
+		var pending bool
+		weather, pending, err = getWeatherFast(ctx, provider, location)
+		timings.record("weatherapi", stageStart)
+		w.Header().Set("Server-Timing", timings.serverTiming())
+		if err == nil && pending {
+			writePendingWeatherResponse(w, r, location.City)
+			return
+		}
+	} else {
+		weather, err = lookupWeather(ctx, provider, location)
+		timings.record("weatherapi", stageStart)
+		w.Header().Set("Server-Timing", timings.serverTiming())
+	}
 	if err != nil {
 		span.RecordError(err)
-		log.Printf("Error getting weather: %v", err)
-		writeErrorResponse(w, "internal server error", http.StatusInternalServerError)
+		writeWeatherError(w, r, err)
 		return
 	}
 
 	// Return response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(weather); err != nil {
-		log.Printf("Failed to encode weather response: %v", err)
+	if r.URL.Query().Get("formatted") == "true" {
+		formatTemperatures(weather)
+	}
+	if cfg.ExposeMockFlag {
+		weather.Mock = &weather.IsMock
+	}
+	includeExtraUnits(weather)
+	if r.URL.Query().Get("includeMeta") == "true" {
+		weather.Meta = location.meta()
+	}
+	if r.URL.Query().Get("fullAddress") == "true" {
+		if location.Address != nil {
+			address := *location.Address
+			address.CEP = formatResponseCEP(address.CEP)
+			weather.Address = &address
+		}
+	}
+	if r.URL.Query().Get("includeCoords") == "true" {
+		includeCoordinates(weather)
+	}
+	if r.URL.Query().Get("includeMeasuredAt") == "true" {
+		includeMeasuredAt(weather)
+	}
+	if r.URL.Query().Get("extended") == "true" {
+		includeExtended(weather)
+	}
+	// Alerts are an extra, so the weather is still served when they fail
+	if r.URL.Query().Get("alerts") == "true" {
+		alerts, err := getWeatherAlerts(ctx, location)
+		if err != nil {
+			span.RecordError(err)
+			span.AddEvent("weather.alerts_failed")
+			log.Printf("Error getting weather alerts: %v", err)
+		}
+		weather.Alerts = alerts
+	}
+	if r.URL.Query().Get("timings") == "true" {
+		weather.Timings = timings.breakdown(requestStart)
+	}
+	if r.URL.Query().Get("topology") == "true" {
+		weather.Topology = timings.topology(requestStart)
 	}
+	encodeResponse(w, r, http.StatusOK, weather)
 }
 
+// normalizeCEP strips the separators users commonly paste along with a CEP
+// (dashes, dots and whitespace) and reports whether exactly 8 digits remain,
+// e.g. "01001-000", "01001.000" and "01001 000" all normalize to "01001000".
+func normalizeCEP(cep string) (string, bool) {
+	normalized := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == '.':
+			return -1
+		case unicode.IsSpace(r):
+			return -1
+		}
+		return r
+	}, cep)
+
+	if !isValidCEP(normalized) {
+		return "", false
+	}
+	return normalized, true
+}
+
+// formatResponseCEP writes a CEP echoed in a response in RESPONSE_CEP_FORMAT,
+// "01001000" or "01001-000", whatever form the client or the CEP provider
+// used. CEPs that are not valid are echoed as they came.
+func formatResponseCEP(cep string) string {
+	normalized, ok := normalizeCEP(cep)
+	if !ok {
+		return cep
+	}
+	if cfg.ResponseCEPFormat == responseCEPFormatDashed {
+		return normalized[:5] + "-" + normalized[5:]
+	}
+	return normalized
+}
+
+// cepPattern matches a normalized CEP: exactly 8 digits.
+var cepPattern = regexp.MustCompile(`^\d{8}$`)
+
 func isValidCEP(cep string) bool {
-	// Check if CEP is exactly 8 digits
-	matched, _ := regexp.MatchString(`^\d{8}$`, cep)
-	return matched
+	return cepPattern.MatchString(cep)
 }
 
-func getLocationFromCEP(ctx context.Context, cep string) (string, error) {
-	ctx, span := tracer.Start(ctx, "get-location-from-cep")
+func getLocationFromCEP(ctx context.Context, cep string) (*Location, error) {
+	ctx, span := tracer.Start(ctx, "get-location-from-cep", trace.WithSpanKind(trace.SpanKindClient))
 	defer span.End()
 
-	span.SetAttributes(attribute.String("cep", cep))
-
-	// Create HTTP client with OpenTelemetry instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   10 * time.Second,
+	span.SetAttributes(cepAttributeKey.String(cep))
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
 	}
 
-	// Make request to ViaCEP
-	url := fmt.Sprintf("https://viacep.com.br/ws/%s/json/", cep)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	location, err := resolveWithProviders(ctx, locationProviders, cep)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	span.SetAttributes(attribute.String("location", location.City))
 
-	resp, err := client.Do(req)
+	return location, nil
+}
+
+// getWeather returns the weather for location, serving it from the cache when
+// possible. Concurrent cache misses for the same location are collapsed into a
+// single upstream call whose result is shared by every waiting request.
+func getWeather(ctx context.Context, provider WeatherProvider, location *Location) (*WeatherResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	key := weatherCacheKey(provider, location)
+
+	span.SetAttributes(attribute.String("cache.weather.backend", weatherCache.Backend()))
+	if entry, ok := weatherCache.GetEntry(key); ok {
+		span.SetAttributes(attribute.Bool("cache.weather.hit", true))
+		weatherDataAge.Record(ctx, shared.Since(entry.storedAt).Seconds())
+		setCacheExpiryAttributes(span, "weather", entry.expiresAt)
+		refreshAhead(ctx, provider, location, key, entry.expiresAt)
+		weather := entry.value
+		return &weather, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.weather.hit", false))
+
+	executed := false
+	start := time.Now()
+	timeout := providerTimeout(ctx)
+	result, err, _ := weatherGroup.Do(key, func() (interface{}, error) {
+		executed = true
+		// Detach from the caller's cancellation: other requests may be waiting on this result
+		fetchCtx := context.WithoutCancel(ctx)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			fetchCtx, cancel = context.WithTimeout(fetchCtx, timeout)
+			defer cancel()
+		}
+		weather, err := getWeatherFromAPI(fetchCtx, provider, location)
+		if err != nil {
+			return nil, err
+		}
+		weatherCache.SetWithTTL(key, *weather, weatherCacheTTL(ctx, weather))
+		return weather, nil
+	})
+	span.SetAttributes(attribute.Int64("weather.provider.elapsed_ms", time.Since(start).Milliseconds()))
+	if !executed {
+		span.SetAttributes(attribute.Bool("singleflight.shared", true))
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to make request to ViaCEP: %w", err)
+		if timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+			span.SetAttributes(attribute.Bool("weather.provider.timed_out", true))
+		}
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ViaCEP returned status %d", resp.StatusCode)
+	// Data fetched for this request is as fresh as it gets
+	weatherDataAge.Record(ctx, 0)
+	weather := *result.(*WeatherResponse)
+	return &weather, nil
+}
+
+// includeCoordinates exposes the point the provider measured the weather at,
+// which may differ from the one expected when the city name was ambiguous.
+func includeCoordinates(weather *WeatherResponse) {
+	if !weather.HasCoordinates {
+		return
+	}
+	latitude, longitude := weather.Latitude, weather.Longitude
+	weather.MeasuredLatitude, weather.MeasuredLongitude = &latitude, &longitude
+}
+
+// includeMeasuredAt exposes when the provider measured the weather, in UTC, so
+// clients can tell how fresh the measurement is apart from local_time.
+func includeMeasuredAt(weather *WeatherResponse) {
+	if weather.ReportedMeasuredAt.IsZero() {
+		return
 	}
+	weather.MeasuredAt = weather.ReportedMeasuredAt.UTC().Format(time.RFC3339)
+}
 
-	var viaCEPResp ViaCEPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&viaCEPResp); err != nil {
-		return "", fmt.Errorf("can not find zipcode")
+// includeExtended exposes the humidity and UV index, left out of the default
+// response to keep it minimal.
+func includeExtended(weather *WeatherResponse) {
+	weather.Humidity, weather.UV = weather.ReportedHumidity, weather.ReportedUV
+}
+
+// stageBudget bounds one stage of a /weather request to share of what is left
+// of the request's deadline when CEP_STAGE_BUDGET_PCT is set, so a slow CEP
+// lookup cannot starve the weather lookup, and records the time allotted as
+// stage.<name>.budget_ms on the request span.
+func stageBudget(ctx context.Context, name string, share float64) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if cfg.CEPStageBudgetPct <= 0 || !ok {
+		return ctx, func() {}
 	}
+	budget := time.Duration(float64(time.Until(deadline)) * share)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("stage."+name+".budget_ms", budget.Milliseconds()))
+	return context.WithTimeout(ctx, budget)
+}
 
-	// Check if CEP was found
-	if viaCEPResp.Erro {
-		return "", fmt.Errorf("can not find zipcode")
+// providerTimeout is how long one weather provider may take: WEATHER_PROVIDER_TIMEOUT,
+// cut to what is left of the request's deadline, so a slow provider leaves
+// time for the others in the aggregate and for the climate fallback. Zero
+// means no limit.
+func providerTimeout(ctx context.Context) time.Duration {
+	timeout := cfg.WeatherProviderTimeout
+	if timeout <= 0 {
+		return 0
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
 	}
+	return timeout
+}
 
-	location := viaCEPResp.Localidade
-	span.SetAttributes(attribute.String("location", location))
+// weatherCacheTTL is how long weather may be cached: the provider's own
+// Cache-Control lifetime when it sent one, CACHE_TTL otherwise, kept within
+// CACHE_MIN_TTL and CACHE_MAX_TTL so very short upstream lifetimes do not
+// defeat the cache. A no-store or no-cache response is still not cached.
+func weatherCacheTTL(ctx context.Context, weather *WeatherResponse) time.Duration {
+	ttl, source := cfg.CacheTTL, "default"
+	if weather.HasCacheTTL {
+		ttl, source = weather.CacheTTL, "upstream"
+	}
+	clamped := ttl
+	if clamped > 0 {
+		clamped = max(clamped, cfg.CacheMinTTL)
+		if cfg.CacheMaxTTL > 0 {
+			clamped = min(clamped, cfg.CacheMaxTTL)
+		}
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("cache.weather.ttl_source", source),
+		attribute.Bool("cache.weather.ttl_clamped", clamped != ttl),
+	)
+	ttl = clamped
+	if cfg.CacheTTL > 0 && ttl > 0 {
+		setCacheExpiryAttributes(span, "weather", shared.Now().Add(ttl))
+	}
+	return ttl
+}
 
-	return location, nil
+func weatherCacheKey(provider WeatherProvider, location *Location) string {
+	return provider.Name() + "|" + strings.ToLower(strings.TrimSpace(location.City)) + "|" + strings.ToUpper(location.UF)
 }
 
-func getWeatherFromAPI(ctx context.Context, location string) (*WeatherResponse, error) {
-	ctx, span := tracer.Start(ctx, "get-weather-from-api")
+func getWeatherFromAPI(ctx context.Context, provider WeatherProvider, location *Location) (*WeatherResponse, error) {
+	ctx, span := tracer.Start(ctx, "get-weather-from-api", trace.WithSpanKind(trace.SpanKindClient))
 	defer span.End()
 
-	span.SetAttributes(attribute.String("location", location))
+	span.SetAttributes(
+		attribute.String("location", location.City),
+		attribute.String("weather.provider", provider.Name()),
+	)
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
+	}
 
-	weatherAPIKey := os.Getenv("WEATHER_API_KEY")
-	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
-		// Return mock data for testing when API key is not configured
-		span.SetAttributes(attribute.Bool("mock_data", true))
-		tempC := 22.5
-		return &WeatherResponse{
-			City:  location,
-			TempC: tempC,
-			TempF: celsiusToFahrenheit(tempC),
-			TempK: celsiusToKelvin(tempC),
-		}, nil
+	if err := validateLocation(ctx, location); err != nil {
+		return nil, err
 	}
 
-	// Create HTTP client with OpenTelemetry instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   10 * time.Second,
+	weather, err := fetchHedged(ctx, provider, location)
+	if err != nil {
+		return nil, err
 	}
+	if err := checkTemperatureSanity(ctx, weather); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	calibrateTemperature(ctx, weather)
 
+	span.SetAttributes(
+		attribute.Float64("temp_celsius", weather.TempC),
+		attribute.Float64("temp_fahrenheit", weather.TempF),
+		attribute.Float64("temp_kelvin", weather.TempK),
+	)
+	return weather, nil
+}
+
+// validateLocation checks that location has a city worth querying WeatherAPI
+// for, before any of its endpoints is called. The city is measured as it goes
+// in the query string, escaped, since that is what grows the upstream URL.
+func validateLocation(ctx context.Context, location *Location) error {
+	span := trace.SpanFromContext(ctx)
+	// An empty query would only come back as a provider error
+	if strings.TrimSpace(location.City) == "" {
+		span.AddEvent("weather.invalid_location", trace.WithAttributes(attribute.String("cep", location.CEP)))
+		return fmt.Errorf("%w: empty city", ErrInvalidLocation)
+	}
+	// A pathological city name from the CEP provider would build an oversized upstream URL
+	if length := len(url.QueryEscape(location.City)); length > cfg.MaxLocationLength {
+		span.SetAttributes(attribute.Int("location.length", length))
+		span.AddEvent("weather.invalid_location", trace.WithAttributes(attribute.String("cep", location.CEP)))
+		return fmt.Errorf("%w: city name of %d escaped characters, over MAX_LOCATION_LENGTH", ErrInvalidLocation, length)
+	}
+	return nil
+}
+
+func queryWeatherAPI(ctx context.Context, client *http.Client, apiKey, query string) (*WeatherAPIResponse, error) {
 	// Make request to WeatherAPI
-	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", weatherAPIKey, url.QueryEscape(location))
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", apiKey, url.QueryEscape(query))
 	log.Printf("Making request to WeatherAPI: %s", apiURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	release, err := acquireWeatherAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request to WeatherAPI: %w", err)
@@ -293,27 +955,76 @@ func getWeatherFromAPI(ctx context.Context, location string) (*WeatherResponse,
 	}
 
 	var weatherResp WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weatherResp); err != nil {
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&weatherResp); err != nil {
 		return nil, fmt.Errorf("failed to decode WeatherAPI response: %w", err)
 	}
+	weatherResp.MaxAge, weatherResp.HasMaxAge = parseCacheControl(resp.Header.Get("Cache-Control"))
+	return &weatherResp, nil
+}
 
-	// Convert temperatures
-	tempC := weatherResp.Current.TempC
-	tempF := celsiusToFahrenheit(tempC)
-	tempK := celsiusToKelvin(tempC)
+// checkTemperatureSanity rejects readings outside the TEMP_SANITY_MIN_C and
+// TEMP_SANITY_MAX_C bounds, so they are neither cached nor served.
+func checkTemperatureSanity(ctx context.Context, weather *WeatherResponse) error {
+	if weather.TempC >= cfg.TempSanityMinC && weather.TempC <= cfg.TempSanityMaxC {
+		return nil
+	}
+	trace.SpanFromContext(ctx).AddEvent("weather.implausible", trace.WithAttributes(
+		attribute.Float64("temp_celsius", weather.TempC),
+		attribute.Float64("temp_sanity_min_c", cfg.TempSanityMinC),
+		attribute.Float64("temp_sanity_max_c", cfg.TempSanityMaxC),
+	))
+	return fmt.Errorf("%w: %g°C", ErrImplausibleWeather, weather.TempC)
+}
 
-	span.SetAttributes(
-		attribute.Float64("temp_celsius", tempC),
-		attribute.Float64("temp_fahrenheit", tempF),
-		attribute.Float64("temp_kelvin", tempK),
-	)
+// setFeelsLike sets the apparent temperature in every unit from its Celsius value.
+func (w *WeatherResponse) setFeelsLike(feelsLikeC float64) {
+	w.FeelsLikeC = feelsLikeC
+	w.FeelsLikeF = celsiusToFahrenheit(feelsLikeC)
+	w.FeelsLikeK = celsiusToKelvin(feelsLikeC)
+}
 
-	return &WeatherResponse{
-		City:  weatherResp.Location.Name,
-		TempC: tempC,
-		TempF: tempF,
-		TempK: tempK,
-	}, nil
+// calibrateTemperature adds TEMP_CALIBRATION_OFFSET_C to a sane provider
+// reading, a deliberate adjustment some deployments make to match a local
+// sensor baseline, and recomputes the other units from it.
+func calibrateTemperature(ctx context.Context, weather *WeatherResponse) {
+	if cfg.TempCalibrationOffsetC == 0 {
+		return
+	}
+	weather.TempC += cfg.TempCalibrationOffsetC
+	weather.TempF = celsiusToFahrenheit(weather.TempC)
+	weather.TempK = celsiusToKelvin(weather.TempC)
+	weather.setFeelsLike(weather.FeelsLikeC + cfg.TempCalibrationOffsetC)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("weather.calibration_offset_c", cfg.TempCalibrationOffsetC))
+}
+
+// writeWeatherError writes the error response for a failed weather lookup.
+func writeWeatherError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Error getting weather: %v", err)
+	switch {
+	case errors.Is(err, ErrInvalidLocation):
+		writeErrorResponse(w, r, "invalid location", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrImplausibleWeather):
+		writeErrorResponse(w, r, "implausible weather data from upstream", http.StatusBadGateway)
+		return
+	case errors.Is(err, ErrMissingTemperature):
+		writeErrorResponse(w, r, "incomplete weather data from upstream", http.StatusBadGateway)
+		return
+	case errors.Is(err, ErrRegionMismatch):
+		writeErrorResponse(w, r, "weather region mismatch from upstream", http.StatusBadGateway)
+		return
+	case errors.Is(err, ErrUpstreamTLS):
+		writeErrorResponse(w, r, "upstream tls error", http.StatusBadGateway)
+		return
+	}
+	writeErrorResponse(w, r, "internal server error", http.StatusInternalServerError)
+}
+
+// formatTemperatures fills in the display-ready temperature strings, e.g.
+// "22.5°C" and "72.5°F", rounded to TEMP_FORMAT_DECIMALS decimal places.
+func formatTemperatures(weather *WeatherResponse) {
+	weather.TempCFormatted = fmt.Sprintf("%.*f°C", cfg.TempFormatDecimals, weather.TempC)
+	weather.TempFFormatted = fmt.Sprintf("%.*f°F", cfg.TempFormatDecimals, weather.TempF)
 }
 
 func celsiusToFahrenheit(celsius float64) float64 {
@@ -325,19 +1036,21 @@ func celsiusToKelvin(celsius float64) float64 {
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(`{"status":"ok"}`)); err != nil {
-		log.Printf("Failed to write health response: %v", err)
-	}
+	encodeResponse(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
+	writeCodedErrorResponse(w, r, errorCode(message, statusCode), message, statusCode)
 }
 
-func writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+// writeCodedErrorResponse writes an error response, with the traceparent of the
+// request's span so clients that only parse the body can continue the trace.
+func writeCodedErrorResponse(w http.ResponseWriter, r *http.Request, code, message string, statusCode int) {
+	recordError(r, code, message, statusCode)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	response := ErrorResponse{Message: message}
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := json.NewEncoder(w).Encode(errorBody(code, message, traceParent(r.Context()))); err != nil {
 		log.Printf("Failed to encode error response: %v", err)
 	}
 }
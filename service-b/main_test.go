@@ -0,0 +1,191 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+// fakeLocationProvider resolves every CEP to its location without calling
+// out.
+type fakeLocationProvider struct {
+	location Location
+}
+
+func (fakeLocationProvider) Name() string { return "fake" }
+
+func (p fakeLocationProvider) Resolve(ctx context.Context, cep string) (*Location, error) {
+	location := p.location
+	location.CEP = cep
+	return &location, nil
+}
+
+// fakeWeatherProvider serves a fixed temperature and records the locations it
+// was asked for.
+type fakeWeatherProvider struct {
+	tempC     float64
+	locations chan Location
+}
+
+func (fakeWeatherProvider) Name() string { return "fake" }
+
+func (p fakeWeatherProvider) Fetch(ctx context.Context, location *Location) (*WeatherResponse, error) {
+	p.locations <- *location
+	return &WeatherResponse{
+		City:  location.City,
+		TempC: p.tempC,
+		TempF: celsiusToFahrenheit(p.tempC),
+		TempK: celsiusToKelvin(p.tempC),
+	}, nil
+}
+
+// setupTestService loads the default configuration and the state the
+// handlers expect, on the no-op providers. Every CEP resolves to São Paulo
+// and, without a WeatherAPI key, the weather is the mock one, so no upstream
+// is called.
+func setupTestService(tb testing.TB) {
+	tb.Helper()
+	tb.Setenv("WEATHER_API_KEY", "")
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		tb.Fatalf("loadConfig: %v", err)
+	}
+	weatherCache = newCache[WeatherResponse]("weather", cfg.CacheTTL)
+	locationCache = newCache[Location]("location", cfg.CacheTTL)
+	forecastCache = newCache[WeatherForecastResponse]("forecast", cfg.CacheTTL)
+	locationProviders = []LocationProvider{fakeLocationProvider{location: Location{City: "São Paulo", UF: "SP", Region: "Sudeste"}}}
+	tracer = otel.Tracer("service-b")
+	upstreamClient = newOutboundClient(upstreamTimeout)
+	if err := initMetrics(); err != nil {
+		tb.Fatalf("initMetrics: %v", err)
+	}
+}
+
+// postWeather runs handleWeather for a JSON request with cep.
+func postWeather(cep string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"`+cep+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleWeather(rec, req)
+	return rec
+}
+
+func TestNormalizeCEP(t *testing.T) {
+	tests := []struct {
+		cep  string
+		want string
+		ok   bool
+	}{
+		{"01001000", "01001000", true},
+		{"01001-000", "01001000", true},
+		{"01001.000", "01001000", true},
+		{"01001 000", "01001000", true},
+		{" 01001-000\n", "01001000", true},
+		{"01.001-000", "01001000", true},
+		{"01.001-00", "", false},
+		{"0100100", "", false},
+		{"010010000", "", false},
+		{"01001-00a", "", false},
+		{"01001/000", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeCEP(tt.cep)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeCEP(%q) = %q, %v; want %q, %v", tt.cep, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func BenchmarkIsValidCEP(b *testing.B) {
+	b.Run("precompiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			isValidCEP("01001000")
+		}
+	})
+	// How isValidCEP used to work, for comparison
+	b.Run("compiled per call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			regexp.MustCompile(`^\d{8}$`).MatchString("01001000")
+		}
+	})
+}
+
+// BenchmarkHandleWeather measures a /weather request once the location and
+// the weather are cached, the path most requests take.
+func BenchmarkHandleWeather(b *testing.B) {
+	setupTestService(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if rec := postWeather("01001-000"); rec.Code != http.StatusOK {
+			b.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestValidateLocation(t *testing.T) {
+	setupTestService(t)
+	cfg.MaxLocationLength = 20
+
+	tests := []struct {
+		city string
+		ok   bool
+	}{
+		{"São Paulo", true},
+		{"", false},
+		{"   ", false},
+		// 16 characters, but 26 once escaped into the query string
+		{"São João del-Rei", false},
+		{strings.Repeat("a", 21), false},
+	}
+	for _, tt := range tests {
+		err := validateLocation(context.Background(), &Location{City: tt.city})
+		if (err == nil) != tt.ok {
+			t.Errorf("validateLocation(%q) = %v, want ok %v", tt.city, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidLocation) {
+			t.Errorf("validateLocation(%q) = %v, want ErrInvalidLocation", tt.city, err)
+		}
+	}
+}
+
+// TestWeatherProviderInterface routes a request to a provider registered under
+// its own name, checking that the handler only goes through WeatherProvider.
+func TestWeatherProviderInterface(t *testing.T) {
+	setupTestService(t)
+	provider := fakeWeatherProvider{tempC: 21.5, locations: make(chan Location, 1)}
+	weatherProviders["fake"] = provider
+	defer delete(weatherProviders, "fake")
+
+	req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(`{"cep":"01001000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Weather-Provider", "fake")
+	rec := httptest.NewRecorder()
+	handleWeather(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	select {
+	case location := <-provider.locations:
+		if location.City != "São Paulo" || location.UF != "SP" {
+			t.Errorf("provider asked for %s/%s, want São Paulo/SP", location.City, location.UF)
+		}
+	default:
+		t.Fatal("the fake provider was not asked for the weather")
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"temp_c":21.5`) || !strings.Contains(body, `"temp_f":70.7`) {
+		t.Errorf("body = %s, want the fake provider's 21.5°C", body)
+	}
+	if key := weatherCacheKey(provider, &Location{City: "São Paulo", UF: "SP"}); !strings.HasPrefix(key, "fake|") {
+		t.Errorf("weather cache key = %q, want it scoped to the provider", key)
+	}
+}
@@ -0,0 +1,181 @@
+package serviceb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelruntime "go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"shared"
+)
+
+var (
+	weatherDataAge   metric.Float64Histogram
+	requestQueueWait metric.Float64Histogram
+	requestRetries   metric.Int64Histogram
+)
+
+// runtimeMetricsInterval bounds how often the runtime metrics read the Go
+// memory stats, which briefly stops the world.
+const runtimeMetricsInterval = 15 * time.Second
+
+func initMeter(ctx context.Context) (func(), error) {
+	// Create OTLP metric exporter
+	security := otlpmetricgrpc.WithInsecure()
+	if !cfg.OTLPInsecure {
+		security = otlpmetricgrpc.WithTLSCredentials(otlpCredentials())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(otlpEndpoint()), security)
+	if err != nil {
+		if cfg.OTelOptional {
+			slog.Warn("continuing without metrics: failed to create OTLP metric exporter", "error", err)
+			otel.SetMeterProvider(metricnoop.NewMeterProvider())
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	res, err := newResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same instruments are served for Prometheus scrapes at /metrics
+	promExporter, err := prometheus.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus metric exporter: %w", err)
+	}
+
+	// Create meter provider
+	options := []sdkmetric.Option{
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithReader(promExporter),
+		sdkmetric.WithResource(res),
+	}
+	// Measurements taken under a sampled span keep its trace ID as an exemplar
+	exemplarFilter := exemplar.AlwaysOffFilter
+	if cfg.MetricsExemplars {
+		exemplarFilter = exemplar.TraceBasedFilter
+	}
+	options = append(options, sdkmetric.WithExemplarFilter(exemplarFilter))
+	mp := sdkmetric.NewMeterProvider(options...)
+
+	// Set global meter provider
+	otel.SetMeterProvider(mp)
+
+	// Report goroutines, heap and GC pauses alongside the application metrics
+	if err := otelruntime.Start(otelruntime.WithMinimumReadMemStatsInterval(runtimeMetricsInterval)); err != nil {
+		return nil, fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+	if err := shared.RegisterGCPauseMetric(mp.Meter("service-b"), runtimeMetricsInterval); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := mp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}, nil
+}
+
+// metricsHandler serves /metrics for Prometheus scrapes, in the OpenMetrics
+// format when the scraper asks for it and METRICS_EXEMPLARS=true, which is
+// the only format that carries the exemplars.
+func metricsHandler() http.HandlerFunc {
+	return promhttp.HandlerFor(promclient.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: cfg.MetricsExemplars,
+	}).ServeHTTP
+}
+
+// initMetrics creates the application instruments on the global meter provider.
+func initMetrics() error {
+	meter := otel.Meter("service-b")
+
+	var err error
+	weatherDataAge, err = meter.Float64Histogram("weather_data_age_seconds",
+		metric.WithDescription("Age of the weather data served, 0 when fetched for the request"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create weather_data_age_seconds histogram: %w", err)
+	}
+
+	requestQueueWait, err = meter.Float64Histogram("request_queue_wait_seconds",
+		metric.WithDescription("Time requests waited for a MAX_CONCURRENT_REQUESTS slot"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request_queue_wait_seconds histogram: %w", err)
+	}
+
+	requestRetries, err = meter.Int64Histogram("request_retries",
+		metric.WithDescription("Upstream retries incurred by each request"),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 3, 5, 10),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request_retries histogram: %w", err)
+	}
+
+	distinctCEPs, err := meter.Int64ObservableGauge("distinct_ceps_served",
+		metric.WithDescription("Approximate distinct CEPs served in the current DISTINCT_COUNT_WINDOW"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create distinct_ceps_served gauge: %w", err)
+	}
+	distinctCities, err := meter.Int64ObservableGauge("distinct_cities_served",
+		metric.WithDescription("Approximate distinct cities served in the current DISTINCT_COUNT_WINDOW"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create distinct_cities_served gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		snapshot := distinct.snapshot()
+		o.ObserveInt64(distinctCEPs, int64(snapshot.CEPs))
+		o.ObserveInt64(distinctCities, int64(snapshot.Cities))
+		return nil
+	}, distinctCEPs, distinctCities)
+	if err != nil {
+		return fmt.Errorf("failed to register distinct count callback: %w", err)
+	}
+	_, err = meter.Int64ObservableGauge("sse_streams_active",
+		metric.WithDescription("Weather streams currently open, bounded by MAX_SSE_STREAMS"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(activeStreams.Load())
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create sse_streams_active gauge: %w", err)
+	}
+	sloBurnRate, err := meter.Float64ObservableGauge("slo_burn_rate",
+		metric.WithDescription("Error budget burn rate over each SLO_BURN_WINDOWS window, 1 spends it exactly"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create slo_burn_rate gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for window, rate := range errorBudget.BurnRates(shared.Now()) {
+			o.ObserveFloat64(sloBurnRate, rate.BurnRate, metric.WithAttributes(attribute.String("window", window)))
+		}
+		return nil
+	}, sloBurnRate)
+	if err != nil {
+		return fmt.Errorf("failed to register slo_burn_rate callback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requireJSON rejects POST requests with a body whose Content-Type is neither
+// application/json nor, for legacy HTML-form clients,
+// application/x-www-form-urlencoded (parameters such as charset are allowed)
+// with 415 Unsupported Media Type.
+func requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only bodies need a declared media type, whether or not their length
+		// was declared too
+		if r.Method != http.MethodPost || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("http.request.content_type", contentType))
+
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && mediaType != formMediaType) {
+			writeErrorResponse(w, r, "unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeUnbounded sends the requests matching a route of unbounded straight to
+// it, past the timeout, budget, load shedding and latency middlewares that
+// assume a request ends within seconds and should be served as fast as it can.
+func routeUnbounded(unbounded *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := unbounded.Handler(r); pattern != "" {
+			unbounded.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlerTimeoutMessage is the error returned when HANDLER_TIMEOUT fires.
+const handlerTimeoutMessage = "request timed out"
+
+// handlerTimeout caps the total processing time of a request at HANDLER_TIMEOUT,
+// or at its ENDPOINT_TIMEOUTS entry, using http.TimeoutHandler, which answers
+// 503 with the JSON error schema and cancels the request context once the
+// timeout fires. Zero disables the cap.
+func handlerTimeout(next http.Handler) http.Handler {
+	body, _ := json.Marshal(errorBody(errorCode(handlerTimeoutMessage, http.StatusServiceUnavailable), handlerTimeoutMessage, ""))
+	withTimeout := func(timeout time.Duration) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.TimeoutHandler(next, timeout, string(body))
+	}
+	byEndpoint := make(map[string]http.Handler, len(cfg.EndpointTimeouts))
+	for endpoint, timeout := range cfg.EndpointTimeouts {
+		byEndpoint[endpoint] = withTimeout(timeout)
+	}
+	fallback := withTimeout(cfg.HandlerTimeout)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, timeout := fallback, cfg.HandlerTimeout
+		if override, ok := byEndpoint[r.URL.Path]; ok {
+			handler, timeout = override, cfg.EndpointTimeouts[r.URL.Path]
+		}
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// TimeoutHandler writes its body without a Content-Type; handlers that
+		// finish in time set their own, which replaces this one
+		w.Header().Set("Content-Type", "application/json")
+
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+
+		// The client is still there, so it was our deadline that cut the request
+		if r.Context().Err() == nil && time.Since(start) >= timeout {
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.Bool("http.handler_timeout", true),
+				attribute.Int64("http.handler_timeout_ms", timeout.Milliseconds()),
+			)
+		}
+	})
+}
+
+// requestBudget bounds every request with a REQUEST_BUDGET deadline on its
+// context, so all downstream calls inherit it and are cancelled once it
+// expires, even when no client disconnects. Zero disables the budget.
+func requestBudget(next http.Handler) http.Handler {
+	if cfg.RequestBudget <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestBudget)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			trace.SpanFromContext(ctx).AddEvent("request.budget_exceeded", trace.WithAttributes(
+				attribute.Int64("request.budget_ms", cfg.RequestBudget.Milliseconds()),
+			))
+		}
+	})
+}
+
+// tagPodName records the pod serving the request (POD_NAME, or HOSTNAME) on
+// its span, so a trace can be tied to a misbehaving pod without looking up
+// the resource attributes.
+func tagPodName(next http.Handler) http.Handler {
+	if cfg.PodName == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(semconv.K8SPodName(cfg.PodName))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireHTTPVersion records the protocol version of every request on its span
+// and answers 505 to the ones older than MIN_HTTP_VERSION, e.g. HTTP/1.0
+// clients when it is 1.1. It allows every version by default.
+func requireHTTPVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("network.protocol.version", fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)),
+		)
+		if !r.ProtoAtLeast(cfg.MinHTTPMajor, cfg.MinHTTPMinor) {
+			writeErrorResponse(w, r, "http version not supported", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTimeoutHeader lets clients pick their own deadline per call.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// requestTimeoutOverride applies the deadline a client asks for in the
+// X-Request-Timeout header, e.g. "5s", clamped to MIN_REQUEST_TIMEOUT and
+// MAX_REQUEST_TIMEOUT. It can only shorten an existing REQUEST_BUDGET
+// deadline, never extend it. Unparseable values are ignored.
+func requestTimeoutOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(requestTimeoutHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			span.AddEvent("request.timeout_ignored", trace.WithAttributes(
+				attribute.String("request.timeout_header", value),
+			))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clamped := min(max(timeout, cfg.MinRequestTimeout), cfg.MaxRequestTimeout)
+		span.SetAttributes(attribute.Int64("request.timeout_ms", clamped.Milliseconds()))
+		if clamped != timeout {
+			span.SetAttributes(
+				attribute.Bool("request.timeout_clamped", true),
+				attribute.Int64("request.timeout_requested_ms", timeout.Milliseconds()),
+			)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), clamped)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestDeadlineHeader carries the time the caller has left, in milliseconds
+// or as an RFC 3339 instant, e.g. Service A's remaining request budget.
+const requestDeadlineHeader = "X-Request-Deadline"
+
+// withRequestDeadline applies the X-Request-Deadline of r to its context, so
+// upstream calls are not started past the caller's own deadline. It reports
+// false when less than MIN_REQUEST_TIMEOUT remains, as the request cannot be
+// answered in time. Unparseable values are ignored.
+func withRequestDeadline(r *http.Request) (*http.Request, context.CancelFunc, bool) {
+	value := r.Header.Get(requestDeadlineHeader)
+	if value == "" {
+		return r, func() {}, true
+	}
+
+	var deadline time.Time
+	if milliseconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		deadline = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+	} else if deadline, err = time.Parse(time.RFC3339Nano, value); err != nil {
+		trace.SpanFromContext(r.Context()).AddEvent("request.deadline_ignored", trace.WithAttributes(
+			attribute.String("request.deadline_header", value),
+		))
+		return r, func() {}, true
+	}
+
+	remaining := time.Until(deadline)
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("request.deadline_remaining_ms", remaining.Milliseconds()))
+	if remaining < cfg.MinRequestTimeout {
+		return r, func() {}, false
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	return r.WithContext(ctx), cancel, true
+}
+
+// recordForwardedHeaders attaches the FORWARD_HEADERS of the request, such as
+// X-Tenant-ID, to its span as http.request.header.<name> attributes.
+func recordForwardedHeaders(next http.Handler) http.Handler {
+	if len(cfg.ForwardHeaders) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		for _, name := range cfg.ForwardHeaders {
+			if values := r.Header.Values(name); len(values) > 0 {
+				span.SetAttributes(attribute.StringSlice("http.request.header."+strings.ToLower(name), values))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditTraceContext records the traceparent a client sent on the request span
+// when TRUST_INCOMING_TRACE_CONTEXT=false. The request then starts a fresh
+// trace, so the claimed context is kept for auditing but not followed.
+func auditTraceContext(next http.Handler) http.Handler {
+	if cfg.TrustIncomingTraceContext {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if traceparent := r.Header.Get("traceparent"); traceparent != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.String("trace.claimed_traceparent", traceparent),
+			)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// traceResponse sets the W3C traceresponse header to the request span's
+// context on every response, so clients can start child spans under our
+// trace. It is left out when there is no valid span.
+func traceResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if traceparent := traceParent(r.Context()); traceparent != "" {
+			w.Header().Set("traceresponse", traceparent)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireSampledTrace rejects with 400 the requests that arrive without a
+// valid, sampled traceparent when REQUIRE_SAMPLED_TRACE=true, as sent by
+// clients that are not instrumented. Probes and metric scrapes are exempt.
+// Service A forwards carry its own sampling decision, so they only pass when
+// Service A samples them too; requireSampledTraceRPC does the same over gRPC.
+func requireSampledTrace(next http.Handler) http.Handler {
+	if !cfg.RequireSampledTrace {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/health") || r.URL.Path == "/ready" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !hasSampledTraceContext(propagation.HeaderCarrier(r.Header)) {
+			trace.SpanFromContext(r.Context()).AddEvent("trace.context_required")
+			writeErrorResponse(w, r, "sampled trace context required", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasSampledTraceContext reports whether carrier holds a valid traceparent
+// whose sampled flag is set.
+func hasSampledTraceContext(carrier propagation.TextMapCarrier) bool {
+	incoming := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	return incoming.IsValid() && incoming.IsSampled()
+}
+
+// chaosFailureMessage is the error returned by injected failures.
+const chaosFailureMessage = "chaos failure injected"
+
+// injectChaos delays requests by CHAOS_LATENCY_MS and fails a CHAOS_FAILURE_RATE
+// fraction of them with 503, for resilience testing. It only runs with the
+// explicit CHAOS_ENABLED=true opt-in and never touches health checks.
+func injectChaos(next http.Handler) http.Handler {
+	if !cfg.ChaosEnabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/health") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+
+		if cfg.ChaosLatency > 0 {
+			span.SetAttributes(
+				attribute.Bool("chaos.injected", true),
+				attribute.Int64("chaos.latency_ms", cfg.ChaosLatency.Milliseconds()),
+			)
+			timer := time.NewTimer(cfg.ChaosLatency)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if cfg.ChaosFailureRate > 0 && rand.Float64() < cfg.ChaosFailureRate {
+			span.SetAttributes(
+				attribute.Bool("chaos.injected", true),
+				attribute.Bool("chaos.failure", true),
+			)
+			writeErrorResponse(w, r, chaosFailureMessage, http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sloLatency flags the request span when the handler takes longer than the
+// latency SLO configured for its path (SLO_LATENCY_OVERRIDES) or the global
+// SLO_LATENCY_MS, so slow requests can be queried in the trace backend.
+func sloLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		elapsed := time.Since(start)
+
+		threshold := cfg.SLOLatency
+		if override, ok := cfg.SLOLatencyOverrides[r.URL.Path]; ok {
+			threshold = override
+		}
+		if threshold > 0 && elapsed > threshold {
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.Bool("slo.violated", true),
+				attribute.Int64("slo.duration_ms", elapsed.Milliseconds()),
+				attribute.Int64("slo.threshold_ms", threshold.Milliseconds()),
+			)
+		}
+	})
+}
+
+// normalizeRoutes maps request paths onto the route of mux they match
+// regardless of case and trailing slashes, so "/Weather/" reaches the
+// "/weather" handler. Depending on ROUTE_NORMALIZATION the request is
+// rewritten in place (default), permanently redirected (308, preserving
+// method and body) or left untouched.
+func normalizeRoutes(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.RouteNormalization == routeNormalizationOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		canonical := canonicalPath(mux, r)
+		if canonical == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cfg.RouteNormalization == routeNormalizationRedirect {
+			target := *r.URL
+			target.Path = canonical
+			target.RawPath = ""
+			http.Redirect(w, r, target.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+
+		r.URL.Path = canonical
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canonicalPath returns the path of r as the route of mux it matches
+// regardless of case and trailing slashes: the static segments as registered
+// and the wildcard values, such as the CEP of /location/{cep}, as sent. Paths
+// matching no route only lose their trailing slashes.
+func canonicalPath(mux *http.ServeMux, r *http.Request) string {
+	path := strings.TrimRight(r.URL.Path, "/")
+	if path == "" {
+		return "/"
+	}
+
+	probe := *r
+	probe.URL = &url.URL{Path: strings.ToLower(path)}
+	_, pattern := mux.Handler(&probe)
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		pattern = p
+	}
+
+	segments := strings.Split(path, "/")
+	routeSegments := strings.Split(pattern, "/")
+	if len(routeSegments) != len(segments) {
+		return path
+	}
+	for i, segment := range routeSegments {
+		if strings.HasPrefix(segment, "{") {
+			continue
+		}
+		if !strings.EqualFold(segments[i], segment) {
+			return path
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,197 @@
+package serviceb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newNormalizedMux returns normalizeRoutes in mode over a mux whose routes
+// answer with the path they were reached at.
+func newNormalizedMux(mode string) http.Handler {
+	cfg = &Config{RouteNormalization: mode}
+	echoPath := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", echoPath)
+	mux.HandleFunc("/metrics", echoPath)
+	mux.HandleFunc("GET /location/{cep}", echoPath)
+	return normalizeRoutes(mux, mux)
+}
+
+func TestNormalizeRoutesRewrite(t *testing.T) {
+	handler := newNormalizedMux(routeNormalizationRewrite)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/health", "/health"},
+		{"/Health", "/health"},
+		{"/HEALTH/", "/health"},
+		{"/Metrics//", "/metrics"},
+		{"/Location/01001-000", "/location/01001-000"},
+		{"/location/01001-000/", "/location/01001-000"},
+		{"/LOCATION/AbC", "/location/AbC"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+			t.Errorf("GET %s = %d %q, want 200 %q", tt.path, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRoutesRedirect(t *testing.T) {
+	handler := newNormalizedMux(routeNormalizationRedirect)
+
+	tests := []struct {
+		path     string
+		location string
+	}{
+		{"/Health", "/health"},
+		{"/metrics/", "/metrics"},
+		{"/Location/01001-000?format=xml", "/location/01001-000?format=xml"},
+		{"/location/AbC/", "/location/AbC"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s = %d Location %q, want 308 %q", tt.path, rec.Code, rec.Header().Get("Location"), tt.location)
+		}
+	}
+
+	// Canonical paths, wildcard values of any case included, are served as is
+	for _, path := range []string{"/health", "/metrics", "/location/01001-000", "/location/AbC"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != path {
+			t.Errorf("GET %s = %d %q, want 200 %q", path, rec.Code, rec.Body, path)
+		}
+	}
+}
+
+func TestNormalizeRoutesOff(t *testing.T) {
+	handler := newNormalizedMux(routeNormalizationOff)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Health/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /Health/ = %d, want 404", rec.Code)
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	setupTestService(t)
+	handler := requireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		body          io.Reader
+		contentType   string
+		contentLength int64
+		want          int
+	}{
+		{name: "json", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "application/json; charset=utf-8", contentLength: 18, want: http.StatusNoContent},
+		{name: "form", method: http.MethodPost, body: strings.NewReader("cep=01001000"), contentType: "application/x-www-form-urlencoded", contentLength: 12, want: http.StatusNoContent},
+		{name: "no body", method: http.MethodPost, body: http.NoBody, want: http.StatusNoContent},
+		{name: "get", method: http.MethodGet, body: strings.NewReader("cep=01001000"), contentType: "text/plain", contentLength: 12, want: http.StatusNoContent},
+		{name: "text", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "text/plain", contentLength: 18, want: http.StatusUnsupportedMediaType},
+		{name: "chunked without content type", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentLength: -1, want: http.StatusUnsupportedMediaType},
+		{name: "undeclared length", method: http.MethodPost, body: strings.NewReader(`{"cep":"01001000"}`), contentType: "text/plain", contentLength: 0, want: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/weather", tt.body)
+			req.ContentLength = tt.contentLength
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// Service A forwards with its own sampling decision in the traceparent
+const (
+	sampledTraceparent   = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	unsampledTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+)
+
+func TestRequireSampledTrace(t *testing.T) {
+	setupTestService(t)
+	cfg.RequireSampledTrace = true
+	handler := requireSampledTrace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		want        int
+	}{
+		{name: "sampled forward", path: "/weather", traceparent: sampledTraceparent, want: http.StatusNoContent},
+		{name: "unsampled forward", path: "/weather", traceparent: unsampledTraceparent, want: http.StatusBadRequest},
+		{name: "uninstrumented client", path: "/weather", want: http.StatusBadRequest},
+		{name: "probe", path: "/health", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSampledTraceRPC(t *testing.T) {
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+
+	tests := []struct {
+		name        string
+		traceparent string
+		want        codes.Code
+	}{
+		{name: "sampled", traceparent: sampledTraceparent, want: codes.OK},
+		{name: "unsampled", traceparent: unsampledTraceparent, want: codes.InvalidArgument},
+		{name: "missing", want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tt.traceparent != "" {
+				md.Set("traceparent", tt.traceparent)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+			_, err := requireSampledTraceRPC(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package serviceb
+
+import (
+	"net/http"
+	"strings"
+
+	"shared"
+)
+
+var (
+	requestBodyTypes = []string{"application/json", formMediaType}
+	responseFormats  = []string{"application/json", "application/msgpack"}
+	weatherFormats   = []string{"application/json", "application/geo+json", "application/msgpack", "application/xml"}
+
+	formatParameters = []shared.EndpointParameter{
+		{Name: "format", In: "query", Description: "response format, json or msgpack; overrides Accept"},
+		{Name: "pretty", In: "query", Description: "indent JSON responses when true"},
+	}
+	providerParameter = shared.EndpointParameter{Name: "X-Weather-Provider", In: "header", Description: "weather provider to query, e.g. weatherapi or openweathermap"}
+	weatherParameters = []shared.EndpointParameter{
+		{Name: "format", In: "query", Description: "response format, json, geojson, msgpack or xml; overrides Accept"},
+		{Name: "pretty", In: "query", Description: "indent JSON responses when true"},
+		{Name: "fields", In: "query", Description: "comma-separated weather fields to return"},
+		{Name: "version", In: "query", Description: "response schema version, 1 or 2; overrides Accept-Version"},
+		providerParameter,
+	}
+)
+
+// describedPaths holds the paths whose OPTIONS handler is registered.
+var describedPaths = make(map[string]bool)
+
+// endpointDescriptions describes every route by path, as registered by handleRoute.
+var endpointDescriptions = map[string]shared.EndpointDescription{
+	"/{$}": {
+		Methods:     []string{http.MethodGet, http.MethodHead},
+		Description: "Service name, version and endpoints",
+		Formats:     responseFormats,
+		Parameters:  formatParameters,
+	},
+	"/weather": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Current weather for a CEP",
+		ContentTypes: requestBodyTypes,
+		Formats:      weatherFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "cep", In: "body", Description: "8-digit CEP, with or without separators"},
+			{Name: "date", In: "query", Description: "past date (YYYY-MM-DD) for that day's history"},
+			{Name: "fast", In: "query", Description: "return the location right away if the weather is slow, when true"},
+			{Name: "formatted", In: "query", Description: "format the temperatures as strings, when true"},
+			{Name: "includeMeta", In: "query", Description: "include the IBGE code and DDD, when true"},
+			{Name: "fullAddress", In: "query", Description: "include the street address, when true"},
+			{Name: "includeCoords", In: "query", Description: "include the coordinates the weather was measured at, when true"},
+			{Name: "includeMeasuredAt", In: "query", Description: "include when the provider measured the weather, when true"},
+			{Name: "extended", In: "query", Description: "include the humidity and UV index, when true"},
+			{Name: "alerts", In: "query", Description: "include the active weather alerts, when true"},
+			{Name: "timings", In: "query", Description: "include the time spent on each upstream, when true"},
+			{Name: "topology", In: "query", Description: "include the services involved and their durations, when true"},
+		}, weatherParameters...),
+	},
+	"/weather/city": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Current weather for a city name",
+		ContentTypes: requestBodyTypes,
+		Formats:      weatherFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "city", In: "body", Description: "city name, up to 100 characters"},
+			{Name: "formatted", In: "query", Description: "format the temperatures as strings, when true"},
+			{Name: "includeCoords", In: "query", Description: "include the coordinates the weather was measured at, when true"},
+			{Name: "includeMeasuredAt", In: "query", Description: "include when the provider measured the weather, when true"},
+			{Name: "extended", In: "query", Description: "include the humidity and UV index, when true"},
+		}, weatherParameters...),
+	},
+	"/weather/batch": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Current weather for up to MAX_BATCH_SIZE CEPs",
+		ContentTypes: []string{"application/json"},
+		Formats:      responseFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "ceps", In: "body", Description: "list of 8-digit CEPs"},
+			{Name: "async", In: "query", Description: "run the batch, of up to MAX_BATCH_JOB_SIZE CEPs, as a background job, when true"},
+			providerParameter,
+		}, formatParameters...),
+	},
+	"/weather/batch/{job_id}": {
+		Methods:     []string{http.MethodGet, http.MethodDelete},
+		Description: "Status and partial results of an async batch job; DELETE cancels it",
+		Formats:     responseFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "job_id", In: "path", Description: "ID returned when the job was submitted"},
+		}, formatParameters...),
+	},
+	"/weather/stream/{cep}": {
+		Methods:     []string{http.MethodGet},
+		Description: "Weather for a CEP pushed as Server-Sent Events every STREAM_INTERVAL",
+		Formats:     []string{"text/event-stream"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "cep", In: "path", Description: "8-digit CEP"},
+			providerParameter,
+		},
+	},
+	"/location": {
+		Methods:      []string{http.MethodPost},
+		Description:  "Location of a CEP, without the weather",
+		ContentTypes: requestBodyTypes,
+		Formats:      responseFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "cep", In: "body", Description: "8-digit CEP, with or without separators"},
+			{Name: "includeMeta", In: "query", Description: "include the IBGE code and DDD, when true"},
+		}, formatParameters...),
+	},
+	"/location/{cep}": {
+		Methods:     []string{http.MethodGet, http.MethodHead},
+		Description: "Location of a CEP, without the weather; HEAD only checks that it exists",
+		Formats:     responseFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "cep", In: "path", Description: "8-digit CEP, with or without separators"},
+			{Name: "includeMeta", In: "query", Description: "include the IBGE code and DDD, when true"},
+		}, formatParameters...),
+	},
+	"/location/search": {
+		Methods:      []string{http.MethodPost},
+		Description:  "CEPs of an address, the reverse of /location",
+		ContentTypes: requestBodyTypes,
+		Formats:      responseFormats,
+		Parameters: append([]shared.EndpointParameter{
+			{Name: "uf", In: "body", Description: "state abbreviation, e.g. SP"},
+			{Name: "city", In: "body", Description: "city name, at least 3 characters"},
+			{Name: "street", In: "body", Description: "street name, at least 3 characters"},
+		}, formatParameters...),
+	},
+	"/health": {
+		Methods:     []string{http.MethodGet},
+		Description: "Liveness probe",
+		Formats:     responseFormats,
+	},
+	"/ready": {
+		Methods:     []string{http.MethodGet},
+		Description: "Readiness probe, failing while the upstreams keep failing",
+		Formats:     []string{"application/json"},
+	},
+	"/metrics": {
+		Methods:     []string{http.MethodGet},
+		Description: "Application and Go runtime metrics for Prometheus",
+		Formats:     []string{"text/plain"},
+	},
+	"/health/detailed": {
+		Methods:     []string{http.MethodGet},
+		Description: "Status of each dependency",
+		Formats:     responseFormats,
+	},
+	"/stats": {
+		Methods:     []string{http.MethodGet},
+		Description: "Request counts and latencies by endpoint",
+		Formats:     []string{"application/json"},
+	},
+	"/debug/flags": {
+		Methods:      []string{http.MethodGet, http.MethodPost},
+		Description:  "List the feature flags, or change them with a JSON object of flag names to booleans",
+		ContentTypes: []string{"application/json"},
+		Formats:      []string{"application/json"},
+	},
+	"/debug/flush": {
+		Methods:     []string{http.MethodPost},
+		Description: "Flush the buffered telemetry",
+		Formats:     []string{"application/json"},
+	},
+	"/debug/slow": {
+		Methods:     []string{http.MethodGet},
+		Description: "Answer after the requested delay",
+		Formats:     []string{"application/json"},
+		Parameters: []shared.EndpointParameter{
+			{Name: "ms", In: "query", Description: "delay in milliseconds, up to 30000"},
+		},
+	},
+	"/debug/errors": {
+		Methods:     []string{http.MethodGet},
+		Description: "The latest error responses",
+		Formats:     []string{"application/json"},
+	},
+	"/debug/upstream/recent": {
+		Methods:     []string{http.MethodGet},
+		Description: "The latest upstream requests",
+		Formats:     []string{"application/json"},
+	},
+}
+
+// handleOptionsRoute registers the OPTIONS handler of path on mux the first
+// time a route of path is registered, answering with its description and an
+// Allow header. Its pattern is more specific than the ones without a method,
+// so the route's own handler never sees OPTIONS.
+func handleOptionsRoute(mux *http.ServeMux, path string) {
+	description, ok := endpointDescriptions[path]
+	if !ok || describedPaths[path] {
+		return
+	}
+	describedPaths[path] = true
+	mux.HandleFunc(http.MethodOptions+" "+path, shared.DescribeEndpoint(strings.TrimSuffix(path, "{$}"), description, encodeResponse))
+}
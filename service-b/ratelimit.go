@@ -0,0 +1,70 @@
+package serviceb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+// retryRateLimited handles a 429 from an upstream provider. When the provider
+// sent a Retry-After that fits within both maxWait and the request deadline, it
+// waits and retries the request once; otherwise, or if the retry is throttled
+// too, it returns a *RateLimitedError. The throttled response body is consumed.
+func retryRateLimited(ctx context.Context, client *http.Client, req *http.Request, resp *http.Response, provider string, maxWait time.Duration) (*http.Response, error) {
+	span := trace.SpanFromContext(ctx)
+
+	retryAfter, ok := consumeRateLimited(span, resp, provider, 1)
+	if !ok || retryAfter > maxWait || !fitsDeadline(ctx, retryAfter) {
+		return nil, &RateLimitedError{Provider: provider, RetryAfter: retryAfter}
+	}
+
+	timer := time.NewTimer(retryAfter)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	countRetry(ctx)
+	retryResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if retryResp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ = consumeRateLimited(span, retryResp, provider, 2)
+		return nil, &RateLimitedError{Provider: provider, RetryAfter: retryAfter}
+	}
+	return retryResp, nil
+}
+
+// consumeRateLimited records the throttling event, drains the response and
+// returns its Retry-After delay, if any.
+func consumeRateLimited(span trace.Span, resp *http.Response, provider string, attempt int) (time.Duration, bool) {
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	span.AddEvent(provider+".rate_limited", trace.WithAttributes(
+		attribute.Int("rate_limit.attempt", attempt),
+		attribute.Int64("rate_limit.retry_after_ms", retryAfter.Milliseconds()),
+	))
+	return retryAfter, ok
+}
+
+func fitsDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > wait
+}
+
+// writeRateLimitedResponse tells the client to come back later with a 503 and a
+// Retry-After of at least one second.
+func writeRateLimitedResponse(w http.ResponseWriter, r *http.Request, err *RateLimitedError) {
+	shared.SetRetryAfter(w, r, err.RetryAfter, cfg.RetryAfterJitter)
+	writeErrorResponse(w, r, "upstream rate limited, try again later", http.StatusServiceUnavailable)
+}
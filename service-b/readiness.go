@@ -0,0 +1,123 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+const (
+	// upstreamHealthBucketWidth is the resolution of the upstream error rate.
+	upstreamHealthBucketWidth = 10 * time.Second
+
+	// minUpstreamSamples is how many upstream requests the window must hold
+	// before its error rate can trip readiness, so a couple of failures on an
+	// idle pod do not take it out of rotation.
+	minUpstreamSamples = 10
+)
+
+type ReadyResponse struct {
+	Status    string  `json:"status"`
+	ErrorRate float64 `json:"upstream_error_rate"`
+	Requests  int64   `json:"upstream_requests"`
+}
+
+// upstreamHealth tracks the outcome of every upstream request over the last
+// UPSTREAM_FAILURE_WINDOW and turns the pod unready while their error rate
+// stays above UPSTREAM_FAILURE_THRESHOLD.
+type upstreamHealth struct {
+	mu       sync.Mutex
+	counts   *shared.ErrorCounts
+	unready  bool
+	lastRate float64
+	lastSeen int64
+}
+
+var upstreams = &upstreamHealth{}
+
+func (h *upstreamHealth) record(ctx context.Context, failed bool) {
+	now := shared.Now()
+	h.mu.Lock()
+	if h.counts == nil {
+		h.counts = shared.NewErrorCounts(upstreamHealthBucketWidth, cfg.UpstreamFailureWindow)
+	}
+	h.counts.Record(now, failed)
+	h.mu.Unlock()
+
+	h.evaluate(ctx, now)
+}
+
+// evaluate recomputes the error rate over the window and reports whether the
+// pod is ready, logging and adding a span event on every transition.
+func (h *upstreamHealth) evaluate(ctx context.Context, now time.Time) bool {
+	h.mu.Lock()
+	var total, errors int64
+	if h.counts != nil {
+		total, errors = h.counts.Over(now, cfg.UpstreamFailureWindow)
+	}
+	rate := 0.0
+	if total > 0 {
+		rate = float64(errors) / float64(total)
+	}
+	unready := total >= minUpstreamSamples && rate > cfg.UpstreamFailureThreshold
+	changed := unready != h.unready
+	h.unready, h.lastRate, h.lastSeen = unready, rate, total
+	h.mu.Unlock()
+
+	if changed {
+		attrs := []any{"upstream_error_rate", rate, "upstream_requests", total, "window", cfg.UpstreamFailureWindow}
+		if unready {
+			slog.Warn("upstream error rate above threshold, reporting not ready", attrs...)
+		} else {
+			slog.Info("upstream error rate recovered, reporting ready", attrs...)
+		}
+		trace.SpanFromContext(ctx).AddEvent("readiness.changed", trace.WithAttributes(
+			attribute.Bool("readiness.ready", !unready),
+			attribute.Float64("upstream.error_rate", rate),
+		))
+	}
+	return !unready
+}
+
+// upstreamHealthRoundTripper records whether each upstream request failed,
+// with a transport error or a 5xx, towards readiness.
+type upstreamHealthRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t upstreamHealthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	upstreams.record(req.Context(), err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// handleReady is the readiness probe: 503 while the upstreams keep failing,
+// so the orchestrator stops routing to (and may restart) this pod.
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-ready-request")
+
+	ready := upstreams.evaluate(r.Context(), shared.Now())
+	upstreams.mu.Lock()
+	response := ReadyResponse{Status: "ready", ErrorRate: upstreams.lastRate, Requests: upstreams.lastSeen}
+	upstreams.mu.Unlock()
+
+	statusCode := http.StatusOK
+	if !ready {
+		response.Status = "not_ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode ready response: %v", err)
+	}
+}
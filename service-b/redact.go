@@ -0,0 +1,91 @@
+package serviceb
+
+import (
+	"context"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const cepAttributeKey = attribute.Key("cep")
+
+// urlAttributeKeys hold upstream URLs, which embed the CEP in the ViaCEP path.
+var urlAttributeKeys = map[attribute.Key]bool{
+	"url.full": true,
+	"http.url": true,
+}
+
+var cepInURL = regexp.MustCompile(`\d{8}`)
+
+// cepRedactingProcessor wraps a span processor and masks the cep attribute (and
+// CEPs embedded in upstream URLs) of every span before handing it on, so full
+// postal codes never leave the process.
+type cepRedactingProcessor struct {
+	next sdktrace.SpanProcessor
+}
+
+func newCEPRedactingProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &cepRedactingProcessor{next: next}
+}
+
+func (p *cepRedactingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *cepRedactingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(redactedSpan{ReadOnlySpan: s})
+}
+
+func (p *cepRedactingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *cepRedactingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// redactedSpan is a read-only view of a span whose cep attribute is masked,
+// on the span itself and on its events.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return redactAttributes(s.ReadOnlySpan.Attributes())
+}
+
+// Events masks the attributes of events too, e.g. weather.invalid_location,
+// which records the CEP it was raised for.
+func (s redactedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]sdktrace.Event, len(events))
+	for i, event := range events {
+		event.Attributes = redactAttributes(event.Attributes)
+		redacted[i] = event
+	}
+	return redacted
+}
+
+func redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	redacted := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		switch {
+		case attr.Key == cepAttributeKey:
+			attr = cepAttributeKey.String(maskCEP(attr.Value.AsString()))
+		case urlAttributeKeys[attr.Key]:
+			attr = attr.Key.String(cepInURL.ReplaceAllStringFunc(attr.Value.AsString(), maskCEP))
+		}
+		redacted[i] = attr
+	}
+	return redacted
+}
+
+// maskCEP keeps the first five digits (the CEP's region, sub-region, sector,
+// sub-sector and sector divisor) and hides the suffix, e.g. "01001***".
+func maskCEP(cep string) string {
+	if len(cep) <= 5 {
+		return "***"
+	}
+	return cep[:5] + "***"
+}
@@ -0,0 +1,45 @@
+package serviceb
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestCEPRedactingProcessor checks that no full CEP reaches the exporter,
+// neither in the attributes of a span nor in those of its events.
+func TestCEPRedactingProcessor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newCEPRedactingProcessor(recorder)))
+	defer provider.Shutdown(context.Background())
+
+	_, span := provider.Tracer("test").Start(context.Background(), "lookup",
+		trace.WithAttributes(attribute.String("cep", "01001000"), attribute.String("url.full", "https://viacep.com.br/ws/01001000/json/")))
+	span.AddEvent("weather.invalid_location", trace.WithAttributes(attribute.String("cep", "01001000")))
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	want := map[attribute.Key]string{
+		"cep":      "01001***",
+		"url.full": "https://viacep.com.br/ws/01001***/json/",
+	}
+	for _, attr := range spans[0].Attributes() {
+		if attr.Value.AsString() != want[attr.Key] {
+			t.Errorf("span attribute %s = %q, want %q", attr.Key, attr.Value.AsString(), want[attr.Key])
+		}
+	}
+	events := spans[0].Events()
+	if len(events) != 1 || len(events[0].Attributes) != 1 {
+		t.Fatalf("events = %v, want one with the cep attribute", events)
+	}
+	if got := events[0].Attributes[0].Value.AsString(); got != "01001***" {
+		t.Errorf("event cep = %q, want 01001***", got)
+	}
+}
@@ -0,0 +1,96 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+	"shared"
+)
+
+// redisTimeout bounds every Redis round trip, so a slow Redis degrades into
+// cache misses instead of slow requests.
+const redisTimeout = 500 * time.Millisecond
+
+// redisClient is set from REDIS_URL; nil keeps the caches in memory.
+var redisClient *redis.Client
+
+// redisEntry is what redisCache stores. MessagePack keeps the fields that are
+// hidden from the JSON responses, such as the provider's cache TTL.
+type redisEntry[V any] struct {
+	Value     V
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+// redisCache is a Cache shared by every instance through Redis. Redis errors
+// are logged and treated as misses.
+type redisCache[V any] struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisCache[V any](client *redis.Client, name string, ttl time.Duration) *redisCache[V] {
+	return &redisCache[V]{client: client, prefix: "service-b:" + name + ":", ttl: ttl}
+}
+
+func (c *redisCache[V]) Backend() string { return "redis" }
+
+func (c *redisCache[V]) Get(key string) (V, bool) {
+	entry, ok := c.GetEntry(key)
+	return entry.value, ok
+}
+
+func (c *redisCache[V]) GetWithTTL(key string) (V, time.Duration, bool) {
+	entry, ok := c.GetEntry(key)
+	return entry.value, time.Until(entry.expiresAt), ok
+}
+
+func (c *redisCache[V]) GetEntry(key string) (cacheEntry[V], bool) {
+	if c.ttl <= 0 {
+		return cacheEntry[V]{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Redis cache get failed: %v", err)
+		}
+		return cacheEntry[V]{}, false
+	}
+
+	var entry redisEntry[V]
+	if err := msgpack.Unmarshal(data, &entry); err != nil {
+		log.Printf("Redis cache entry %q is unreadable: %v", c.prefix+key, err)
+		return cacheEntry[V]{}, false
+	}
+	return cacheEntry[V]{value: entry.Value, storedAt: entry.StoredAt, expiresAt: entry.ExpiresAt}, true
+}
+
+func (c *redisCache[V]) Set(key string, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *redisCache[V]) SetWithTTL(key string, value V, ttl time.Duration) {
+	if c.ttl <= 0 || ttl <= 0 {
+		return
+	}
+	now := shared.Now()
+	data, err := msgpack.Marshal(redisEntry[V]{Value: value, StoredAt: now, ExpiresAt: now.Add(ttl)})
+	if err != nil {
+		log.Printf("Failed to encode Redis cache entry: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := c.client.Set(ctx, c.prefix+key, data, ttl).Err(); err != nil {
+		log.Printf("Redis cache set failed: %v", err)
+	}
+}
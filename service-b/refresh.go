@@ -0,0 +1,76 @@
+package serviceb
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+const (
+	// maxConcurrentRefreshes bounds the refresh-ahead fetches running at once;
+	// entries read while every slot is taken are simply not refreshed early.
+	maxConcurrentRefreshes = 4
+
+	// refreshTimeout bounds each refresh-ahead fetch.
+	refreshTimeout = 10 * time.Second
+)
+
+var (
+	refreshSlots = make(chan struct{}, maxConcurrentRefreshes)
+
+	// refreshing holds the cache keys with a refresh in progress.
+	refreshing sync.Map
+)
+
+// refreshAhead refetches the weather of a cache entry that was just served
+// within CACHE_REFRESH_AHEAD of its expiry, so popular entries are replaced
+// before they expire instead of making the next request wait. It runs in the
+// background, in a trace of its own linked to the request that triggered it.
+func refreshAhead(ctx context.Context, provider WeatherProvider, location *Location, key string, expiresAt time.Time) {
+	if cfg.CacheRefreshAhead <= 0 || expiresAt.Sub(shared.Now()) > cfg.CacheRefreshAhead {
+		return
+	}
+	if _, loaded := refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	select {
+	case refreshSlots <- struct{}{}:
+	default:
+		refreshing.Delete(key)
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.weather.refresh_ahead", true))
+
+	link := trace.LinkFromContext(ctx)
+	go func() {
+		defer func() {
+			<-refreshSlots
+			refreshing.Delete(key)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		ctx, span := tracer.Start(ctx, "cache-refresh-ahead", trace.WithNewRoot(), trace.WithLinks(link))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("weather.provider", provider.Name()),
+			attribute.String("location", location.City),
+			attribute.Int64("cache.weather.remaining_ms", expiresAt.Sub(shared.Now()).Milliseconds()),
+		)
+
+		weather, err := getWeatherFromAPI(ctx, provider, location)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "refresh failed")
+			log.Printf("Refresh-ahead of %q failed: %v", key, err)
+			return
+		}
+		weatherCache.SetWithTTL(key, *weather, weatherCacheTTL(ctx, weather))
+	}()
+}
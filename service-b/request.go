@@ -0,0 +1,46 @@
+package serviceb
+
+import (
+	"errors"
+	"net/http"
+
+	"shared"
+)
+
+const formMediaType = shared.FormMediaType
+
+// decodeCEPRequest reads the CEP from the JSON body of r or, for legacy
+// clients posting HTML forms, from its cep form field.
+func decodeCEPRequest(r *http.Request) (CEPRequest, error) {
+	var req CEPRequest
+	if shared.IsFormRequest(r) {
+		if err := r.ParseForm(); err != nil {
+			return req, err
+		}
+		req.CEP = r.FormValue("cep")
+		return req, nil
+	}
+	err := decodeJSONBody(r, &req)
+	return req, err
+}
+
+// decodeJSONBody decodes the JSON body of r into v with shared.DecodeJSONBody,
+// strictly with STRICT_JSON=true.
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	return shared.DecodeJSONBody(r, v, cfg.StrictJSON)
+}
+
+// writeDecodeError answers a request whose body could not be decoded.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var duplicate *shared.DuplicateFieldError
+	if errors.As(err, &duplicate) {
+		writeCodedErrorResponse(w, r, "duplicate_field", duplicate.Error(), http.StatusBadRequest)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeErrorResponse(w, r, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	writeErrorResponse(w, r, "invalid request body", http.StatusBadRequest)
+}
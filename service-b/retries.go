@@ -0,0 +1,34 @@
+package serviceb
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type retryCounterKey struct{}
+
+// countRetry adds one to the retries of the request ctx belongs to, if any.
+func countRetry(ctx context.Context) {
+	if counter, ok := ctx.Value(retryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
+
+// countRetries accumulates every retry the request incurs upstream (HTTP
+// retries, rate-limit waits and DNS retries) and records the total as the
+// retries.total attribute of the request span and in request_retries.
+func countRetries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &atomic.Int64{}
+		ctx := context.WithValue(r.Context(), retryCounterKey{}, counter)
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		total := counter.Load()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("retries.total", total))
+		requestRetries.Record(ctx, total)
+	})
+}
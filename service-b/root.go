@@ -0,0 +1,24 @@
+package serviceb
+
+import (
+	"net/http"
+)
+
+// serviceVersion is reported on the resource and by the landing response.
+const serviceVersion = "1.0.0"
+
+type RootResponse struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// handleRoot answers a quick check of / with what this service is and the
+// endpoints it serves, as registered by handleRoute. It does no upstream work.
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	encodeResponse(w, r, http.StatusOK, RootResponse{
+		Service:   "service-b",
+		Version:   serviceVersion,
+		Endpoints: routes,
+	})
+}
@@ -0,0 +1,149 @@
+package serviceb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// samplingPriorityKey marks spans the collector should keep regardless of its
+// own sampling decisions.
+const samplingPriorityKey = attribute.Key("sampling.priority")
+
+// samplingPriorityHeader lets clients force the sampling of a request, e.g.
+// to debug it, when TRUST_SAMPLING_PRIORITY is set.
+const samplingPriorityHeader = "X-Sampling-Priority"
+
+// forcedSampleKey marks the context of a request whose spans must be sampled.
+type forcedSampleKey struct{}
+
+// honorSamplingPriority marks the requests sent with X-Sampling-Priority: 1 for
+// errorAwareSampler to sample whatever the ratio. It has to run ahead of
+// otelhttp, so the mark is in the context the server span starts from.
+func honorSamplingPriority(next http.Handler) http.Handler {
+	if !cfg.TrustSamplingPriority {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(samplingPriorityHeader) == "1" {
+			r = r.WithContext(context.WithValue(r.Context(), forcedSampleKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errorAwareSampler samples spans started with error=true or for a request
+// that asked for it with X-Sampling-Priority, and ratio-samples the rest.
+// Spans that lose the roll are still recorded, so errorKeepingProcessor can
+// export them after all if they end in error.
+type errorAwareSampler struct {
+	ratio sdktrace.Sampler
+}
+
+func newErrorAwareSampler(ratio float64) sdktrace.Sampler {
+	root := errorAwareSampler{ratio: sdktrace.TraceIDRatioBased(ratio)}
+	return sdktrace.ParentBased(root,
+		sdktrace.WithRemoteParentNotSampled(root),
+		sdktrace.WithLocalParentNotSampled(root),
+	)
+}
+
+func (s errorAwareSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if forced, _ := p.ParentContext.Value(forcedSampleKey{}).(bool); forced {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Attributes: []attribute.KeyValue{attribute.Bool("forced_sample", true), samplingPriorityKey.Int(1)},
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	for _, attr := range p.Attributes {
+		if attr.Key == "error" && attr.Value.AsBool() {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.RecordAndSample,
+				Attributes: []attribute.KeyValue{samplingPriorityKey.Int(1)},
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	result := s.ratio.ShouldSample(p)
+	if result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s errorAwareSampler) Description() string {
+	return fmt.Sprintf("ErrorAware{%s}", s.ratio.Description())
+}
+
+// errorKeepingProcessor wraps a span processor and hands on every span that
+// ended in error, marked with sampling.priority=1 and flagged as sampled even
+// if the ratio sampler had only recorded it.
+type errorKeepingProcessor struct {
+	next sdktrace.SpanProcessor
+}
+
+func newErrorKeepingProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return &errorKeepingProcessor{next: next}
+}
+
+func (p *errorKeepingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *errorKeepingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if spanFailed(s) {
+		p.next.OnEnd(keptSpan{ReadOnlySpan: s})
+		return
+	}
+	p.next.OnEnd(s)
+}
+
+func (p *errorKeepingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *errorKeepingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// spanFailed reports whether s ended with an error status or had an error
+// recorded on it, which is how most handlers here report failures.
+func spanFailed(s sdktrace.ReadOnlySpan) bool {
+	if s.Status().Code == codes.Error {
+		return true
+	}
+	for _, event := range s.Events() {
+		if event.Name == semconv.ExceptionEventName {
+			return true
+		}
+	}
+	return false
+}
+
+// keptSpan is a read-only view of an errored span that reports itself as
+// sampled and carries sampling.priority=1.
+type keptSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s keptSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+func (s keptSpan) Attributes() []attribute.KeyValue {
+	attrs := s.ReadOnlySpan.Attributes()
+	for _, attr := range attrs {
+		if attr.Key == samplingPriorityKey {
+			return attrs
+		}
+	}
+	return append(attrs[:len(attrs):len(attrs)], samplingPriorityKey.Int(1))
+}
@@ -0,0 +1,263 @@
+package serviceb
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Response schema versions: schemaV1 is the legacy layout, with the unit of
+// temperature fields in upper case ("temp_C"), and schemaV2 the current one,
+// with every field name in lower case ("temp_c"). Both are served while
+// clients migrate.
+const (
+	schemaV1 = "1"
+	schemaV2 = "2"
+
+	latestSchemaVersion = schemaV2
+)
+
+// negotiateSchemaVersion picks the response schema version from the ?version
+// query parameter or the Accept-Version header, defaulting to
+// RESPONSE_SCHEMA_VERSION. It reports false for a version we do not serve.
+func negotiateSchemaVersion(r *http.Request) (string, bool) {
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = strings.TrimSpace(r.Header.Get("Accept-Version"))
+	}
+	if version == "" {
+		return cfg.ResponseSchemaVersion, true
+	}
+	return parseSchemaVersion(version)
+}
+
+// parseSchemaVersion accepts a version with or without a "v" prefix.
+func parseSchemaVersion(value string) (string, bool) {
+	version := strings.TrimPrefix(strings.ToLower(value), "v")
+	switch version {
+	case schemaV1, schemaV2:
+		return version, true
+	}
+	return "", false
+}
+
+// versionedPayload returns v laid out as version. The legacy layout is the
+// one of the response types, and each of those with renamed fields has a
+// schemaV2 counterpart below, so JSON, MessagePack and XML all send the
+// renamed fields in the order of the struct.
+func versionedPayload(v interface{}, version string) interface{} {
+	if version != schemaV2 {
+		return v
+	}
+	switch payload := v.(type) {
+	case *WeatherResponse:
+		return newWeatherResponseV2(payload)
+	case GeoJSONFeature:
+		return geoJSONFeatureV2{Type: payload.Type, Geometry: payload.Geometry, Properties: newWeatherResponseV2(&payload.Properties)}
+	case PendingWeatherResponse:
+		return pendingWeatherResponseV2(payload)
+	case *WeatherHistoryResponse:
+		return (*weatherHistoryResponseV2)(payload)
+	case *WeatherForecastResponse:
+		forecast := weatherForecastResponseV2{City: payload.City, Days: make([]weatherForecastDayV2, len(payload.Days))}
+		for i, day := range payload.Days {
+			forecast.Days[i] = weatherForecastDayV2(day)
+		}
+		return forecast
+	case BatchResponse:
+		return batchResponseV2{Results: newBatchItemsV2(payload.Results)}
+	case BatchJobResponse:
+		return batchJobResponseV2{
+			JobID:     payload.JobID,
+			Status:    payload.Status,
+			Total:     payload.Total,
+			Completed: payload.Completed,
+			Failed:    payload.Failed,
+			Results:   newBatchItemsV2(payload.Results),
+			CreatedAt: payload.CreatedAt,
+			ExpiresAt: payload.ExpiresAt,
+			Error:     payload.Error,
+		}
+	}
+	return v
+}
+
+// schemaFieldName returns the name a legacy field is sent under in version,
+// for ?fields to select it from a versioned payload.
+func schemaFieldName(name, version string) string {
+	if version == schemaV2 {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// legacyFieldName returns the legacy name of a field ?fields lists by its
+// schemaV2 name, so both layouts select fields by the names they send.
+func legacyFieldName(name string) string {
+	for legacy := range weatherFields {
+		if strings.ToLower(legacy) == name {
+			return legacy
+		}
+	}
+	return name
+}
+
+// weatherResponseV2 is WeatherResponse as sent in schemaV2.
+type weatherResponseV2 struct {
+	City        string   `json:"city" xml:"city"`
+	TempC       float64  `json:"temp_c" xml:"temp_c"`
+	TempF       float64  `json:"temp_f" xml:"temp_f"`
+	TempK       float64  `json:"temp_k" xml:"temp_k"`
+	TempRankine *float64 `json:"temp_rankine,omitempty" xml:"temp_rankine,omitempty"`
+	TempReaumur *float64 `json:"temp_reaumur,omitempty" xml:"temp_reaumur,omitempty"`
+
+	FeelsLikeC float64 `json:"feelslike_c" xml:"feelslike_c"`
+	FeelsLikeF float64 `json:"feelslike_f" xml:"feelslike_f"`
+	FeelsLikeK float64 `json:"feelslike_k" xml:"feelslike_k"`
+
+	LocalTime      string `json:"local_time,omitempty" xml:"local_time,omitempty"`
+	TempCFormatted string `json:"temp_c_formatted,omitempty" xml:"temp_c_formatted,omitempty"`
+	TempFFormatted string `json:"temp_f_formatted,omitempty" xml:"temp_f_formatted,omitempty"`
+
+	Meta     *LocationMeta     `json:"meta,omitempty" xml:"meta,omitempty"`
+	Address  *ViaCEPResponse   `json:"address,omitempty" xml:"address,omitempty"`
+	Timings  *ResponseTimings  `json:"timings,omitempty" xml:"timings,omitempty"`
+	Topology []TopologyHop     `json:"topology,omitempty" xml:"hop,omitempty"`
+	Sources  []weatherSourceV2 `json:"sources,omitempty" xml:"reading,omitempty"`
+	Alerts   []WeatherAlert    `json:"alerts,omitempty" xml:"alert,omitempty"`
+	Source   string            `json:"source,omitempty" xml:"source,omitempty"`
+	Mock     *bool             `json:"mock,omitempty" xml:"mock,omitempty"`
+
+	MeasuredLatitude  *float64 `json:"latitude,omitempty" xml:"latitude,omitempty"`
+	MeasuredLongitude *float64 `json:"longitude,omitempty" xml:"longitude,omitempty"`
+	Humidity          *int     `json:"humidity,omitempty" xml:"humidity,omitempty"`
+	UV                *float64 `json:"uv,omitempty" xml:"uv,omitempty"`
+	MeasuredAt        string   `json:"measured_at,omitempty" xml:"measured_at,omitempty"`
+}
+
+func newWeatherResponseV2(weather *WeatherResponse) *weatherResponseV2 {
+	if weather == nil {
+		return nil
+	}
+	var sources []weatherSourceV2
+	for _, source := range weather.Sources {
+		sources = append(sources, weatherSourceV2(source))
+	}
+	return &weatherResponseV2{
+		City:              weather.City,
+		TempC:             weather.TempC,
+		TempF:             weather.TempF,
+		TempK:             weather.TempK,
+		TempRankine:       weather.TempRankine,
+		TempReaumur:       weather.TempReaumur,
+		FeelsLikeC:        weather.FeelsLikeC,
+		FeelsLikeF:        weather.FeelsLikeF,
+		FeelsLikeK:        weather.FeelsLikeK,
+		LocalTime:         weather.LocalTime,
+		TempCFormatted:    weather.TempCFormatted,
+		TempFFormatted:    weather.TempFFormatted,
+		Meta:              weather.Meta,
+		Address:           weather.Address,
+		Timings:           weather.Timings,
+		Topology:          weather.Topology,
+		Sources:           sources,
+		Alerts:            weather.Alerts,
+		Source:            weather.Source,
+		Mock:              weather.Mock,
+		MeasuredLatitude:  weather.MeasuredLatitude,
+		MeasuredLongitude: weather.MeasuredLongitude,
+		Humidity:          weather.Humidity,
+		UV:                weather.UV,
+		MeasuredAt:        weather.MeasuredAt,
+	}
+}
+
+// weatherSourceV2 is WeatherSource as sent in schemaV2.
+type weatherSourceV2 struct {
+	Provider string  `json:"provider" xml:"provider"`
+	TempC    float64 `json:"temp_c" xml:"temp_c"`
+}
+
+// geoJSONFeatureV2 is GeoJSONFeature as sent in schemaV2.
+type geoJSONFeatureV2 struct {
+	Type       string             `json:"type"`
+	Geometry   *GeoJSONGeometry   `json:"geometry"`
+	Properties *weatherResponseV2 `json:"properties"`
+}
+
+// pendingWeatherResponseV2 is PendingWeatherResponse as sent in schemaV2.
+type pendingWeatherResponseV2 struct {
+	City           string   `json:"city"`
+	TempC          *float64 `json:"temp_c"`
+	TempF          *float64 `json:"temp_f"`
+	TempK          *float64 `json:"temp_k"`
+	WeatherPending bool     `json:"weather_pending"`
+}
+
+// weatherHistoryResponseV2 is WeatherHistoryResponse as sent in schemaV2.
+type weatherHistoryResponseV2 struct {
+	City     string  `json:"city"`
+	Date     string  `json:"date"`
+	AvgTempC float64 `json:"avg_temp_c"`
+	AvgTempF float64 `json:"avg_temp_f"`
+	AvgTempK float64 `json:"avg_temp_k"`
+	MaxTempC float64 `json:"max_temp_c"`
+	MaxTempF float64 `json:"max_temp_f"`
+	MaxTempK float64 `json:"max_temp_k"`
+	MinTempC float64 `json:"min_temp_c"`
+	MinTempF float64 `json:"min_temp_f"`
+	MinTempK float64 `json:"min_temp_k"`
+}
+
+// weatherForecastResponseV2 is WeatherForecastResponse as sent in schemaV2.
+type weatherForecastResponseV2 struct {
+	City string                 `json:"city"`
+	Days []weatherForecastDayV2 `json:"forecast"`
+}
+
+// weatherForecastDayV2 is WeatherForecastDay as sent in schemaV2.
+type weatherForecastDayV2 struct {
+	Date     string  `json:"date"`
+	AvgTempC float64 `json:"avg_temp_c"`
+	AvgTempF float64 `json:"avg_temp_f"`
+	AvgTempK float64 `json:"avg_temp_k"`
+	MaxTempC float64 `json:"max_temp_c"`
+	MaxTempF float64 `json:"max_temp_f"`
+	MaxTempK float64 `json:"max_temp_k"`
+	MinTempC float64 `json:"min_temp_c"`
+	MinTempF float64 `json:"min_temp_f"`
+	MinTempK float64 `json:"min_temp_k"`
+}
+
+// batchItemV2 is BatchItem as sent in schemaV2.
+type batchItemV2 struct {
+	CEP     string             `json:"cep"`
+	Weather *weatherResponseV2 `json:"weather,omitempty"`
+	Error   *ErrorResponse     `json:"error,omitempty"`
+}
+
+func newBatchItemsV2(items []BatchItem) []batchItemV2 {
+	versioned := make([]batchItemV2, len(items))
+	for i, item := range items {
+		versioned[i] = batchItemV2{CEP: item.CEP, Weather: newWeatherResponseV2(item.Weather), Error: item.Error}
+	}
+	return versioned
+}
+
+// batchResponseV2 is BatchResponse as sent in schemaV2.
+type batchResponseV2 struct {
+	Results []batchItemV2 `json:"results"`
+}
+
+// batchJobResponseV2 is BatchJobResponse as sent in schemaV2.
+type batchJobResponseV2 struct {
+	JobID     string         `json:"job_id"`
+	Status    string         `json:"status"`
+	Total     int            `json:"total"`
+	Completed int            `json:"completed"`
+	Failed    int            `json:"failed"`
+	Results   []batchItemV2  `json:"results"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
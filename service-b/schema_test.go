@@ -0,0 +1,86 @@
+package serviceb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSchemaV2Fields checks that every schemaV2 type sends the fields of its
+// legacy counterpart in lower case, so a field added to a response type is
+// not silently left out of schemaV2.
+func TestSchemaV2Fields(t *testing.T) {
+	pairs := []struct {
+		legacy, v2 interface{}
+	}{
+		{WeatherResponse{}, weatherResponseV2{}},
+		{WeatherSource{}, weatherSourceV2{}},
+		{GeoJSONFeature{}, geoJSONFeatureV2{}},
+		{PendingWeatherResponse{}, pendingWeatherResponseV2{}},
+		{WeatherHistoryResponse{}, weatherHistoryResponseV2{}},
+		{WeatherForecastResponse{}, weatherForecastResponseV2{}},
+		{WeatherForecastDay{}, weatherForecastDayV2{}},
+		{BatchItem{}, batchItemV2{}},
+		{BatchResponse{}, batchResponseV2{}},
+		{BatchJobResponse{}, batchJobResponseV2{}},
+	}
+	for _, pair := range pairs {
+		want := make(map[string]bool)
+		for name := range jsonFieldNames(reflect.TypeOf(pair.legacy)) {
+			want[strings.ToLower(name)] = true
+		}
+		if got := jsonFieldNames(reflect.TypeOf(pair.v2)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%T sends %v, want %v", pair.v2, got, want)
+		}
+	}
+}
+
+func TestEncodeResponseSchemaVersion(t *testing.T) {
+	setupTestService(t)
+	weather := &WeatherResponse{
+		City:    "São Paulo",
+		TempC:   22.5,
+		Sources: []WeatherSource{{Provider: "weatherapi", TempC: 22.5}},
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{"default", "/weather", "", http.StatusOK, []string{`"temp_c":22.5`, `"sources":[{"provider":"weatherapi","temp_c":22.5}]`}, []string{"temp_C"}},
+		{"header", "/weather", "v1", http.StatusOK, []string{`"temp_C":22.5`}, []string{"temp_c"}},
+		{"query over header", "/weather?version=2", "1", http.StatusOK, []string{`"temp_c":22.5`}, []string{"temp_C"}},
+		{"xml", "/weather?format=xml", "", http.StatusOK, []string{"<temp_c>22.5</temp_c>"}, []string{"temp_C"}},
+		{"fields by either name", "/weather?fields=temp_C,feelslike_c", "", http.StatusOK, []string{`"temp_c":22.5`, `"feelslike_c":0`}, []string{"city"}},
+		{"unknown", "/weather", "3", http.StatusNotAcceptable, []string{"unsupported_schema_version"}, nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.header != "" {
+			req.Header.Set("Accept-Version", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		encodeResponse(rec, req, http.StatusOK, weather)
+
+		body := rec.Body.String()
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.status, body)
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(body, s) {
+				t.Errorf("%s: body %s does not contain %s", tt.name, body, s)
+			}
+		}
+		for _, s := range tt.excludes {
+			if strings.Contains(body, s) {
+				t.Errorf("%s: body %s contains %s", tt.name, body, s)
+			}
+		}
+	}
+}
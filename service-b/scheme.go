@@ -0,0 +1,30 @@
+package serviceb
+
+import (
+	"net/http"
+	"strings"
+)
+
+// requestScheme returns the scheme the client used to reach us. Behind a
+// TLS-terminating proxy that is only known from X-Forwarded-Proto, which is
+// honoured when TRUST_PROXY=true; otherwise the connection's TLS state decides.
+func requestScheme(r *http.Request) string {
+	if cfg.TrustProxy {
+		// A chain of proxies appends to the header; the first hop is the client's.
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		switch proto := strings.ToLower(strings.TrimSpace(proto)); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// absoluteURL builds the external URL of path on the host the request was sent
+// to, for links in responses.
+func absoluteURL(r *http.Request, path string) string {
+	return requestScheme(r) + "://" + r.Host + path
+}
@@ -0,0 +1,42 @@
+package serviceb
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAbsoluteURL(t *testing.T) {
+	setupTestService(t)
+
+	tests := []struct {
+		name       string
+		trustProxy bool
+		proto      string
+		tls        bool
+		want       string
+	}{
+		{"plain", false, "", false, "http://example.com/weather/batch/1"},
+		{"tls", false, "", true, "https://example.com/weather/batch/1"},
+		{"untrusted proxy", false, "https", false, "http://example.com/weather/batch/1"},
+		{"trusted proxy", true, "https", false, "https://example.com/weather/batch/1"},
+		{"proxy chain", true, "HTTPS, http", false, "https://example.com/weather/batch/1"},
+		{"bogus proto", true, "ftp", true, "https://example.com/weather/batch/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.TrustProxy = tt.trustProxy
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/weather/batch", nil)
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if got := absoluteURL(req, "/weather/batch/1"); got != tt.want {
+				t.Errorf("absoluteURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxCEPSearchResults bounds the CEPs a single /location/search request returns.
+const maxCEPSearchResults = 20
+
+// viaCEPSearchURL is ViaCEP's address search endpoint, by UF, city and street.
+const viaCEPSearchURL = "https://viacep.com.br/ws/%s/%s/%s/json/"
+
+type CEPSearchRequest struct {
+	UF     string `json:"uf"`
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+// CEPSearchResult is one CEP matching the searched address.
+type CEPSearchResult struct {
+	CEP          string `json:"cep"`
+	Street       string `json:"street"`
+	Complement   string `json:"complement,omitempty"`
+	Neighborhood string `json:"neighborhood,omitempty"`
+	City         string `json:"city"`
+	UF           string `json:"uf"`
+}
+
+type CEPSearchResponse struct {
+	Results []CEPSearchResult `json:"results"`
+
+	// Set when ViaCEP matched more than maxCEPSearchResults CEPs
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type viaCEPSearchItem struct {
+	CEP         string `json:"cep"`
+	Logradouro  string `json:"logradouro"`
+	Complemento string `json:"complemento"`
+	Bairro      string `json:"bairro"`
+	Localidade  string `json:"localidade"`
+	UF          string `json:"uf"`
+}
+
+// handleLocationSearch looks up the CEPs of an address, the reverse of
+// /location, with ViaCEP's address search. ViaCEP requires a UF and at least
+// 3 characters of both the city and the street.
+func handleLocationSearch(w http.ResponseWriter, r *http.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName("handle-location-search-request")
+
+	var req CEPSearchRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		span.RecordError(err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	req.UF = strings.ToUpper(strings.TrimSpace(req.UF))
+	req.City, req.Street = strings.TrimSpace(req.City), strings.TrimSpace(req.Street)
+	if !validUF(req.UF) || len([]rune(req.City)) < 3 || len([]rune(req.Street)) < 3 {
+		writeErrorResponse(w, r, "invalid address", http.StatusUnprocessableEntity)
+		return
+	}
+
+	response, err := searchCEPs(r.Context(), req)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Error searching ViaCEP: %v", err)
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+			writeErrorResponse(w, r, "viacep timed out", http.StatusGatewayTimeout)
+			return
+		}
+		writeErrorResponse(w, r, "viacep unavailable", http.StatusBadGateway)
+		return
+	}
+	encodeResponse(w, r, http.StatusOK, response)
+}
+
+// validUF reports whether uf looks like a state abbreviation: two letters.
+func validUF(uf string) bool {
+	if len(uf) != 2 {
+		return false
+	}
+	for _, r := range uf {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// searchCEPs queries ViaCEP's address search in a child span and returns up to
+// maxCEPSearchResults of the CEPs it matched.
+func searchCEPs(ctx context.Context, req CEPSearchRequest) (*CEPSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "search-viacep", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("address.uf", req.UF),
+		attribute.String("address.city", req.City),
+	)
+
+	apiURL := fmt.Sprintf(viaCEPSearchURL, url.PathEscape(req.UF), url.PathEscape(req.City), url.PathEscape(req.Street))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := upstreamClient.Do(httpReq)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request to ViaCEP: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ViaCEP search returned status %d", resp.StatusCode)
+	}
+
+	var items []viaCEPSearchItem
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to decode ViaCEP search response: %w", err)
+	}
+
+	response := &CEPSearchResponse{Results: make([]CEPSearchResult, 0, min(len(items), maxCEPSearchResults))}
+	for _, item := range items {
+		if len(response.Results) == maxCEPSearchResults {
+			response.Truncated = true
+			break
+		}
+		cep, ok := normalizeCEP(item.CEP)
+		if !ok {
+			continue
+		}
+		response.Results = append(response.Results, CEPSearchResult{
+			CEP:          formatResponseCEP(cep),
+			Street:       item.Logradouro,
+			Complement:   item.Complemento,
+			Neighborhood: item.Bairro,
+			City:         item.Localidade,
+			UF:           item.UF,
+		})
+	}
+	span.SetAttributes(
+		attribute.Int("search.matches", len(items)),
+		attribute.Int("search.results", len(response.Results)),
+		attribute.Bool("search.truncated", response.Truncated),
+	)
+	return response, nil
+}
@@ -0,0 +1,104 @@
+package serviceb
+
+import (
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+const (
+	// shedSamples is how many of the latest request latencies the p99
+	// estimate is taken over.
+	shedSamples = 256
+
+	// minShedSamples is how many latencies must be recorded before shedding
+	// can start, so a slow first request does not turn traffic away.
+	minShedSamples = 50
+
+	// shedMaxFraction caps the share of requests rejected, so enough still go
+	// through to notice when the latency recovers.
+	shedMaxFraction = 0.9
+
+	// shedRecomputeInterval bounds how often the p99 is recomputed.
+	shedRecomputeInterval = time.Second
+)
+
+// loadShedder keeps a rolling estimate of the p99 latency of the latest
+// requests and, while it is above SHED_LATENCY_TARGET_MS, the share of new
+// requests to reject: 0 at the target, growing with how far it is exceeded.
+type loadShedder struct {
+	mu         sync.Mutex
+	latencies  [shedSamples]time.Duration
+	count      int
+	next       int
+	p99        time.Duration
+	computedAt time.Time
+}
+
+var shedder = &loadShedder{}
+
+func (s *loadShedder) observe(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies[s.next] = latency
+	s.next = (s.next + 1) % shedSamples
+	s.count = min(s.count+1, shedSamples)
+}
+
+// fraction returns the share of requests to shed and the current p99.
+func (s *loadShedder) fraction(now time.Time) (float64, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count < minShedSamples {
+		return 0, 0
+	}
+	if now.Sub(s.computedAt) >= shedRecomputeInterval {
+		sorted := slices.Clone(s.latencies[:s.count])
+		slices.Sort(sorted)
+		s.p99 = sorted[len(sorted)*99/100]
+		s.computedAt = now
+	}
+
+	target := cfg.ShedLatencyTarget
+	if s.p99 <= target {
+		return 0, s.p99
+	}
+	return min(shedMaxFraction, float64(s.p99-target)/float64(target)), s.p99
+}
+
+// shedLoad rejects a share of requests with 503 while the recent p99 latency
+// is above SHED_LATENCY_TARGET_MS, so an overloaded pod sheds work instead of
+// queueing it. Health and readiness probes are never shed.
+func shedLoad(next http.Handler) http.Handler {
+	if cfg.ShedLatencyTarget <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/health") || r.URL.Path == "/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fraction, p99 := shedder.fraction(shared.Now()); fraction > 0 && rand.Float64() < fraction {
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.Bool("load_shed", true),
+				attribute.Int64("load_shed.p99_ms", p99.Milliseconds()),
+				attribute.Float64("load_shed.fraction", fraction),
+			)
+			shared.SetRetryAfter(w, r, time.Second, cfg.RetryAfterJitter)
+			writeErrorResponse(w, r, "service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		start := shared.Now()
+		next.ServeHTTP(w, r)
+		shedder.observe(shared.Since(start))
+	})
+}
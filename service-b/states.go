@@ -0,0 +1,70 @@
+package serviceb
+
+import "strings"
+
+// brazilianStates maps each UF to the state name WeatherAPI reports as the
+// location region.
+var brazilianStates = map[string]string{
+	"AC": "Acre",
+	"AL": "Alagoas",
+	"AP": "Amapá",
+	"AM": "Amazonas",
+	"BA": "Bahia",
+	"CE": "Ceará",
+	"DF": "Distrito Federal",
+	"ES": "Espírito Santo",
+	"GO": "Goiás",
+	"MA": "Maranhão",
+	"MT": "Mato Grosso",
+	"MS": "Mato Grosso do Sul",
+	"MG": "Minas Gerais",
+	"PA": "Pará",
+	"PB": "Paraíba",
+	"PR": "Paraná",
+	"PE": "Pernambuco",
+	"PI": "Piauí",
+	"RJ": "Rio de Janeiro",
+	"RN": "Rio Grande do Norte",
+	"RS": "Rio Grande do Sul",
+	"RO": "Rondônia",
+	"RR": "Roraima",
+	"SC": "Santa Catarina",
+	"SP": "São Paulo",
+	"SE": "Sergipe",
+	"TO": "Tocantins",
+}
+
+// brazilianRegions maps each UF to its macro-region, as ViaCEP reports it.
+var brazilianRegions = map[string]string{
+	"AC": "Norte", "AP": "Norte", "AM": "Norte", "PA": "Norte", "RO": "Norte", "RR": "Norte", "TO": "Norte",
+	"AL": "Nordeste", "BA": "Nordeste", "CE": "Nordeste", "MA": "Nordeste", "PB": "Nordeste",
+	"PE": "Nordeste", "PI": "Nordeste", "RN": "Nordeste", "SE": "Nordeste",
+	"DF": "Centro-Oeste", "GO": "Centro-Oeste", "MT": "Centro-Oeste", "MS": "Centro-Oeste",
+	"ES": "Sudeste", "MG": "Sudeste", "RJ": "Sudeste", "SP": "Sudeste",
+	"PR": "Sul", "RS": "Sul", "SC": "Sul",
+}
+
+var accentFolder = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ü", "u",
+	"ç", "c",
+)
+
+// foldName lowercases name and strips Portuguese accents, since WeatherAPI does
+// not consistently accent region names ("Sao Paulo" vs "São Paulo").
+func foldName(name string) string {
+	return accentFolder.Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// regionMatchesUF reports whether a WeatherAPI region is the state of uf. Unknown
+// UFs always match so that we never second-guess data we cannot check.
+func regionMatchesUF(region, uf string) bool {
+	stateName, ok := brazilianStates[strings.ToUpper(uf)]
+	if !ok {
+		return true
+	}
+	return foldName(region) == foldName(stateName)
+}
@@ -0,0 +1,24 @@
+package serviceb
+
+import (
+	"net/http"
+
+	"shared"
+)
+
+type StatsResponse struct {
+	shared.RequestStatsSnapshot
+	BurnRates map[string]shared.BurnRate `json:"burn_rates"`
+	Distinct  DistinctStats              `json:"distinct"`
+}
+
+// stats holds the in-memory counters served by /stats.
+var stats = shared.NewRequestStats()
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	encodeResponse(w, r, http.StatusOK, StatsResponse{
+		RequestStatsSnapshot: stats.Snapshot(),
+		BurnRates:            errorBudget.BurnRates(shared.Now()),
+		Distinct:             distinct.snapshot(),
+	})
+}
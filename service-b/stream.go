@@ -0,0 +1,204 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// minStreamInterval is the shortest STREAM_INTERVAL accepted, so a stream
+// cannot turn into a tight loop against the cache and the providers.
+const minStreamInterval = time.Second
+
+// streamWriteTimeout bounds each push to a stream, in place of WRITE_TIMEOUT,
+// so a client that stops reading does not pin the stream's goroutine forever.
+const streamWriteTimeout = 10 * time.Second
+
+var (
+	// streamsStopped is closed on shutdown so open streams end instead of
+	// holding the drain until DRAIN_TIMEOUT.
+	streamsStopped = make(chan struct{})
+	stopOnce       sync.Once
+)
+
+// activeStreams counts the weather streams open, bounded by MAX_SSE_STREAMS.
+var activeStreams atomic.Int64
+
+// admitStream counts a new stream in activeStreams unless MAX_SSE_STREAMS are
+// already open, so the gauge never includes the streams turned away. It
+// returns the streams open, counting the new one if admitted.
+func admitStream() (int64, bool) {
+	for {
+		active := activeStreams.Load()
+		if cfg.MaxSSEStreams > 0 && active >= int64(cfg.MaxSSEStreams) {
+			return active, false
+		}
+		if activeStreams.CompareAndSwap(active, active+1) {
+			return active + 1, true
+		}
+	}
+}
+
+// stopStreams ends every open weather stream; it is registered to run when
+// the server starts shutting down.
+func stopStreams() {
+	stopOnce.Do(func() { close(streamsStopped) })
+}
+
+// handleWeatherStream pushes the weather of a CEP as Server-Sent Events every
+// STREAM_INTERVAL until the client disconnects. Each push goes through the
+// weather cache like a regular request and runs in a child span of the
+// stream's span; a failed push is sent as an "error" event and the stream
+// carries on.
+func handleWeatherStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetName("handle-weather-stream-request")
+
+	cep, ok := normalizeCEP(r.PathValue("cep"))
+	if !ok {
+		writeErrorResponse(w, r, "invalid zipcode", http.StatusUnprocessableEntity)
+		return
+	}
+
+	provider, ok := selectWeatherProvider(r)
+	if !ok {
+		writeErrorResponse(w, r, "invalid weather provider", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := negotiateSchemaVersion(r)
+	if !ok {
+		writeErrorResponse(w, r, "unsupported schema version", http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Version")
+	span.SetAttributes(attribute.String("response.schema_version", version))
+
+	// Each stream holds a goroutine and keeps polling the providers, so past
+	// MAX_SSE_STREAMS new ones are turned away
+	active, admitted := admitStream()
+	span.SetAttributes(attribute.Int64("stream.active", active))
+	if !admitted {
+		span.AddEvent("stream.limit_reached")
+		writeErrorResponse(w, r, "too many streams", http.StatusServiceUnavailable)
+		return
+	}
+	defer activeStreams.Add(-1)
+
+	location, err := resolveLocation(ctx, cep)
+	if err != nil {
+		span.RecordError(err)
+		writeLocationError(w, r, err)
+		return
+	}
+	distinct.observeLocation(location)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep proxies such as nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+
+	span.SetAttributes(attribute.String("stream.interval", cfg.StreamInterval.String()))
+	ticker := time.NewTicker(cfg.StreamInterval)
+	defer ticker.Stop()
+
+	pushes := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("stream.pushes", pushes))
+	}()
+	for {
+		// A writer without deadlines, e.g. in tests, only loses the bound
+		if err := controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			span.RecordError(err)
+			return
+		}
+		if err := pushWeather(ctx, w, provider, location, version); err != nil {
+			span.RecordError(err)
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			span.RecordError(err)
+			return
+		}
+		pushes++
+
+		select {
+		case <-ctx.Done():
+			span.AddEvent("stream.client_disconnected")
+			return
+		case <-streamsStopped:
+			span.AddEvent("stream.shutdown")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushWeather writes one event with the current weather of location, laid out
+// as version, or an "error" event when the lookup fails. It only returns the
+// errors writing to the client, which end the stream.
+func pushWeather(ctx context.Context, w http.ResponseWriter, provider WeatherProvider, location *Location, version string) error {
+	ctx, span := tracer.Start(ctx, "stream-push")
+	defer span.End()
+
+	event, payload := "", any(nil)
+	weather, err := lookupWeather(ctx, provider, location)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		span.RecordError(err)
+		log.Printf("Error getting weather for stream: %v", err)
+		message, statusCode := streamErrorMessage(err)
+		event, payload = "error", ErrorResponse{Code: errorCode(message, statusCode), Message: message}
+	default:
+		if cfg.ExposeMockFlag {
+			weather.Mock = &weather.IsMock
+		}
+		includeExtraUnits(weather)
+		payload = versionedPayload(weather, version)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode stream event: %w", err)
+	}
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// streamErrorMessage maps a weather lookup error to the message and status a
+// /weather request would have answered with.
+func streamErrorMessage(err error) (string, int) {
+	switch {
+	case errors.Is(err, ErrInvalidLocation):
+		return "invalid location", http.StatusUnprocessableEntity
+	case errors.Is(err, ErrImplausibleWeather):
+		return "implausible weather data from upstream", http.StatusBadGateway
+	case errors.Is(err, ErrMissingTemperature):
+		return "incomplete weather data from upstream", http.StatusBadGateway
+	case errors.Is(err, ErrRegionMismatch):
+		return "weather region mismatch from upstream", http.StatusBadGateway
+	case errors.Is(err, ErrUpstreamTLS):
+		return "upstream tls error", http.StatusBadGateway
+	default:
+		return "internal server error", http.StatusInternalServerError
+	}
+}
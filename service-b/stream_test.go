@@ -0,0 +1,74 @@
+package serviceb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shared"
+)
+
+// TestWeatherStreamGzip checks that a stream sent through CompressResponses
+// delivers its first event compressed, without waiting for the stream to end.
+func TestWeatherStreamGzip(t *testing.T) {
+	setupTestService(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /weather/stream/{cep}", handleWeatherStream)
+	server := httptest.NewServer(shared.CompressResponses(cfg.GzipLevel, mux))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/weather/stream/01001000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set by hand so the transport hands the body over still compressed
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	line, err := bufio.NewReader(gz).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the first event: %v", err)
+	}
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, "São Paulo") {
+		t.Errorf("first event line = %q, want the weather of São Paulo", line)
+	}
+}
+
+// TestWeatherStreamLimit checks that a stream turned away past MAX_SSE_STREAMS
+// is not counted in the active streams gauge.
+func TestWeatherStreamLimit(t *testing.T) {
+	setupTestService(t)
+	cfg.MaxSSEStreams = 1
+	activeStreams.Store(1)
+	defer activeStreams.Store(0)
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/stream/01001000", nil)
+	req.SetPathValue("cep", "01001000")
+	rec := httptest.NewRecorder()
+	handleWeatherStream(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if got := activeStreams.Load(); got != 1 {
+		t.Errorf("active streams = %d, want 1", got)
+	}
+}
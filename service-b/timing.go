@@ -0,0 +1,82 @@
+package serviceb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type timingEntry struct {
+	name     string
+	duration time.Duration
+}
+
+// requestTimings collects the duration of each upstream stage of a request so
+// they can be reported back to the client.
+type requestTimings struct {
+	entries []timingEntry
+}
+
+func (t *requestTimings) record(name string, start time.Time) {
+	t.entries = append(t.entries, timingEntry{name: name, duration: time.Since(start)})
+}
+
+// serverTiming formats the collected timings as a Server-Timing header value,
+// e.g. "viacep;dur=45.2, weatherapi;dur=120.0".
+func (t *requestTimings) serverTiming() string {
+	metrics := make([]string, 0, len(t.entries))
+	for _, entry := range t.entries {
+		metrics = append(metrics, formatServerTiming(entry.name, entry.duration))
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// ResponseTimings is the processing breakdown added to the response body with
+// ?timings=true, for clients that cannot read Server-Timing.
+type ResponseTimings struct {
+	CEPResolutionMs float64 `json:"cep_resolution_ms" xml:"cep_resolution_ms"`
+	WeatherLookupMs float64 `json:"weather_lookup_ms" xml:"weather_lookup_ms"`
+	TotalMs         float64 `json:"total_ms" xml:"total_ms"`
+}
+
+// breakdown reports the recorded stages along with the total time since start.
+func (t *requestTimings) breakdown(start time.Time) *ResponseTimings {
+	timings := &ResponseTimings{TotalMs: milliseconds(time.Since(start))}
+	for _, entry := range t.entries {
+		switch entry.name {
+		case "viacep":
+			timings.CEPResolutionMs = milliseconds(entry.duration)
+		case "weatherapi":
+			timings.WeatherLookupMs = milliseconds(entry.duration)
+		}
+	}
+	return timings
+}
+
+// TopologyHop is one service involved in a request, added to the response
+// body with ?topology=true so clients can draw the call graph without a
+// tracing backend. Parent is the service that called it, empty for the first
+// hop.
+type TopologyHop struct {
+	Service    string  `json:"service" xml:"service"`
+	Parent     string  `json:"parent,omitempty" xml:"parent,omitempty"`
+	DurationMs float64 `json:"duration_ms" xml:"duration_ms"`
+}
+
+// topology reports this service, with the total time since start, followed
+// by the upstreams it called.
+func (t *requestTimings) topology(start time.Time) []TopologyHop {
+	hops := []TopologyHop{{Service: "service-b", DurationMs: milliseconds(time.Since(start))}}
+	for _, entry := range t.entries {
+		hops = append(hops, TopologyHop{Service: entry.name, Parent: "service-b", DurationMs: milliseconds(entry.duration)})
+	}
+	return hops
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatServerTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, milliseconds(d))
+}
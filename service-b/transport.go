@@ -0,0 +1,238 @@
+package serviceb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// outboundTransport is shared by every client calling the upstream providers.
+var outboundTransport http.RoundTripper
+
+// ErrUpstreamTooLarge is returned when an upstream body exceeds MAX_UPSTREAM_BYTES.
+var ErrUpstreamTooLarge = errors.New("upstream response too large")
+
+// upstreamBody caps how much of an upstream response body is read, failing
+// with ErrUpstreamTooLarge past MAX_UPSTREAM_BYTES instead of silently
+// truncating it, so a misbehaving upstream cannot stream unbounded data.
+func upstreamBody(body io.Reader) io.Reader {
+	return &limitedBody{r: io.LimitReader(body, cfg.MaxUpstreamBytes+1), remaining: cfg.MaxUpstreamBytes}
+}
+
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return 0, ErrUpstreamTooLarge
+	}
+	return n, err
+}
+
+// upstreamTimeout bounds each call to an upstream provider.
+const upstreamTimeout = 10 * time.Second
+
+// upstreamClient is the client shared by the requests to the upstream
+// providers, created once outboundTransport is set.
+var upstreamClient *http.Client
+
+// skipIfCancelled returns the error of ctx when it is already done, such as
+// when the client went away, recording a skipped.context_cancelled event so
+// abandoned requests make no upstream call.
+func skipIfCancelled(ctx context.Context) error {
+	err := ctx.Err()
+	if err != nil {
+		trace.SpanFromContext(ctx).AddEvent("skipped.context_cancelled", trace.WithAttributes(attribute.String("error", err.Error())))
+	}
+	return err
+}
+
+// dnsRetryDelay is how long to wait before resolving a host a second time.
+const dnsRetryDelay = 200 * time.Millisecond
+
+// newBaseTransport returns the transport outbound calls are made over. Requests
+// go through OUTBOUND_HTTP_PROXY when set, otherwise through the proxy selected
+// by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. Hosts are
+// resolved through DNS_RESOLVER when set, and a failed resolution is retried once.
+func newBaseTransport(proxy *url.URL, dnsResolver string) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if dnsResolver != "" {
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, dnsResolver)
+			},
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = retryDNSDial(dialer.DialContext)
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport
+}
+
+// retryDNSDial retries a dial once, after dnsRetryDelay, when it fails to
+// resolve the host. The request was never sent, so this is safe for any method.
+func retryDNSDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		var dnsErr *net.DNSError
+		if err == nil || !errors.As(err, &dnsErr) {
+			return conn, err
+		}
+
+		countRetry(ctx)
+		trace.SpanFromContext(ctx).AddEvent("dns.retry", trace.WithAttributes(
+			attribute.String("dns.host", dnsErr.Name),
+			attribute.String("dns.error", dnsErr.Err),
+		))
+
+		timer := time.NewTimer(dnsRetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// newOutboundClient returns a client for calling the upstream providers over
+// the shared transport, following at most MAX_REDIRECTS redirects.
+func newOutboundClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport:     outboundTransport,
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect records every redirect followed as a span event and refuses to
+// follow more than MAX_REDIRECTS of them.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	span := trace.SpanFromContext(req.Context())
+	// Only host and path: the query may carry the API key
+	span.AddEvent("http.redirect", trace.WithAttributes(
+		attribute.Int("http.redirect.count", len(via)),
+		attribute.String("http.redirect.location", req.URL.Host+req.URL.Path),
+	))
+
+	if len(via) > cfg.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+	}
+	return nil
+}
+
+// retryRoundTripper retries idempotent requests that fail with a connection
+// error or a 5xx response, backing off exponentially from baseDelay and honoring
+// the upstream Retry-After header when present. Each retry is recorded as an
+// event on the span active in the request context.
+type retryRoundTripper struct {
+	next        http.RoundTripper
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+func newRetryRoundTripper(next http.RoundTripper, maxAttempts int, baseDelay time.Duration) *retryRoundTripper {
+	return &retryRoundTripper{
+		next:        next,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+	}
+}
+
+func (t *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.maxAttempts || ctx.Err() != nil || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		countRetry(ctx)
+		span.AddEvent("http.retry", trace.WithAttributes(
+			attribute.Int("http.retry.attempt", attempt),
+			attribute.String("http.retry.reason", reason),
+			attribute.Int64("http.retry.delay_ms", delay.Milliseconds()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *retryRoundTripper) backoff(attempt int) time.Duration {
+	return t.baseDelay * time.Duration(1<<(attempt-1))
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// A bad certificate is not going to heal between attempts
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrUpstreamTLS)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
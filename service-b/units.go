@@ -0,0 +1,31 @@
+package serviceb
+
+// Extra temperature units TEMP_EXTRA_UNITS can add to weather responses, on
+// top of the Celsius, Fahrenheit and Kelvin always served.
+const (
+	unitRankine = "rankine"
+	unitReaumur = "reaumur"
+)
+
+// includeExtraUnits fills in the TEMP_EXTRA_UNITS temperatures, converted
+// from the Celsius one.
+func includeExtraUnits(weather *WeatherResponse) {
+	for _, unit := range cfg.TempExtraUnits {
+		switch unit {
+		case unitRankine:
+			rankine := celsiusToRankine(weather.TempC)
+			weather.TempRankine = &rankine
+		case unitReaumur:
+			reaumur := celsiusToReaumur(weather.TempC)
+			weather.TempReaumur = &reaumur
+		}
+	}
+}
+
+func celsiusToRankine(celsius float64) float64 {
+	return (celsius + 273.15) * 1.8
+}
+
+func celsiusToReaumur(celsius float64) float64 {
+	return celsius * 0.8
+}
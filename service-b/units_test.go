@@ -0,0 +1,43 @@
+package serviceb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtraUnitsReferencePoints(t *testing.T) {
+	tests := []struct {
+		celsius float64
+		rankine float64
+		reaumur float64
+	}{
+		// Freezing point of water
+		{celsius: 0, rankine: 491.67, reaumur: 0},
+		// Boiling point of water
+		{celsius: 100, rankine: 671.67, reaumur: 80},
+		// Absolute zero
+		{celsius: -273.15, rankine: 0, reaumur: -218.52},
+	}
+	for _, tt := range tests {
+		if got := celsiusToRankine(tt.celsius); math.Abs(got-tt.rankine) > 1e-9 {
+			t.Errorf("celsiusToRankine(%v) = %v, want %v", tt.celsius, got, tt.rankine)
+		}
+		if got := celsiusToReaumur(tt.celsius); math.Abs(got-tt.reaumur) > 1e-9 {
+			t.Errorf("celsiusToReaumur(%v) = %v, want %v", tt.celsius, got, tt.reaumur)
+		}
+	}
+}
+
+func TestIncludeExtraUnits(t *testing.T) {
+	setupTestService(t)
+	cfg.TempExtraUnits = []string{unitRankine, unitReaumur}
+
+	weather := &WeatherResponse{TempC: 100}
+	includeExtraUnits(weather)
+	if weather.TempRankine == nil || math.Abs(*weather.TempRankine-671.67) > 1e-9 {
+		t.Errorf("TempRankine = %v, want 671.67", weather.TempRankine)
+	}
+	if weather.TempReaumur == nil || *weather.TempReaumur != 80 {
+		t.Errorf("TempReaumur = %v, want 80", weather.TempReaumur)
+	}
+}
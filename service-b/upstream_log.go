@@ -0,0 +1,128 @@
+package serviceb
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recentUpstreamSize is how many upstream interactions /debug/upstream/recent keeps.
+const recentUpstreamSize = 100
+
+// upstreamProviders names the upstreams by host, for the recent interactions.
+var upstreamProviders = map[string]string{
+	"viacep.com.br":          "viacep",
+	"brasilapi.com.br":       "brasilapi",
+	"api.weatherapi.com":     "weatherapi",
+	"api.openweathermap.org": "openweathermap",
+}
+
+// secretQueryParams are the query parameters that carry API keys.
+var secretQueryParams = []string{"key", "appid"}
+
+// UpstreamInteraction is one request to an upstream provider, as attempted by
+// the transport: retries are separate interactions.
+type UpstreamInteraction struct {
+	Time       time.Time `json:"time"`
+	Provider   string    `json:"provider"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+// upstreamRing holds the latest upstream interactions, overwriting the oldest.
+type upstreamRing struct {
+	mu      sync.Mutex
+	entries [recentUpstreamSize]UpstreamInteraction
+	next    int
+	count   int
+}
+
+var recentUpstream = &upstreamRing{}
+
+func (r *upstreamRing) add(interaction UpstreamInteraction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = interaction
+	r.next = (r.next + 1) % recentUpstreamSize
+	r.count = min(r.count+1, recentUpstreamSize)
+}
+
+// recent returns the interactions held, newest first.
+func (r *upstreamRing) recent() []UpstreamInteraction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interactions := make([]UpstreamInteraction, 0, r.count)
+	for i := 1; i <= r.count; i++ {
+		interactions = append(interactions, r.entries[(r.next-i+recentUpstreamSize)%recentUpstreamSize])
+	}
+	return interactions
+}
+
+// upstreamRecordingRoundTripper keeps every upstream request in recentUpstream,
+// with API keys and CEPs masked in its URL.
+type upstreamRecordingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t upstreamRecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	provider, ok := upstreamProviders[req.URL.Hostname()]
+	if !ok {
+		provider = req.URL.Hostname()
+	}
+	interaction := UpstreamInteraction{
+		Time:       start,
+		Provider:   provider,
+		Method:     req.Method,
+		URL:        redactUpstreamURL(req.URL),
+		DurationMs: milliseconds(time.Since(start)),
+	}
+	if spanContext := trace.SpanContextFromContext(req.Context()); spanContext.HasTraceID() {
+		interaction.TraceID = spanContext.TraceID().String()
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+	} else {
+		interaction.Status = resp.StatusCode
+	}
+	recentUpstream.add(interaction)
+	return resp, err
+}
+
+// redactUpstreamURL returns u with its API key parameters and CEPs masked.
+func redactUpstreamURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, name := range secretQueryParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return cepInURL.ReplaceAllStringFunc(redacted.String(), maskCEP)
+}
+
+// handleRecentUpstream lists the latest upstream interactions, newest first,
+// for a quick look at what just happened upstream during an incident.
+func handleRecentUpstream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(recentUpstream.recent()); err != nil {
+		log.Printf("Failed to encode recent upstream response: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package serviceb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUpstreamTLS is returned when the TLS handshake with an upstream fails,
+// e.g. on an expired or untrusted certificate, wrapping the underlying error.
+var ErrUpstreamTLS = errors.New("upstream TLS error")
+
+// tlsErrorRoundTripper classifies the TLS and certificate errors of each
+// attempt as ErrUpstreamTLS, recording their reason as an event on the span
+// active in the request context.
+type tlsErrorRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t tlsErrorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		return resp, nil
+	}
+	reason, ok := tlsErrorReason(err)
+	if !ok {
+		return resp, err
+	}
+	trace.SpanFromContext(req.Context()).AddEvent("upstream.tls_error", trace.WithAttributes(
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("upstream.tls_error.reason", reason),
+	))
+	return resp, fmt.Errorf("%w: %w", ErrUpstreamTLS, err)
+}
+
+// tlsErrorReason reports whether err comes from crypto/tls or crypto/x509,
+// and the message of the error that does.
+func tlsErrorReason(err error) (string, bool) {
+	var (
+		verification *tls.CertificateVerificationError
+		alert        tls.AlertError
+		header       tls.RecordHeaderError
+		invalid      x509.CertificateInvalidError
+		hostname     x509.HostnameError
+		authority    x509.UnknownAuthorityError
+	)
+	switch {
+	case errors.As(err, &verification):
+		return verification.Err.Error(), true
+	case errors.As(err, &alert):
+		return alert.Error(), true
+	case errors.As(err, &header):
+		return header.Error(), true
+	case errors.As(err, &invalid):
+		return invalid.Error(), true
+	case errors.As(err, &hostname):
+		return hostname.Error(), true
+	case errors.As(err, &authority):
+		return authority.Error(), true
+	}
+	// Most handshake failures are unexported errors prefixed with the package name
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if message := e.Error(); strings.HasPrefix(message, "tls: ") || strings.HasPrefix(message, "x509: ") {
+			return message, true
+		}
+	}
+	return "", false
+}
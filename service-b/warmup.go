@@ -0,0 +1,52 @@
+package serviceb
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// warmUpCaches resolves the configured WARMUP_CEPS (and, with WARMUP_WEATHER,
+// their weather) to populate the caches before traffic arrives. It is meant to
+// run in the background: failures are logged and never block startup.
+func warmUpCaches(ctx context.Context, ceps []string) {
+	ctx, span := tracer.Start(ctx, "cache-warmup")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("warmup.ceps", len(ceps)),
+		attribute.Bool("warmup.weather", cfg.WarmupWeather),
+	)
+
+	failures := 0
+	for _, raw := range ceps {
+		cep, ok := normalizeCEP(raw)
+		if !ok {
+			log.Printf("Skipping invalid warm-up CEP %q", raw)
+			failures++
+			continue
+		}
+
+		location, err := resolveLocation(ctx, cep)
+		if err != nil {
+			log.Printf("Failed to warm up location for CEP %s: %v", cep, err)
+			failures++
+			continue
+		}
+
+		if cfg.WarmupWeather {
+			if _, err := getWeather(ctx, weatherProviders[defaultWeatherProvider], location); err != nil {
+				log.Printf("Failed to warm up weather for %s: %v", location.City, err)
+				failures++
+			}
+		}
+	}
+
+	span.SetAttributes(attribute.Int("warmup.failures", failures))
+	if failures > 0 {
+		span.SetStatus(codes.Error, "some warm-up lookups failed")
+	}
+	log.Printf("Cache warm-up finished: %d CEPs, %d failures", len(ceps), failures)
+}
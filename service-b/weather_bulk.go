@@ -0,0 +1,169 @@
+package serviceb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// weatherAPIBulkMax bounds the locations sent in one WeatherAPI bulk request.
+const weatherAPIBulkMax = 50
+
+type weatherAPIBulkRequest struct {
+	Locations []weatherAPIBulkLocation `json:"locations"`
+}
+
+type weatherAPIBulkLocation struct {
+	Q        string `json:"q"`
+	CustomID string `json:"custom_id"`
+}
+
+type weatherAPIBulkResponse struct {
+	Bulk []struct {
+		Query struct {
+			CustomID string `json:"custom_id"`
+			WeatherAPIResponse
+		} `json:"query"`
+	} `json:"bulk"`
+}
+
+// prefetchBulkWeather fills the weather cache for the distinct, not yet cached
+// locations of a batch with WeatherAPI bulk requests when WEATHER_BULK=true,
+// so the per-item lookups that follow are cache hits. Locations the bulk
+// request could not answer, or answered for the wrong state, are left to the
+// individual calls, as is everything when the bulk request fails. Invalid
+// locations are left out of the bulk request too, for the individual calls to
+// reject.
+func prefetchBulkWeather(ctx context.Context, provider WeatherProvider, locations []*Location) {
+	if !cfg.WeatherBulk || cfg.AggregateWeather || provider.Name() != "weatherapi" {
+		return
+	}
+	apiKey := currentWeatherAPIKey()
+	if apiKey == "" || apiKey == "your_weather_api_key_here" {
+		return
+	}
+
+	pending := make(map[string]*Location)
+	for _, location := range locations {
+		if validateLocation(ctx, location) != nil {
+			continue
+		}
+		key := weatherCacheKey(provider, location)
+		if _, ok := weatherCache.Get(key); !ok {
+			pending[key] = location
+		}
+	}
+	// A single location gains nothing over the regular call
+	if len(pending) < 2 {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "get-weather-bulk", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(attribute.Int("weather.bulk.locations", len(pending)))
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	cached := 0
+	for start := 0; start < len(keys); start += weatherAPIBulkMax {
+		chunk := keys[start:min(start+weatherAPIBulkMax, len(keys))]
+		request := weatherAPIBulkRequest{Locations: make([]weatherAPIBulkLocation, 0, len(chunk))}
+		for i, key := range chunk {
+			request.Locations = append(request.Locations, weatherAPIBulkLocation{
+				Q:        pending[key].City,
+				CustomID: strconv.Itoa(i),
+			})
+		}
+
+		response, err := fetchBulkWeather(ctx, apiKey, request)
+		if err != nil {
+			span.RecordError(err)
+			span.AddEvent("weather.bulk_failed")
+			log.Printf("WeatherAPI bulk request failed, falling back to individual calls: %v", err)
+			break
+		}
+
+		for _, result := range response.Bulk {
+			i, err := strconv.Atoi(result.Query.CustomID)
+			if err != nil || i < 0 || i >= len(chunk) {
+				continue
+			}
+			location := pending[chunk[i]]
+			if !regionMatchesUF(result.Query.Location.Region, location.UF) {
+				continue
+			}
+			weather, err := weatherAPIResponseToWeather(ctx, &result.Query.WeatherAPIResponse)
+			if err != nil || checkTemperatureSanity(ctx, weather) != nil {
+				continue
+			}
+			calibrateTemperature(ctx, weather)
+			weatherCache.SetWithTTL(chunk[i], *weather, weatherCacheTTL(ctx, weather))
+			cached++
+		}
+	}
+	span.SetAttributes(attribute.Int("weather.bulk.cached", cached))
+}
+
+// fetchBulkWeather sends a bulk request like getWeather sends a single one:
+// within WEATHER_PROVIDER_TIMEOUT and hedged after WEATHER_HEDGE_DELAY_MS.
+func fetchBulkWeather(ctx context.Context, apiKey string, request weatherAPIBulkRequest) (*weatherAPIBulkResponse, error) {
+	if timeout := providerTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return hedge(ctx, func(ctx context.Context) (*weatherAPIBulkResponse, error) {
+		return queryWeatherAPIBulk(ctx, apiKey, request)
+	})
+}
+
+func queryWeatherAPIBulk(ctx context.Context, apiKey string, request weatherAPIBulkRequest) (*weatherAPIBulkResponse, error) {
+	if err := skipIfCancelled(ctx); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bulk request: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=bulk&aqi=no", apiKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	release, err := acquireWeatherAPISlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make bulk request to WeatherAPI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Bulk requests are not available on every plan
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("WeatherAPI bulk request returned status %d", resp.StatusCode)
+	}
+
+	var bulkResp weatherAPIBulkResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&bulkResp); err != nil {
+		return nil, fmt.Errorf("failed to decode WeatherAPI bulk response: %w", err)
+	}
+	return &bulkResp, nil
+}
@@ -0,0 +1,290 @@
+package serviceb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"shared"
+)
+
+// WeatherProvider looks up the current weather of a location.
+type WeatherProvider interface {
+	Name() string
+	Fetch(ctx context.Context, location *Location) (*WeatherResponse, error)
+}
+
+const defaultWeatherProvider = "weatherapi"
+
+// localTimeLayout is the format of WeatherResponse.LocalTime, as WeatherAPI sends it.
+const localTimeLayout = "2006-01-02 15:04"
+
+// weatherProviders are the providers a request can be routed to, by name.
+var weatherProviders = map[string]WeatherProvider{
+	"weatherapi":     weatherAPIProvider{},
+	"openweathermap": openWeatherMapProvider{},
+}
+
+// selectWeatherProvider picks the provider for a request: the one named in the
+// X-Weather-Provider header, else one drawn from WEATHER_PROVIDER_SPLIT, else
+// the default. It reports false when the header names an unknown provider.
+func selectWeatherProvider(r *http.Request) (WeatherProvider, bool) {
+	span := trace.SpanFromContext(r.Context())
+
+	name, source := defaultWeatherProvider, "default"
+	if header := r.Header.Get("X-Weather-Provider"); header != "" {
+		if _, ok := weatherProviders[header]; !ok {
+			return nil, false
+		}
+		name, source = header, "header"
+	} else if len(cfg.WeatherProviderSplit) > 0 {
+		name, source = pickWeatherProvider(cfg.WeatherProviderSplit, rand.Intn(100)), "split"
+	}
+
+	span.SetAttributes(
+		attribute.String("weather.provider", name),
+		attribute.String("weather.provider.source", source),
+	)
+	return weatherProviders[name], true
+}
+
+// pickWeatherProvider maps roll, in [0, 100), onto the percentages of split.
+func pickWeatherProvider(split map[string]int, roll int) string {
+	names := make([]string, 0, len(split))
+	for name := range split {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if roll < split[name] {
+			return name
+		}
+		roll -= split[name]
+	}
+	return defaultWeatherProvider
+}
+
+// mockWeather is served by providers whose API key is not configured. With
+// MOCK_WEATHER_SPAN it also records a weather.mock child span carrying the
+// values served, so traces show plainly that no provider was called. The
+// MOCK_TEMP_C served always goes on the request span and in a debug log as
+// mock.temp_c.
+func mockWeather(ctx context.Context, location *Location) *WeatherResponse {
+	weather := newMockWeather(location)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("mock_data", true),
+		attribute.Float64("mock.temp_c", weather.TempC),
+	)
+	slog.DebugContext(ctx, "serving mock weather", "city", weather.City, "mock.temp_c", weather.TempC)
+	if cfg.MockWeatherSpan {
+		_, span := tracer.Start(ctx, "weather.mock", trace.WithAttributes(
+			attribute.String("weather.city", weather.City),
+			attribute.Float64("weather.temp_c", weather.TempC),
+			attribute.Float64("weather.feelslike_c", weather.FeelsLikeC),
+			attribute.Int("weather.humidity", *weather.ReportedHumidity),
+			attribute.Float64("weather.uv", *weather.ReportedUV),
+		))
+		span.End()
+	}
+	return weather
+}
+
+// newMockWeather returns the fixed reading mockWeather serves, at MOCK_TEMP_C.
+func newMockWeather(location *Location) *WeatherResponse {
+	tempC, humidity, uv := cfg.MockTempC, 65, 5.0
+	weather := &WeatherResponse{
+		City:             location.City,
+		TempC:            tempC,
+		TempF:            celsiusToFahrenheit(tempC),
+		TempK:            celsiusToKelvin(tempC),
+		LocalTime:        shared.Now().Format(localTimeLayout),
+		ReportedHumidity: &humidity,
+		ReportedUV:       &uv,
+		IsMock:           true,
+	}
+	weather.setFeelsLike(tempC)
+	return weather
+}
+
+type weatherAPIProvider struct{}
+
+func (weatherAPIProvider) Name() string { return "weatherapi" }
+
+func (weatherAPIProvider) Fetch(ctx context.Context, location *Location) (*WeatherResponse, error) {
+	span := trace.SpanFromContext(ctx)
+
+	weatherAPIKey := currentWeatherAPIKey()
+	if weatherAPIKey == "" || weatherAPIKey == "your_weather_api_key_here" {
+		// Return mock data for testing when API key is not configured
+		return mockWeather(ctx, location), nil
+	}
+
+	weatherResp, err := queryWeatherAPI(ctx, upstreamClient, weatherAPIKey, location.City)
+	if err != nil {
+		return nil, err
+	}
+
+	// City names shared by several states may resolve to the wrong one, so
+	// retry with the state spelled out when the region does not match the UF
+	if !regionMatchesUF(weatherResp.Location.Region, location.UF) {
+		span.AddEvent("weather.disambiguated", trace.WithAttributes(
+			attribute.String("weather.region", weatherResp.Location.Region),
+			attribute.String("cep.uf", location.UF),
+		))
+		query := fmt.Sprintf("%s, %s, Brazil", location.City, brazilianStates[location.UF])
+		weatherResp, err = queryWeatherAPI(ctx, upstreamClient, weatherAPIKey, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Flag what is still in the wrong state for data-quality monitoring, or
+	// refuse it with STRICT_REGION_MATCH
+	mismatch := !regionMatchesUF(weatherResp.Location.Region, location.UF)
+	span.SetAttributes(attribute.Bool("weather.region_mismatch", mismatch))
+	if mismatch && cfg.StrictRegionMatch {
+		return nil, ErrRegionMismatch
+	}
+
+	return weatherAPIResponseToWeather(ctx, weatherResp)
+}
+
+// weatherAPIResponseToWeather converts a WeatherAPI current conditions reading,
+// failing with ErrMissingTemperature when it has no temperature.
+func weatherAPIResponseToWeather(ctx context.Context, weatherResp *WeatherAPIResponse) (*WeatherResponse, error) {
+	if weatherResp.Current.TempC == nil {
+		trace.SpanFromContext(ctx).AddEvent("weather.missing_temperature", trace.WithAttributes(
+			attribute.String("weather.provider", "weatherapi"),
+			attribute.String("location", weatherResp.Location.Name),
+		))
+		return nil, ErrMissingTemperature
+	}
+
+	// WeatherAPI does not zero-pad the hour ("2024-01-01 9:05")
+	localTime := weatherResp.Location.LocalTime
+	if t, err := time.Parse(localTimeLayout, localTime); err == nil {
+		localTime = t.Format(localTimeLayout)
+	}
+
+	// Convert temperatures
+	tempC := *weatherResp.Current.TempC
+	feelsLikeC := tempC
+	if weatherResp.Current.FeelsLikeC != nil {
+		feelsLikeC = *weatherResp.Current.FeelsLikeC
+	}
+	weather := &WeatherResponse{
+		City:             weatherResp.Location.Name,
+		LocalTime:        localTime,
+		TempC:            tempC,
+		TempF:            celsiusToFahrenheit(tempC),
+		TempK:            celsiusToKelvin(tempC),
+		Latitude:         weatherResp.Location.Lat,
+		Longitude:        weatherResp.Location.Lon,
+		HasCoordinates:   true,
+		CacheTTL:         weatherResp.MaxAge,
+		HasCacheTTL:      weatherResp.HasMaxAge,
+		ReportedHumidity: weatherResp.Current.Humidity,
+		ReportedUV:       weatherResp.Current.UV,
+	}
+	weather.ReportedMeasuredAt = weatherAPIMeasuredAt(weatherResp)
+	weather.setFeelsLike(feelsLikeC)
+	return weather, nil
+}
+
+// weatherAPIMeasuredAt returns when WeatherAPI measured the conditions: its
+// last_updated_epoch or, without it, last_updated, a local time placed in the
+// location's zone by comparing localtime with localtime_epoch. It is zero when
+// neither is usable.
+func weatherAPIMeasuredAt(weatherResp *WeatherAPIResponse) time.Time {
+	if epoch := weatherResp.Current.LastUpdatedEpoch; epoch > 0 {
+		return time.Unix(epoch, 0)
+	}
+	lastUpdated, err := time.Parse(localTimeLayout, weatherResp.Current.LastUpdated)
+	if err != nil || weatherResp.Location.LocalTimeEpoch <= 0 {
+		return time.Time{}
+	}
+	localTime, err := time.Parse(localTimeLayout, weatherResp.Location.LocalTime)
+	if err != nil {
+		return time.Time{}
+	}
+	offset := localTime.Sub(time.Unix(weatherResp.Location.LocalTimeEpoch, 0)).Round(15 * time.Minute)
+	return lastUpdated.Add(-offset)
+}
+
+type OpenWeatherMapResponse struct {
+	Name  string `json:"name"`
+	Coord struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"coord"`
+	Main struct {
+		Temp      float64 `json:"temp"`
+		FeelsLike float64 `json:"feels_like"`
+		Humidity  *int    `json:"humidity"`
+	} `json:"main"`
+
+	// Time of the reading and the location's offset from UTC, both in seconds
+	Dt       int64 `json:"dt"`
+	Timezone int   `json:"timezone"`
+}
+
+type openWeatherMapProvider struct{}
+
+func (openWeatherMapProvider) Name() string { return "openweathermap" }
+
+func (openWeatherMapProvider) Fetch(ctx context.Context, location *Location) (*WeatherResponse, error) {
+	apiKey := os.Getenv("OPENWEATHERMAP_API_KEY")
+	if apiKey == "" {
+		return mockWeather(ctx, location), nil
+	}
+
+	apiURL := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?q=%s&units=metric&appid=%s",
+		url.QueryEscape(location.City+",BR"), apiKey)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to OpenWeatherMap: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenWeatherMap returned status %d", resp.StatusCode)
+	}
+
+	var owmResp OpenWeatherMapResponse
+	if err := json.NewDecoder(upstreamBody(resp.Body)).Decode(&owmResp); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenWeatherMap response: %w", err)
+	}
+
+	tempC := owmResp.Main.Temp
+	weather := &WeatherResponse{
+		City:             owmResp.Name,
+		LocalTime:        time.Unix(owmResp.Dt, 0).In(time.FixedZone("", owmResp.Timezone)).Format(localTimeLayout),
+		TempC:            tempC,
+		TempF:            celsiusToFahrenheit(tempC),
+		TempK:            celsiusToKelvin(tempC),
+		Latitude:         owmResp.Coord.Lat,
+		Longitude:        owmResp.Coord.Lon,
+		HasCoordinates:   true,
+		ReportedHumidity: owmResp.Main.Humidity,
+	}
+	if owmResp.Dt > 0 {
+		weather.ReportedMeasuredAt = time.Unix(owmResp.Dt, 0)
+	}
+	weather.setFeelsLike(owmResp.Main.FeelsLike)
+	return weather, nil
+}
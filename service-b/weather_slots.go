@@ -0,0 +1,32 @@
+package serviceb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+// weatherAPISlots bounds the WeatherAPI calls in flight to
+// WEATHER_MAX_CONCURRENT, whatever the inbound concurrency; nil means
+// unbounded.
+var weatherAPISlots *semaphore.Weighted
+
+// acquireWeatherAPISlot waits for a free WeatherAPI slot, or for ctx to be
+// done, and records the wait on the current span. The returned func releases
+// the slot.
+func acquireWeatherAPISlot(ctx context.Context) (func(), error) {
+	if weatherAPISlots == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	err := weatherAPISlots.Acquire(ctx, 1)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("weatherapi.slot_wait_ms", time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for a WeatherAPI slot: %w", err)
+	}
+	return func() { weatherAPISlots.Release(1) }, nil
+}
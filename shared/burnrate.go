@@ -0,0 +1,161 @@
+package shared
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BurnBucketWidth is the resolution of the rolling error rate windows, and so
+// the shortest SLO_BURN_WINDOWS window.
+const BurnBucketWidth = 10 * time.Second
+
+// burnRateCheckInterval is how often the burn rate is checked against
+// SLO_BURN_RATE_THRESHOLD.
+const burnRateCheckInterval = 30 * time.Second
+
+// SLO is the availability objective an ErrorBudgetTracker measures against,
+// from the SLO_* variables.
+type SLO struct {
+	AvailabilityTarget float64
+	BurnWindows        []time.Duration
+	BurnRateThreshold  float64
+}
+
+// BurnRate is the error rate over one SLO_BURN_WINDOWS window and how fast it
+// consumes the error budget: 1 spends it exactly over the SLO period.
+type BurnRate struct {
+	Requests  int64   `json:"requests"`
+	ErrorRate float64 `json:"error_rate"`
+	BurnRate  float64 `json:"burn_rate"`
+}
+
+type bucket struct {
+	start  int64 // unix time of the bucket start, in width units
+	total  int64
+	errors int64
+}
+
+// ErrorCounts counts requests and failures in a ring of fixed-width buckets
+// spanning a window, for error rates over any part of it. It is not safe for
+// concurrent use.
+type ErrorCounts struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+// NewErrorCounts returns ErrorCounts over span in buckets of width.
+func NewErrorCounts(width, span time.Duration) *ErrorCounts {
+	return &ErrorCounts{width: width, buckets: make([]bucket, int(span/width)+1)}
+}
+
+// Record counts a request at now, and whether it failed.
+func (c *ErrorCounts) Record(now time.Time, failed bool) {
+	start := now.UnixNano() / int64(c.width)
+	b := &c.buckets[start%int64(len(c.buckets))]
+	if b.start != start {
+		*b = bucket{start: start}
+	}
+	b.total++
+	if failed {
+		b.errors++
+	}
+}
+
+// Over returns the requests and failures counted in the window up to now.
+func (c *ErrorCounts) Over(now time.Time, window time.Duration) (total, errors int64) {
+	current := now.UnixNano() / int64(c.width)
+	oldest := current - int64(window/c.width)
+	for _, b := range c.buckets {
+		if b.start > oldest && b.start <= current {
+			total += b.total
+			errors += b.errors
+		}
+	}
+	return total, errors
+}
+
+// ErrorBudgetTracker keeps request and 5xx counts over the longest
+// SLO_BURN_WINDOWS window.
+type ErrorBudgetTracker struct {
+	slo    SLO
+	mu     sync.Mutex
+	counts *ErrorCounts
+}
+
+func NewErrorBudgetTracker(slo SLO) *ErrorBudgetTracker {
+	longest := BurnBucketWidth
+	for _, window := range slo.BurnWindows {
+		longest = max(longest, window)
+	}
+	return &ErrorBudgetTracker{slo: slo, counts: NewErrorCounts(BurnBucketWidth, longest)}
+}
+
+func (t *ErrorBudgetTracker) record(status int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts.Record(now, status >= http.StatusInternalServerError)
+}
+
+// BurnRates returns the burn rate over every SLO_BURN_WINDOWS window, keyed by
+// the window as written, e.g. "5m0s".
+func (t *ErrorBudgetTracker) BurnRates(now time.Time) map[string]BurnRate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	budget := 1 - t.slo.AvailabilityTarget
+	rates := make(map[string]BurnRate, len(t.slo.BurnWindows))
+	for _, window := range t.slo.BurnWindows {
+		total, errors := t.counts.Over(now, window)
+
+		var rate BurnRate
+		rate.Requests = total
+		if total > 0 {
+			rate.ErrorRate = float64(errors) / float64(total)
+		}
+		if budget > 0 {
+			rate.BurnRate = rate.ErrorRate / budget
+		}
+		rates[window.String()] = rate
+	}
+	return rates
+}
+
+// Track counts every request and whether it failed with a 5xx towards the
+// SLO burn rate.
+func (t *ErrorBudgetTracker) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+		t.record(recorder.Status(), Now())
+	})
+}
+
+// Monitor logs a warning whenever a window burns the error budget faster
+// than SLO_BURN_RATE_THRESHOLD, until ctx is done.
+func (t *ErrorBudgetTracker) Monitor(ctx context.Context) {
+	ticker := time.NewTicker(burnRateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for window, rate := range t.BurnRates(Now()) {
+			if rate.BurnRate > t.slo.BurnRateThreshold {
+				slog.Warn("error budget burning too fast",
+					"window", window,
+					"burn_rate", rate.BurnRate,
+					"error_rate", rate.ErrorRate,
+					"requests", rate.Requests,
+					"threshold", t.slo.BurnRateThreshold,
+				)
+			}
+		}
+	}
+}
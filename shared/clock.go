@@ -0,0 +1,32 @@
+package shared
+
+import "time"
+
+// Clock tells the time to the cache and metrics code, so TTL expiry, uptime
+// and the burn rate windows can be driven by a fake clock instead of sleeps.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// clock is the Clock in use; the real one unless a test swaps it.
+var clock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// Now returns the current time on the Clock in use.
+func Now() time.Time { return clock.Now() }
+
+// Since returns the time elapsed since t on the Clock in use.
+func Since(t time.Time) time.Duration { return clock.Since(t) }
+
+// SetClock makes c the Clock in use and returns the one it replaces, for
+// tests to restore.
+func SetClock(c Clock) Clock {
+	previous := clock
+	clock = c
+	return previous
+}
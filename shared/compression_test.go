@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompressResponses(t *testing.T) {
+	handler := CompressResponses(gzip.BestSpeed, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		io.WriteString(w, `{"city":"São Paulo"}`)
+	}))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"/", "gzip", true},
+		{"/", "br, gzip;q=0.5", true},
+		{"/", "gzip;q=0", false},
+		{"/", "", false},
+		{"/empty", "gzip", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+		if gzipped != tt.wantGzip {
+			t.Errorf("GET %s with Accept-Encoding %q gzipped = %v, want %v", tt.path, tt.acceptEncoding, gzipped, tt.wantGzip)
+			continue
+		}
+		if !gzipped {
+			continue
+		}
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		if body, _ := io.ReadAll(gz); string(body) != `{"city":"São Paulo"}` {
+			t.Errorf("decompressed body = %q", body)
+		}
+	}
+}
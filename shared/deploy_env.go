@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// DeployPreset holds the defaults DEPLOY_ENV selects; each is still
+// overridden by its own variable.
+type DeployPreset struct {
+	TracesSampleRatio float64
+	LogLevel          slog.Level
+}
+
+// deployPresets are the presets by DEPLOY_ENV; the empty one applies when it
+// is unset and tags no environment.
+var deployPresets = map[string]DeployPreset{
+	"":            {TracesSampleRatio: 1, LogLevel: slog.LevelInfo},
+	"development": {TracesSampleRatio: 1, LogLevel: slog.LevelDebug},
+	"staging":     {TracesSampleRatio: 1, LogLevel: slog.LevelInfo},
+	"production":  {TracesSampleRatio: 0.1, LogLevel: slog.LevelInfo},
+}
+
+// LoadDeployPreset returns DEPLOY_ENV and the preset it selects.
+func LoadDeployPreset() (string, DeployPreset, error) {
+	deployEnv := os.Getenv("DEPLOY_ENV")
+	preset, ok := deployPresets[deployEnv]
+	if !ok {
+		return "", DeployPreset{}, fmt.Errorf("invalid DEPLOY_ENV %q: must be development, staging or production", deployEnv)
+	}
+	return deployEnv, preset, nil
+}
+
+// LogDeployPreset logs the defaults DEPLOY_ENV applied, next to the effective
+// configuration that shows what overrode them.
+func LogDeployPreset(deployEnv string) {
+	if deployEnv == "" {
+		return
+	}
+	preset := deployPresets[deployEnv]
+	slog.Info("deploy environment preset",
+		"deploy_env", deployEnv,
+		"traces_sample_ratio", preset.TracesSampleRatio,
+		"log_level", preset.LogLevel,
+	)
+}
@@ -0,0 +1,5 @@
+// Package shared holds the code Service A and Service B both run: the clock,
+// the middlewares and request accounting of their HTTP servers and the
+// telemetry setup they have in common. Each service passes in what depends on
+// its own configuration.
+package shared
@@ -0,0 +1,115 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// drainProgressInterval is how often shutdown logs the requests still in flight.
+const drainProgressInterval = time.Second
+
+// InFlightRequests counts the requests being served, by endpoint, so shutdown
+// can report what is still draining.
+type InFlightRequests struct {
+	mu         sync.Mutex
+	total      int
+	byEndpoint map[string]int
+}
+
+func NewInFlightRequests() *InFlightRequests {
+	return &InFlightRequests{byEndpoint: make(map[string]int)}
+}
+
+func (f *InFlightRequests) add(endpoint string, delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.total += delta
+	f.byEndpoint[endpoint] += delta
+	if f.byEndpoint[endpoint] == 0 {
+		delete(f.byEndpoint, endpoint)
+	}
+}
+
+func (f *InFlightRequests) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.total
+}
+
+// endpoints returns the endpoints with requests in flight, sorted by name.
+func (f *InFlightRequests) endpoints() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoints := make([]string, 0, len(f.byEndpoint))
+	for endpoint := range f.byEndpoint {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// Track counts every request while it is served, keyed by the mux pattern
+// like RequestStats.Collect so path parameters stay out of the logs.
+func (f *InFlightRequests) Track(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := routePattern(mux, r)
+		f.add(endpoint, 1)
+		defer f.add(endpoint, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Serve runs server until SIGINT or SIGTERM, then stops accepting connections
+// and waits up to drainTimeout for the requests in flight, logging progress.
+func (f *InFlightRequests) Serve(server *http.Server, drainTimeout time.Duration) {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Server failed to start: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, draining %d in-flight requests for up to %s", f.count(), drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(drainProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-drainCtx.Done():
+				return
+			case <-ticker.C:
+				log.Printf("Draining: %d requests still in flight", f.count())
+			}
+		}
+	}()
+
+	if err := server.Shutdown(drainCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("Drain timeout expired with %d requests in flight on %v", f.count(), f.endpoints())
+			return
+		}
+		log.Printf("Error shutting down server: %v", err)
+		return
+	}
+	log.Println("All requests drained")
+}
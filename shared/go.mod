@@ -0,0 +1,12 @@
+module shared
+
+go 1.21
+
+// Only the OpenTelemetry versions Service A is on are required, so that using
+// this module never upgrades Service A; Service B's newer ones are picked over
+// them in its build.
+require (
+	go.opentelemetry.io/otel v1.21.0
+	go.opentelemetry.io/otel/metric v1.21.0
+	go.opentelemetry.io/otel/trace v1.21.0
+)
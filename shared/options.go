@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// EndpointDescription is the self-description an endpoint answers OPTIONS
+// with: its methods, the request bodies and response formats it accepts and
+// its parameters.
+type EndpointDescription struct {
+	Path         string              `json:"path"`
+	Methods      []string            `json:"methods"`
+	Description  string              `json:"description"`
+	ContentTypes []string            `json:"content_types,omitempty"`
+	Formats      []string            `json:"formats,omitempty"`
+	Parameters   []EndpointParameter `json:"parameters,omitempty"`
+}
+
+// EndpointParameter is one input of an endpoint; In is "body", "path",
+// "query" or "header".
+type EndpointParameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+}
+
+// ResponseEncoder writes v as a response body in the formats of the service.
+type ResponseEncoder func(w http.ResponseWriter, r *http.Request, statusCode int, v interface{})
+
+// EncodeJSON is the ResponseEncoder of services that only answer JSON.
+func EncodeJSON(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// DescribeEndpoint returns the OPTIONS handler of the endpoint at path, which
+// answers with its description, written by encode, and an Allow header.
+func DescribeEndpoint(path string, description EndpointDescription, encode ResponseEncoder) http.HandlerFunc {
+	description.Path = path
+	allow := strings.Join(append(append([]string(nil), description.Methods...), http.MethodOptions), ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		encode(w, r, http.StatusOK, description)
+	}
+}
@@ -0,0 +1,30 @@
+package shared
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDescribeEndpoint(t *testing.T) {
+	description := EndpointDescription{Methods: []string{http.MethodGet, http.MethodHead}, Description: "Service name"}
+	handler := DescribeEndpoint("/", description, EncodeJSON)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodOptions, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got, want := rec.Header().Get("Allow"), "GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+	var got EndpointDescription
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if got.Path != "/" || got.Description != description.Description || len(got.Methods) != 2 {
+		t.Errorf("description = %+v, want %+v at /", got, description)
+	}
+}
@@ -0,0 +1,29 @@
+package shared
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// OTLPTLSConfig returns the TLS configuration of the OTLP exporters when
+// OTEL_EXPORTER_OTLP_INSECURE=false, verifying the collector against rootCAs
+// (OTEL_EXPORTER_OTLP_CERTIFICATE) or, when nil, the system roots.
+func OTLPTLSConfig(rootCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+}
+
+// LoadOTLPCertificate reads the PEM CA certificates of
+// OTEL_EXPORTER_OTLP_CERTIFICATE into a pool.
+func LoadOTLPCertificate(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OTEL_EXPORTER_OTLP_CERTIFICATE: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_CERTIFICATE %q: no PEM certificate found", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,105 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const FormMediaType = "application/x-www-form-urlencoded"
+
+// IsFormRequest reports whether the body of r is HTML-form encoded.
+func IsFormRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == FormMediaType
+}
+
+// DuplicateFieldError is returned with STRICT_JSON=true for a JSON body that
+// sets the same field twice, e.g. {"cep":"01001000","cep":"99999999"}.
+type DuplicateFieldError struct {
+	Field string
+}
+
+func (e *DuplicateFieldError) Error() string {
+	return fmt.Sprintf("duplicate field: %s", e.Field)
+}
+
+// utf8BOM is the byte order mark some clients prefix UTF-8 bodies with.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ErrTrailingData is returned for a JSON body with more than one value.
+var ErrTrailingData = errors.New("unexpected data after the JSON value")
+
+// DecodeJSONBody decodes the JSON body of r into v. A leading UTF-8 BOM and
+// trailing whitespace are allowed, but not a second value after the first.
+// When strict (STRICT_JSON=true) it first rejects bodies with duplicate keys
+// in any object, which encoding/json would otherwise silently resolve to the
+// last value.
+func DecodeJSONBody(r *http.Request, v interface{}, strict bool) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if strict {
+		if err := checkDuplicateFields(json.NewDecoder(bytes.NewReader(data))); err != nil {
+			return err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+// checkDuplicateFields walks the next JSON value of dec token by token and
+// returns a DuplicateFieldError for the first key repeated within an object.
+// Keys are compared case-insensitively, as encoding/json matches them.
+// Syntax errors are left for the real decode to report.
+func checkDuplicateFields(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	switch delim {
+	case '{':
+		seen := make(map[string]bool)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil
+			}
+			key, _ := tok.(string)
+			if seen[strings.ToLower(key)] {
+				return &DuplicateFieldError{Field: key}
+			}
+			seen[strings.ToLower(key)] = true
+			if err := checkDuplicateFields(dec); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for dec.More() {
+			if err := checkDuplicateFields(dec); err != nil {
+				return err
+			}
+		}
+	}
+	dec.Token()
+	return nil
+}
@@ -0,0 +1,99 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request, echoed in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds the incoming request IDs we keep.
+const maxRequestIDLength = 128
+
+// The REQUEST_ID_FORMAT values.
+const (
+	RequestIDFormatUUID  = "uuid"
+	RequestIDFormatULID  = "ulid"
+	RequestIDFormatTrace = "trace"
+)
+
+// crockfordAlphabet is the base32 alphabet of ULIDs.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// AssignRequestID keeps the X-Request-Id of the request, so a chain of calls
+// shares one ID, or generates one in format (REQUEST_ID_FORMAT). The ID is
+// echoed in the response and recorded on the request span.
+func AssignRequestID(format string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID(r, format)
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.id", id))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID reports whether an incoming ID is short and made of
+// printable ASCII, so it can safely be echoed and logged.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates an ID in format: a random UUID, a ULID sortable by
+// time, or the trace ID of the request so logs and request IDs line up.
+// Untraced requests get a UUID under RequestIDFormatTrace.
+func newRequestID(r *http.Request, format string) string {
+	switch format {
+	case RequestIDFormatULID:
+		return newULID(Now())
+	case RequestIDFormatTrace:
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			return spanContext.TraceID().String()
+		}
+	}
+	return NewUUID()
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newULID returns a ULID: the milliseconds since the epoch in 48 bits then 80
+// random bits, as 26 base32 digits.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var id [26]byte
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
@@ -0,0 +1,45 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAssignRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		incoming string
+		want     *regexp.Regexp
+	}{
+		{name: "kept", format: RequestIDFormatUUID, incoming: "abc-123", want: regexp.MustCompile(`^abc-123$`)},
+		{name: "uuid", format: RequestIDFormatUUID, want: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "ulid", format: RequestIDFormatULID, want: regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)},
+		{name: "invalid replaced", format: RequestIDFormatULID, incoming: strings.Repeat("x", maxRequestIDLength+1), want: regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := AssignRequestID(tt.format, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header.Get(RequestIDHeader)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(RequestIDHeader)
+			if !tt.want.MatchString(got) {
+				t.Errorf("X-Request-Id = %q, want a match of %s", got, tt.want)
+			}
+			if seen != got {
+				t.Errorf("handler saw X-Request-Id %q, response has %q", seen, got)
+			}
+		})
+	}
+}
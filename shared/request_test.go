@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		strict  bool
+		want    string
+		wantErr error
+	}{
+		{name: "plain", body: `{"cep":"01001000"}`, want: "01001000"},
+		{name: "BOM prefix", body: "\xEF\xBB\xBF" + `{"cep":"01001000"}`, want: "01001000"},
+		{name: "trailing newline", body: `{"cep":"01001000"}` + "\n", want: "01001000"},
+		{name: "trailing value", body: `{"cep":"01001000"}{"cep":"20040002"}`, wantErr: ErrTrailingData},
+		{name: "trailing value after newline", body: `{"cep":"01001000"}` + "\n" + `{"cep":"20040002"}`, wantErr: ErrTrailingData},
+		{name: "duplicate field", body: `{"cep":"01001000","cep":"20040002"}`, want: "20040002"},
+		{name: "strict duplicate field", body: `{"cep":"01001000","cep":"20040002"}`, strict: true, wantErr: &DuplicateFieldError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			var got struct {
+				CEP string `json:"cep"`
+			}
+			err := DecodeJSONBody(req, &got, tt.strict)
+			if tt.wantErr != nil {
+				var duplicate *DuplicateFieldError
+				if errors.As(tt.wantErr, &duplicate) {
+					if !errors.As(err, &duplicate) || duplicate.Field != "cep" {
+						t.Fatalf("DecodeJSONBody(%q) error = %v, want duplicate field: cep", tt.body, err)
+					}
+					return
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DecodeJSONBody(%q) error = %v, want %v", tt.body, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeJSONBody(%q): %v", tt.body, err)
+			}
+			if got.CEP != tt.want {
+				t.Errorf("DecodeJSONBody(%q) cep = %q, want %q", tt.body, got.CEP, tt.want)
+			}
+		})
+	}
+}
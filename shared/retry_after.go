@@ -0,0 +1,26 @@
+package shared
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetRetryAfter sets the Retry-After header to a random delay between base and
+// base plus jitter (RETRY_AFTER_JITTER), in whole seconds and at least one, so
+// the clients turned away together do not all retry at the same moment. The
+// delay chosen is recorded on the request span.
+func SetRetryAfter(w http.ResponseWriter, r *http.Request, base, jitter time.Duration) {
+	delay := base
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+	seconds := max(int(math.Ceil(delay.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("http.response.retry_after", seconds))
+}
@@ -0,0 +1,34 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		jitter   time.Duration
+		min, max int
+	}{
+		{name: "rounded up", base: 1500 * time.Millisecond, min: 2, max: 2},
+		{name: "at least one second", base: 0, min: 1, max: 1},
+		{name: "jittered", base: 2 * time.Second, jitter: 3 * time.Second, min: 2, max: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				rec := httptest.NewRecorder()
+				SetRetryAfter(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.base, tt.jitter)
+				seconds, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+				if err != nil || seconds < tt.min || seconds > tt.max {
+					t.Fatalf("Retry-After = %q, want between %d and %d", rec.Header().Get("Retry-After"), tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RegisterGCPauseMetric reports the total GC stop-the-world pause time, which
+// the runtime instrumentation leaves out. Reading it stops the world too, so
+// like the runtime instrumentation the memory stats are read at most once per
+// minInterval, and collections in between report the last reading.
+func RegisterGCPauseMetric(meter metric.Meter, minInterval time.Duration) error {
+	var (
+		mu       sync.Mutex
+		readAt   time.Time
+		pauseSum time.Duration
+	)
+	_, err := meter.Float64ObservableCounter("go_gc_pause_seconds_total",
+		metric.WithDescription("Cumulative time spent in GC stop-the-world pauses"),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if now := Now(); readAt.IsZero() || now.Sub(readAt) >= minInterval {
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				readAt, pauseSum = now, time.Duration(stats.PauseTotalNs)
+			}
+			o.Observe(pauseSum.Seconds())
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create go_gc_pause_seconds_total counter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Package sharedtest holds the test fixtures of the services.
+package sharedtest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"shared"
+)
+
+// FakeClock is a shared.Clock that only moves when advanced.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// UseFakeClock swaps the shared clock for a FakeClock for the rest of the test.
+func UseFakeClock(tb testing.TB) *FakeClock {
+	tb.Helper()
+	fake := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	previous := shared.SetClock(fake)
+	tb.Cleanup(func() { shared.SetClock(previous) })
+	return fake
+}
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxDebugSlow bounds the delay /debug/slow can be asked for.
+const maxDebugSlow = 30 * time.Second
+
+type SlowResponse struct {
+	SleptMs int64 `json:"slept_ms"`
+}
+
+// ErrorWriter answers a request with an error in the schema of the service.
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, message string, statusCode int)
+
+// SlowHandler returns the /debug/slow handler, which answers after sleeping
+// ?ms= milliseconds, at most maxDebugSlow, to test client timeouts and retries
+// against a known delay. The sleep, traced with tracer, ends early when the
+// request is cancelled.
+func SlowHandler(tracer trace.Tracer, writeError ErrorWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ms, err := strconv.ParseInt(r.URL.Query().Get("ms"), 10, 64)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxDebugSlow {
+			writeError(w, r, "invalid delay", http.StatusBadRequest)
+			return
+		}
+		delay := time.Duration(ms) * time.Millisecond
+
+		ctx, span := tracer.Start(r.Context(), "debug-sleep")
+		span.SetAttributes(attribute.Int64("debug.sleep_ms", ms))
+		start := time.Now()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			span.RecordError(ctx.Err())
+		}
+		span.End()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(SlowResponse{SleptMs: time.Since(start).Milliseconds()}); err != nil {
+			log.Printf("Failed to encode slow response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package shared
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EndpointStats are the counters kept for all requests and for each endpoint.
+type EndpointStats struct {
+	Requests         int64   `json:"requests"`
+	Successes        int64   `json:"successes"`
+	ClientErrors     int64   `json:"client_errors"`
+	ServerErrors     int64   `json:"server_errors"`
+	AverageLatencyMs float64 `json:"average_latency_ms"`
+
+	totalLatency time.Duration
+}
+
+func (s *EndpointStats) record(status int, latency time.Duration) {
+	s.Requests++
+	switch {
+	case status >= http.StatusInternalServerError:
+		s.ServerErrors++
+	case status >= http.StatusBadRequest:
+		s.ClientErrors++
+	default:
+		s.Successes++
+	}
+	s.totalLatency += latency
+	s.AverageLatencyMs = float64(s.totalLatency.Microseconds()) / 1000 / float64(s.Requests)
+}
+
+// RequestStatsSnapshot is what /stats reports of the requests served; each
+// service embeds it in its StatsResponse along with its own figures.
+type RequestStatsSnapshot struct {
+	Since         time.Time                `json:"since"`
+	UptimeSeconds int64                    `json:"uptime_seconds"`
+	Total         EndpointStats            `json:"total"`
+	Endpoints     map[string]EndpointStats `json:"endpoints"`
+}
+
+// RequestStats holds the in-memory counters served by /stats.
+type RequestStats struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	total     EndpointStats
+	endpoints map[string]*EndpointStats
+}
+
+func NewRequestStats() *RequestStats {
+	return &RequestStats{
+		startedAt: Now(),
+		endpoints: make(map[string]*EndpointStats),
+	}
+}
+
+func (s *RequestStats) record(endpoint string, status int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total.record(status, latency)
+	endpointStats, ok := s.endpoints[endpoint]
+	if !ok {
+		endpointStats = &EndpointStats{}
+		s.endpoints[endpoint] = endpointStats
+	}
+	endpointStats.record(status, latency)
+}
+
+func (s *RequestStats) Snapshot() RequestStatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := RequestStatsSnapshot{
+		Since:         s.startedAt.UTC(),
+		UptimeSeconds: int64(Since(s.startedAt).Seconds()),
+		Total:         s.total,
+		Endpoints:     make(map[string]EndpointStats, len(s.endpoints)),
+	}
+	for endpoint, endpointStats := range s.endpoints {
+		snapshot.Endpoints[endpoint] = *endpointStats
+	}
+	return snapshot
+}
+
+// Collect counts every request by the mux pattern it is routed to, so path
+// parameters do not create endpoints of their own. Requests that match no
+// route are counted under "other".
+func (s *RequestStats) Collect(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := routePattern(mux, r)
+		start := Now()
+		recorder := NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+		s.record(endpoint, recorder.Status(), Since(start))
+	})
+}
+
+// routePattern returns the mux pattern r is routed to, or "other".
+func routePattern(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return "other"
+}
+
+// StatusRecorder captures the status code written by a handler.
+type StatusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status code written, 200 if none was.
+func (r *StatusRecorder) Status() int {
+	return r.status
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,54 @@
+package shared
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTraceHeaders are the headers TRACE_HEADERS=true records when
+// TRACE_HEADERS_ALLOWLIST is unset.
+var DefaultTraceHeaders = []string{
+	"Accept", "Accept-Encoding", "Content-Type", "Content-Encoding", "Content-Length",
+	"User-Agent", "Traceparent", "Tracestate", "Baggage", "X-Request-Id",
+	"X-Request-Timeout", "X-Request-Deadline", "X-Forwarded-For", "X-Forwarded-Proto",
+	"If-None-Match", "ETag", "Cache-Control", "Retry-After", "Server-Timing",
+}
+
+// sensitiveHeaders never have their value recorded, even when allowlisted.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// TraceHeaders records the request and response headers in allowlist on the
+// request's span, to debug header propagation with TRACE_HEADERS=true. It is
+// meant for development: the values of sensitive headers are redacted.
+func TraceHeaders(allowlist []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(headerAttributes(allowlist, "http.request.header.", r.Header)...)
+		next.ServeHTTP(w, r)
+		span.SetAttributes(headerAttributes(allowlist, "http.response.header.", w.Header())...)
+	})
+}
+
+func headerAttributes(allowlist []string, prefix string, header http.Header) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, name := range allowlist {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if sensitiveHeaders[name] {
+			values = []string{"[REDACTED]"}
+		}
+		attrs = append(attrs, attribute.StringSlice(prefix+strings.ToLower(name), values))
+	}
+	return attrs
+}